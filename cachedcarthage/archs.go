@@ -0,0 +1,161 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/env"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const simulatorArchSuffix = "-simulator"
+
+// archVerifiedCommands are the Carthage commands building the frameworks, whose output architectures can be verified.
+var archVerifiedCommands = []string{bootstrapCommand, buildCommand, updateCommand}
+
+// lipoArchsPattern matches the architecture list of `lipo -info`, for example:
+// Architectures in the fat file: Carthage/Build/iOS/A.framework/A are: x86_64 arm64
+// Non-fat file: Carthage/Build/iOS/A.framework/A is architecture: arm64
+var lipoArchsPattern = regexp.MustCompile(`(?:are|is architecture): (.+)$`)
+
+// lipoInfo returns the output of `lipo -info` for the binary.
+func lipoInfo(pth string) (string, error) {
+	cmd := command.NewFactory(env.NewRepository()).Create("lipo", []string{"-info", pth}, nil)
+	out, err := cmd.RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s failed, output: %s, error: %s", cmd.PrintableCommandArgs(), out, err)
+	}
+	return out, nil
+}
+
+// parseLipoArchs returns the architectures of the `lipo -info` output.
+func parseLipoArchs(output string) []string {
+	match := lipoArchsPattern.FindStringSubmatch(strings.TrimSpace(output))
+	if match == nil {
+		return nil
+	}
+	return strings.Fields(match[1])
+}
+
+// verifyArchs fails if a built framework of the build dir misses an expected architecture.
+// The binaries of the platform dirs' frameworks are inspected with lipo, the XCFrameworks by their slice identifiers
+// (like `ios-arm64_x86_64-simulator`). An expected `<arch>-simulator` (like `arm64-simulator`) requires the architecture
+// in a simulator slice of the XCFrameworks, a plain `<arch>` in any of their slices or in the framework binaries.
+func verifyArchs(buildDir string, expected []string, info func(pth string) (string, error)) error {
+	entries, err := os.ReadDir(buildDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read build dir (%s), error: %s", buildDir, err)
+	}
+
+	var failures []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		pth := filepath.Join(buildDir, entry.Name())
+		if filepath.Ext(entry.Name()) == ".xcframework" {
+			if missing := missingXCFrameworkArchs(pth, expected); len(missing) > 0 {
+				failures = append(failures, fmt.Sprintf("%s (missing: %s)", entry.Name(), strings.Join(missing, ", ")))
+			}
+			continue
+		}
+
+		frameworks, err := filepath.Glob(filepath.Join(pth, "*.framework"))
+		if err != nil {
+			return err
+		}
+		for _, framework := range frameworks {
+			binary := filepath.Join(framework, strings.TrimSuffix(filepath.Base(framework), ".framework"))
+			out, err := info(binary)
+			if err != nil {
+				log.Warnf("Failed to inspect the architectures of %s: %s", binary, err)
+				continue
+			}
+
+			archs := parseLipoArchs(out)
+			var missing []string
+			for _, arch := range expected {
+				// A fat binary can not have a device and a simulator slice of the same architecture.
+				arch = strings.TrimSuffix(arch, simulatorArchSuffix)
+				if !contains(archs, arch) && !contains(missing, arch) {
+					missing = append(missing, arch)
+				}
+			}
+			if len(missing) > 0 {
+				failures = append(failures, fmt.Sprintf("%s/%s (missing: %s)", entry.Name(), filepath.Base(framework), strings.Join(missing, ", ")))
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return fmt.Errorf("built frameworks miss expected architectures: %s", strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+// missingXCFrameworkArchs returns the expected architectures not found in the XCFramework's slices.
+func missingXCFrameworkArchs(pth string, expected []string) []string {
+	slices, err := os.ReadDir(pth)
+	if err != nil {
+		log.Warnf("Failed to read %s, error: %s", pth, err)
+		return nil
+	}
+
+	var archs, simulatorArchs []string
+	for _, slice := range slices {
+		if !slice.IsDir() {
+			continue
+		}
+
+		// A slice identifier is the platform, the architectures joined by `_` and an optional variant:
+		// ios-arm64, ios-arm64_x86_64-simulator, ios-arm64_x86_64-maccatalyst
+		parts := strings.Split(slice.Name(), "-")
+		if len(parts) < 2 {
+			continue
+		}
+		sliceArchs := splitSliceArchs(parts[1])
+
+		archs = append(archs, sliceArchs...)
+		if len(parts) > 2 && parts[2] == "simulator" {
+			simulatorArchs = append(simulatorArchs, sliceArchs...)
+		}
+	}
+
+	var missing []string
+	for _, arch := range expected {
+		found := contains(archs, arch)
+		if strings.HasSuffix(arch, simulatorArchSuffix) {
+			found = contains(simulatorArchs, strings.TrimSuffix(arch, simulatorArchSuffix))
+		}
+		if !found {
+			missing = append(missing, arch)
+		}
+	}
+	return missing
+}
+
+// splitSliceArchs splits the `_` joined architectures of a slice identifier, keeping x86_64 in one piece.
+func splitSliceArchs(joined string) []string {
+	parts := strings.Split(joined, "_")
+
+	var archs []string
+	for i := 0; i < len(parts); i++ {
+		if parts[i] == "x86" && i+1 < len(parts) && parts[i+1] == "64" {
+			archs = append(archs, "x86_64")
+			i++
+			continue
+		}
+		archs = append(archs, parts[i])
+	}
+	return archs
+}
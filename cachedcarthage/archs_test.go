@@ -0,0 +1,109 @@
+package cachedcarthage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WhenParseLipoArchsCalled_ThenExpectArchs(t *testing.T) {
+	assert.Equal(t, []string{"x86_64", "arm64"}, parseLipoArchs("Architectures in the fat file: /tmp/My App/A.framework/A are: x86_64 arm64 \n"))
+	assert.Equal(t, []string{"arm64"}, parseLipoArchs("Non-fat file: /tmp/A.framework/A is architecture: arm64"))
+	assert.Nil(t, parseLipoArchs("fatal error: lipo: can't open input file"))
+}
+
+func Test_GivenFrameworkMissingSlice_WhenVerifyArchsCalled_ThenExpectError(t *testing.T) {
+	// Given
+	buildDir := givenBuildDirWithFrameworks(t, "iOS/Alamofire.framework", "iOS/Kingfisher.framework")
+	info := givenFakeLipo(map[string]string{
+		"Alamofire":  "Architectures in the fat file: Alamofire are: x86_64 arm64",
+		"Kingfisher": "Non-fat file: Kingfisher is architecture: x86_64",
+	})
+
+	// When
+	err := verifyArchs(buildDir, []string{"arm64", "x86_64"}, info)
+
+	// Then
+	assert.EqualError(t, err, "built frameworks miss expected architectures: iOS/Kingfisher.framework (missing: arm64)")
+}
+
+func Test_GivenFrameworksWithExpectedArchs_WhenVerifyArchsCalled_ThenExpectNoError(t *testing.T) {
+	// Given
+	buildDir := givenBuildDirWithFrameworks(t, "iOS/Alamofire.framework", "Mac/Alamofire.framework")
+	info := givenFakeLipo(map[string]string{"Alamofire": "Architectures in the fat file: Alamofire are: x86_64 arm64"})
+
+	// When
+	err := verifyArchs(buildDir, []string{"arm64", "arm64-simulator"}, info)
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func Test_GivenXCFrameworkMissingSimulatorSlice_WhenVerifyArchsCalled_ThenExpectError(t *testing.T) {
+	// Given
+	buildDir := givenBuildDirWithFrameworks(t,
+		"Alamofire.xcframework/ios-arm64/Alamofire.framework",
+		"Alamofire.xcframework/ios-x86_64-simulator/Alamofire.framework",
+		"Kingfisher.xcframework/ios-arm64/Kingfisher.framework",
+		"Kingfisher.xcframework/ios-arm64_x86_64-simulator/Kingfisher.framework",
+	)
+	lipo := func(pth string) (string, error) { return "", errors.New("lipo is not used for XCFrameworks") }
+
+	// When
+	err := verifyArchs(buildDir, []string{"arm64", "x86_64", "arm64-simulator"}, lipo)
+
+	// Then
+	assert.EqualError(t, err, "built frameworks miss expected architectures: Alamofire.xcframework (missing: arm64-simulator)")
+}
+
+func Test_GivenExpectedArchsAndFrameworkMissingSlice_WhenBootstrapRunCalled_ThenExpectValidationErrorAndNoCacheCommit(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Build", "iOS", "Alamofire.framework", "Alamofire"), 16)
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false)
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands([]CommandBlueprint{{Command: "true"}}),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{ProjectDir: projectDir, ExpectedArchs: []string{"arm64"}},
+		lipoInfo:        givenFakeLipo(map[string]string{"Alamofire": "Non-fat file: Alamofire is architecture: x86_64"}),
+	}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrValidation))
+	assert.Contains(t, err.Error(), "iOS/Alamofire.framework (missing: arm64)")
+	mockCarthageCache.AssertNotCalled(t, "CreateIndicator")
+	mockCarthageCache.AssertNotCalled(t, "Commit")
+}
+
+func givenBuildDirWithFrameworks(t *testing.T, frameworks ...string) string {
+	buildDir := t.TempDir()
+	for _, framework := range frameworks {
+		require.NoError(t, os.MkdirAll(filepath.Join(buildDir, framework), 0755))
+	}
+	return buildDir
+}
+
+// givenFakeLipo returns the lipo output of the framework binaries by their name.
+func givenFakeLipo(outputs map[string]string) func(pth string) (string, error) {
+	return func(pth string) (string, error) {
+		output, ok := outputs[filepath.Base(pth)]
+		if !ok {
+			return "", errors.New("unexpected binary: " + pth)
+		}
+		return output, nil
+	}
+}
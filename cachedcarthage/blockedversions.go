@@ -0,0 +1,77 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// BlockedCarthageVersion is a Carthage release the Step does not run with, because of a known bug.
+// If Args is set, the version is only blocked for the runs with one of these arguments.
+type BlockedCarthageVersion struct {
+	Version *version.Version
+	Reason  string
+	Args    []string
+}
+
+// DefaultBlockedCarthageVersions are the Carthage releases with known bugs in their build output.
+var DefaultBlockedCarthageVersions = []BlockedCarthageVersion{
+	{
+		Version: version.Must(version.NewVersion("0.37.0")),
+		Reason:  "the first release supporting --use-xcframeworks, its XCFramework output is broken for some dependencies",
+		Args:    []string{useXCFrameworksArg},
+	},
+}
+
+// ParseBlockedCarthageVersions parses the newline separated `<version>` or `<version>: <reason>` lines,
+// empty lines are skipped.
+func ParseBlockedCarthageVersions(lines string) ([]BlockedCarthageVersion, error) {
+	var blocked []BlockedCarthageVersion
+	for _, line := range strings.Split(lines, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		v, err := version.NewVersion(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid Carthage version (%s), error: %s", strings.TrimSpace(parts[0]), err)
+		}
+
+		entry := BlockedCarthageVersion{Version: v}
+		if len(parts) > 1 {
+			entry.Reason = strings.TrimSpace(parts[1])
+		}
+		blocked = append(blocked, entry)
+	}
+	return blocked, nil
+}
+
+// ValidateCarthageVersion fails with the reason, if the given Carthage version is blocked for the Carthage arguments.
+func ValidateCarthageVersion(carthageVersion *version.Version, blocked []BlockedCarthageVersion, args []string) error {
+	for _, entry := range blocked {
+		if !carthageVersion.Equal(entry.Version) || !entry.appliesTo(args) {
+			continue
+		}
+
+		if entry.Reason == "" {
+			return fmt.Errorf("Carthage %s is blocked", carthageVersion)
+		}
+		return fmt.Errorf("Carthage %s is blocked: %s", carthageVersion, entry.Reason)
+	}
+	return nil
+}
+
+func (entry BlockedCarthageVersion) appliesTo(args []string) bool {
+	if len(entry.Args) == 0 {
+		return true
+	}
+	for _, arg := range entry.Args {
+		if contains(args, arg) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package cachedcarthage
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenBlockedVersionLines_WhenParseBlockedCarthageVersionsCalled_ThenExpectVersionsWithReasons(t *testing.T) {
+	// When
+	blocked, err := ParseBlockedCarthageVersions("0.38.0: broken xcframework output\n\n 0.39 \n")
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []BlockedCarthageVersion{
+		{Version: version.Must(version.NewVersion("0.38.0")), Reason: "broken xcframework output"},
+		{Version: version.Must(version.NewVersion("0.39"))},
+	}, blocked)
+}
+
+func Test_GivenInvalidVersion_WhenParseBlockedCarthageVersionsCalled_ThenExpectError(t *testing.T) {
+	// When
+	_, err := ParseBlockedCarthageVersions("latest: broken")
+
+	// Then
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid Carthage version (latest)")
+}
+
+func Test_GivenBlockedVersion_WhenValidateCarthageVersionCalled_ThenExpectReason(t *testing.T) {
+	// Given
+	blocked, err := ParseBlockedCarthageVersions("0.38.0: broken xcframework output\n0.39.0")
+	require.NoError(t, err)
+
+	// When
+	err = ValidateCarthageVersion(version.Must(version.NewVersion("0.38")), blocked, nil)
+
+	// Then
+	assert.EqualError(t, err, "Carthage 0.38.0 is blocked: broken xcframework output")
+}
+
+func Test_GivenBlockedVersionWithoutReason_WhenValidateCarthageVersionCalled_ThenExpectError(t *testing.T) {
+	// Given
+	blocked, err := ParseBlockedCarthageVersions("0.39.0")
+	require.NoError(t, err)
+
+	// When
+	err = ValidateCarthageVersion(version.Must(version.NewVersion("0.39.0")), blocked, nil)
+
+	// Then
+	assert.EqualError(t, err, "Carthage 0.39.0 is blocked")
+}
+
+func Test_GivenAllowedVersion_WhenValidateCarthageVersionCalled_ThenExpectNoError(t *testing.T) {
+	// When
+	err := ValidateCarthageVersion(version.Must(version.NewVersion("0.39.1")), DefaultBlockedCarthageVersions, []string{"--use-xcframeworks"})
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func Test_GivenDefaultBlockedVersionWithXCFrameworks_WhenValidateCarthageVersionCalled_ThenExpectError(t *testing.T) {
+	// When
+	err := ValidateCarthageVersion(version.Must(version.NewVersion("0.37.0")), DefaultBlockedCarthageVersions, []string{"--platform", "iOS", "--use-xcframeworks"})
+
+	// Then
+	assert.Error(t, err)
+}
+
+func Test_GivenDefaultBlockedVersionWithoutXCFrameworks_WhenValidateCarthageVersionCalled_ThenExpectNoError(t *testing.T) {
+	// When
+	err := ValidateCarthageVersion(version.Must(version.NewVersion("0.37.0")), DefaultBlockedCarthageVersions, []string{"--platform", "iOS"})
+
+	// Then
+	assert.NoError(t, err)
+}
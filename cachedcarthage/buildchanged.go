@@ -0,0 +1,52 @@
+package cachedcarthage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// buildDirDigest returns the digest of the build directory's file tree: the relative paths, symlink targets
+// and file contents. The digest is empty if the directory does not exist.
+func buildDirDigest(dir string) (string, error) {
+	if _, err := os.Lstat(dir); os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	err := filepath.Walk(dir, func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, pth)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(pth)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "l %s\x00%s\x00", rel, target)
+		case info.IsDir():
+			fmt.Fprintf(hash, "d %s\x00", rel)
+		default:
+			fmt.Fprintf(hash, "f %s\x00%d\x00", rel, info.Size())
+			return copyFileTo(hash, pth)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash the build directory (%s), error: %s", dir, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
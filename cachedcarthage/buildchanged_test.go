@@ -0,0 +1,81 @@
+package cachedcarthage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenMissingBuildDir_WhenBuildDirDigestCalled_ThenExpectEmptyDigest(t *testing.T) {
+	// When
+	digest, err := buildDirDigest(filepath.Join(t.TempDir(), "Build"))
+
+	// Then
+	assert.NoError(t, err)
+	assert.Empty(t, digest)
+}
+
+func Test_GivenUnchangedBuildDir_WhenBuildDirDigestCalled_ThenExpectSameDigest(t *testing.T) {
+	// Given
+	dir := givenBuildDir(t, map[string]string{
+		"iOS/Alamofire.framework/Alamofire": "binary",
+		".Alamofire.version":                "{}",
+	})
+	before, err := buildDirDigest(dir)
+	require.NoError(t, err)
+
+	// When
+	after, err := buildDirDigest(dir)
+
+	// Then
+	assert.NoError(t, err)
+	assert.NotEmpty(t, after)
+	assert.Equal(t, before, after)
+}
+
+func Test_GivenChangedBuildDirFile_WhenBuildDirDigestCalled_ThenExpectDifferentDigest(t *testing.T) {
+	// Given
+	dir := givenBuildDir(t, map[string]string{
+		"iOS/Alamofire.framework/Alamofire": "binary",
+	})
+	before, err := buildDirDigest(dir)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "iOS/Alamofire.framework/Alamofire"), []byte("rebuilt"), 0644))
+
+	// When
+	after, err := buildDirDigest(dir)
+
+	// Then
+	assert.NoError(t, err)
+	assert.NotEqual(t, before, after)
+}
+
+func Test_GivenAddedBuildDirFile_WhenBuildDirDigestCalled_ThenExpectDifferentDigest(t *testing.T) {
+	// Given
+	dir := givenBuildDir(t, map[string]string{
+		"iOS/Alamofire.framework/Alamofire": "binary",
+	})
+	before, err := buildDirDigest(dir)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "Mac"), 0755))
+
+	// When
+	after, err := buildDirDigest(dir)
+
+	// Then
+	assert.NoError(t, err)
+	assert.NotEqual(t, before, after)
+}
+
+func givenBuildDir(t *testing.T, files map[string]string) string {
+	dir := filepath.Join(t.TempDir(), "Carthage", "Build")
+	for name, content := range files {
+		pth := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0755))
+		require.NoError(t, os.WriteFile(pth, []byte(content), 0644))
+	}
+	return dir
+}
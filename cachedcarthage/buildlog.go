@@ -0,0 +1,55 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const logPathArg = "--log-path"
+
+// getLogPathCommands returns the Carthage commands running xcodebuild, which accept the `--log-path` option.
+func getLogPathCommands() []string {
+	return []string{bootstrapCommand, buildCommand, updateCommand}
+}
+
+// withBuildLogPath returns the arguments writing the xcodebuild log to the given path, together with the log path in use.
+// An explicit `--log-path` argument is kept and its path is returned.
+func withBuildLogPath(args []string, logPath string) ([]string, string) {
+	if explicitPath := argValue(args, logPathArg); explicitPath != "" {
+		return args, explicitPath
+	}
+	if logPath == "" {
+		return args, ""
+	}
+
+	return append(append([]string{}, args...), logPathArg, logPath), logPath
+}
+
+// printBuildLogTail prints the last lines of the xcodebuild log, where the compiler errors of a failed build are found.
+func printBuildLogTail(logPath string, lineCount uint) {
+	if exists, err := pathutil.IsPathExists(logPath); err == nil && !exists {
+		log.Debugf("No xcodebuild log written to: %s", logPath)
+		return
+	}
+
+	content, err := fileutil.ReadStringFromFile(logPath)
+	if err != nil {
+		log.Warnf("Failed to read xcodebuild log (%s), error: %s", logPath, err)
+		return
+	}
+
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if uint(len(lines)) > lineCount {
+		lines = lines[len(lines)-int(lineCount):]
+	}
+
+	fmt.Println()
+	log.Infof("Last %d lines of the xcodebuild log (%s):", len(lines), logPath)
+	for _, line := range lines {
+		log.Printf("%s", line)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/bitrise-io/go-utils/fileutil"
 	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
 )
 
 // FileCache ...
@@ -22,10 +24,20 @@ type ProjectStateProvider interface {
 
 // Cache can be used the cache Carthage command results.
 type Cache struct {
-	project       Project
-	swiftVersion  string
-	filecache     FileCache
-	stateProvider ProjectStateProvider
+	project            Project
+	swiftVersion       string
+	ignoreSwiftVersion bool
+	filecache          FileCache
+	stateProvider      ProjectStateProvider
+	platforms          []string
+	noSkipCurrent      bool
+	stepVersion        string
+	xcodeVersion       string
+	derivedDataDir     string
+	carthageKitDir     string
+	keyFilesHash       string
+	libraryEvolution   string
+	hashAlgorithm      HashAlgorithm
 }
 
 // NewCache ...
@@ -38,6 +50,70 @@ func NewCache(project Project, swiftVersion string, filecache FileCache, statePr
 	}
 }
 
+// WithFileCache returns a copy of the cache, which commits the cached paths to the given file cache.
+func (cache Cache) WithFileCache(filecache FileCache) Cache {
+	cache.filecache = filecache
+	return cache
+}
+
+// WithPlatformDirs returns a copy of the cache, which caches the given platform subdirectories
+// of the build dir (like `iOS` for `Carthage/Build/iOS`, or `macOS` for `Carthage/Build/Mac`) as separate cache paths,
+// instead of the whole Carthage dir. Other built platforms are left out of the cache.
+// Every platform path uses the same Cachefile as indicator, so they are invalidated together.
+// The paths are registered one after the other, archiving them is up to the file cache.
+// The whole Carthage dir is cached if no platform has a build dir, like for a build dir of XCFrameworks.
+func (cache Cache) WithPlatformDirs(platforms []string) Cache {
+	cache.platforms = platforms
+	return cache
+}
+
+// WithNoSkipCurrent returns a copy of the cache, which keys the cache on whether the current project's
+// own schemes are built too (`--no-skip-current`), as the build output differs.
+func (cache Cache) WithNoSkipCurrent(noSkipCurrent bool) Cache {
+	cache.noSkipCurrent = noSkipCurrent
+	return cache
+}
+
+// WithStepVersion returns a copy of the cache, which keys the cache on the given Step version too,
+// so a release changing the build behavior invalidates the previous caches.
+func (cache Cache) WithStepVersion(stepVersion string) Cache {
+	cache.stepVersion = stepVersion
+	return cache
+}
+
+// WithoutSwiftVersion returns a copy of the cache, which leaves the Swift version out of the cache key,
+// for toolchains pinned outside of the Step. The Swift version is recorded as `ignored` in the Cachefile.
+func (cache Cache) WithoutSwiftVersion() Cache {
+	cache.ignoreSwiftVersion = true
+	return cache
+}
+
+// WithXcodeVersion returns a copy of the cache, which keys the cache on the given Xcode version too.
+func (cache Cache) WithXcodeVersion(xcodeVersion string) Cache {
+	cache.xcodeVersion = xcodeVersion
+	return cache
+}
+
+// WithHashAlgorithm returns a copy of the cache, which computes the cache key with the given algorithm.
+func (cache Cache) WithHashAlgorithm(algorithm HashAlgorithm) Cache {
+	cache.hashAlgorithm = algorithm
+	return cache
+}
+
+// Key returns the digest of the expected Cachefile content, identifying the current dependency set.
+func (cache Cache) Key() (string, error) {
+	state, err := cache.stateProvider.ParseState(cache.project)
+	if err != nil {
+		return "", err
+	}
+
+	if !state.resolvedFileExists {
+		return "", fmt.Errorf("no %s found at: %s", resolvedFileName, cache.project.resolvedFilePath())
+	}
+
+	return hexDigest(cache.hashAlgorithm, cache.createContentOfCacheFile(state.resolvedFileHash))
+}
+
 // CreateIndicator creates the `Cachefile`.
 func (cache Cache) CreateIndicator() error {
 	state, err := cache.stateProvider.ParseState(cache.project)
@@ -51,16 +127,21 @@ func (cache Cache) CreateIndicator() error {
 		}
 	}
 
-	cacheContent := cache.createContentOfCacheFile(state.resolvedFileContent)
+	cacheContent := cache.createContentOfCacheFile(state.resolvedFileHash)
 	if err := fileutil.WriteStringToFile(cache.project.cacheFilePath(), cacheContent); err != nil {
 		return fmt.Errorf("Failed to write cahe file, error: %s", err)
 	}
 
 	log.Donef("Cachefile created: %s", cache.project.cacheFilePath())
+
+	if err := cache.project.recordCheckouts(); err != nil {
+		log.Warnf("Failed to record the resolved versions of the checkouts: %s", err)
+	}
 	return nil
 }
 
 // Commit includes the Carthage dir if the Cachefile's content changes.
+// Nothing is included if the Carthage command produced no build output.
 func (cache Cache) Commit() error {
 	absCarthageDir, err := filepath.Abs(cache.project.carthageDir())
 	if err != nil {
@@ -71,7 +152,31 @@ func (cache Cache) Commit() error {
 		return fmt.Errorf("failed to determine absolute cachefile path")
 	}
 
-	cache.filecache.IncludePath(fmt.Sprintf("%s -> %s", absCarthageDir, absCacheFilePth))
+	if err := checkBuildOutput(filepath.Join(absCarthageDir, buildDirName)); err != nil {
+		return err
+	}
+
+	if platformDirs, skippedPlatforms := cache.platformDirs(filepath.Join(absCarthageDir, buildDirName)); len(platformDirs) > 0 {
+		if len(skippedPlatforms) > 0 {
+			log.Warnf("No build dir found for the platforms: %s, skipping them", strings.Join(skippedPlatforms, ", "))
+		}
+		cache.includePlatformDirs(platformDirs, absCacheFilePth)
+	} else {
+		if len(cache.platforms) > 0 {
+			log.Warnf("No build dir found for the platforms: %s (XCFrameworks have none), caching the whole Carthage dir", strings.Join(cache.platforms, ", "))
+		}
+		cache.logCachePath(absCarthageDir)
+		cache.filecache.IncludePath(fmt.Sprintf("%s -> %s", absCarthageDir, absCacheFilePth))
+	}
+
+	if cache.derivedDataDir != "" {
+		cache.includeDerivedDataDir(absCacheFilePth)
+	}
+
+	if cache.carthageKitDir != "" {
+		cache.includeCarthageKitCacheDir()
+	}
+
 	if err := cache.filecache.Commit(); err != nil {
 		return fmt.Errorf("failed to commit cache paths")
 	}
@@ -79,6 +184,112 @@ func (cache Cache) Commit() error {
 	return nil
 }
 
+// ExternalDirs returns the cached dirs outside of the project dir, like the DerivedData and the CarthageKit cache dir.
+func (cache Cache) ExternalDirs() []string {
+	var dirs []string
+	for _, dir := range []string{cache.derivedDataDir, cache.carthageKitDir} {
+		if dir == "" {
+			continue
+		}
+		if absDir, err := filepath.Abs(dir); err == nil {
+			dirs = append(dirs, absDir)
+		}
+	}
+	return dirs
+}
+
+// archiveSizer is implemented by the file caches creating the cache archive on Commit, like the LocalFileCache.
+type archiveSizer interface {
+	ArchiveSize() (int64, error)
+}
+
+// SavedSize returns the size of the committed cache: the archive's size, if the file cache creates it on Commit,
+// the summed size of the cached files otherwise, as the Bitrise cache archives them later, in the cache push step.
+func (cache Cache) SavedSize() (int64, error) {
+	if sizer, ok := cache.filecache.(archiveSizer); ok {
+		return sizer.ArchiveSize()
+	}
+
+	paths := []string{cache.project.carthageDir()}
+	if platformDirs, _ := cache.platformDirs(cache.project.buildDir()); len(platformDirs) > 0 {
+		paths = append([]string{cache.project.cacheFilePath()}, platformDirs...)
+	}
+	if cache.derivedDataDir != "" {
+		paths = append(paths, cache.derivedDataDir)
+	}
+	if cache.carthageKitDir != "" {
+		paths = append(paths, cache.carthageKitDir)
+	}
+
+	var size int64
+	for _, pth := range paths {
+		if _, err := os.Stat(pth); os.IsNotExist(err) {
+			continue
+		}
+
+		pathSize, err := dirSize(pth)
+		if err != nil {
+			return 0, err
+		}
+		size += pathSize
+	}
+	return size, nil
+}
+
+// Invalidate removes the Carthage build dir and the Cachefile, so the next build starts from scratch.
+func (cache Cache) Invalidate() error {
+	if err := os.RemoveAll(cache.project.buildDir()); err != nil {
+		return fmt.Errorf("failed to remove build dir (%s), error: %s", cache.project.buildDir(), err)
+	}
+
+	if err := os.Remove(cache.project.cacheFilePath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove Cachefile (%s), error: %s", cache.project.cacheFilePath(), err)
+	}
+
+	log.Donef("Cache invalidated")
+	return nil
+}
+
+// ReconcileVersionFiles applies the given mode to the `--cache-builds` version files of the build dir.
+func (cache Cache) ReconcileVersionFiles(mode VersionFileReconcileMode) error {
+	return reconcileVersionFiles(cache.project, mode)
+}
+
+// MakeBuildDirWritable adds the owner write permission to the restored build dir's content,
+// which might be read-only depending on how the cache was saved.
+func (cache Cache) MakeBuildDirWritable() error {
+	changed, err := makeWritable(cache.project.buildDir())
+	if err != nil {
+		return err
+	}
+
+	if changed > 0 {
+		log.Printf("Made %d read-only item(s) of %s writable", changed, cache.project.buildDir())
+	}
+	return nil
+}
+
+// MissingPlatforms returns the given platforms that are not built in the Carthage build dir.
+func (cache Cache) MissingPlatforms(platforms []string) ([]string, error) {
+	return cache.project.missingPlatforms(platforms)
+}
+
+// CheckoutsRestored returns if restored checkouts (`Carthage/Checkouts`) match the Cartfile.resolved,
+// so they can be built without checking them out again.
+func (cache Cache) CheckoutsRestored() (bool, error) {
+	return cache.project.checkoutsMatchResolved()
+}
+
+// IsRestored returns if the Carthage build dir has content already, for example restored by the cache pull step.
+func (cache Cache) IsRestored() (bool, error) {
+	state, err := cache.stateProvider.ParseState(cache.project)
+	if err != nil {
+		return false, err
+	}
+
+	return state.buildDirNotEmpty, nil
+}
+
 // IsAvailable returns if the Carthage project has cache available.
 func (cache Cache) IsAvailable() (bool, error) {
 
@@ -93,7 +304,7 @@ func (cache Cache) IsAvailable() (bool, error) {
 		return false, nil
 	}
 
-	expectedCacheFileContent := cache.createContentOfCacheFile(state.resolvedFileContent)
+	expectedCacheFileContent := cache.createContentOfCacheFile(state.resolvedFileHash)
 	if state.cacheFileContent != expectedCacheFileContent {
 		log.Debugf(
 			"Cachefile is not valid.\n" +
@@ -109,6 +320,79 @@ func (cache Cache) IsAvailable() (bool, error) {
 	return true, nil
 }
 
+// checkBuildOutput fails if the build dir is missing or empty, as caching it would produce a useless cache entry.
+func checkBuildOutput(buildDir string) error {
+	entries, err := os.ReadDir(buildDir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no build output to cache, build dir (%s) does not exist", buildDir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read build dir (%s), error: %s", buildDir, err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no build output to cache, build dir (%s) is empty", buildDir)
+	}
+
+	return nil
+}
+
+// platformDirs returns the existing build dirs of the platforms set by WithPlatformDirs, and the platforms without one.
+// No dir is returned for a build dir of XCFrameworks (`--use-xcframeworks`), which has no platform dirs.
+func (cache Cache) platformDirs(buildDir string) ([]string, []string) {
+	if len(cache.platforms) == 0 {
+		return nil, nil
+	}
+	if xcframeworks, err := filepath.Glob(filepath.Join(buildDir, "*.xcframework")); err == nil && len(xcframeworks) > 0 {
+		return nil, nil
+	}
+
+	var dirs, skipped []string
+	for _, platform := range cache.platforms {
+		platformDir := filepath.Join(buildDir, platformBuildDirName(platform))
+		if !hasBuildDir(platform) {
+			skipped = append(skipped, platform)
+		} else if exists, err := pathutil.IsDirExists(platformDir); err != nil || !exists {
+			skipped = append(skipped, platform)
+		} else {
+			dirs = append(dirs, platformDir)
+		}
+	}
+	return dirs, skipped
+}
+
+func (cache Cache) includePlatformDirs(absPlatformDirs []string, absCacheFilePth string) {
+	for _, absPlatformDir := range absPlatformDirs {
+		cache.logCachePath(absPlatformDir)
+		cache.filecache.IncludePath(fmt.Sprintf("%s -> %s", absPlatformDir, absCacheFilePth))
+	}
+
+	cache.filecache.IncludePath(absCacheFilePth)
+}
+
+// MissReason classifies why the cache is not available, by comparing the Cachefile with the expected content.
+func (cache Cache) MissReason() (CacheMissReason, error) {
+	state, err := cache.stateProvider.ParseState(cache.project)
+	if err != nil {
+		return "", err
+	}
+
+	if !state.cacheFileExists || !state.buildDirNotEmpty || !state.resolvedFileExists {
+		return CacheMissNoPriorEntry, nil
+	}
+
+	return classifyCacheMiss(state.cacheFileContent, cache.createContentOfCacheFile(state.resolvedFileHash)), nil
+}
+
+func (cache Cache) logCachePath(pth string) {
+	size, err := dirSize(pth)
+	if err != nil {
+		log.Warnf("Failed to calculate size of cache path (%s), error: %s", pth, err)
+		return
+	}
+
+	log.Infof("Caching %s (%s)", pth, formatSize(size))
+}
+
 func (cache Cache) logProjectStateWarnings(state ProjectState) {
 	// Print the warning about the missing Cachefile only if the other required file (Cartfile.resolved) is available.
 	// If the Cartfile.resolved is not found, then we don't want to mislead the user with this warning.
@@ -125,10 +409,34 @@ func (cache Cache) logProjectStateWarnings(state ProjectState) {
 	}
 }
 
-func (cache Cache) createContentOfCacheFile(resolvedFileContent string) string {
-	return fmt.Sprintf("--Swift version: %s --Swift version \n --%s: %s --%s",
-		cache.swiftVersion,
+// keySwiftVersion returns the Swift version the cache is keyed on, `ignored` if WithoutSwiftVersion is set.
+func (cache Cache) keySwiftVersion() string {
+	if cache.ignoreSwiftVersion {
+		return "ignored"
+	}
+	return cache.swiftVersion
+}
+
+func (cache Cache) createContentOfCacheFile(resolvedFileHash string) string {
+	content := fmt.Sprintf("--Swift version: %s --Swift version \n --%s: %s --%s",
+		cache.keySwiftVersion(),
 		resolvedFileName,
-		resolvedFileContent,
+		resolvedFileHash,
 		resolvedFileName)
+	if cache.noSkipCurrent {
+		content += "\n --no-skip-current"
+	}
+	if cache.stepVersion != "" {
+		content += fmt.Sprintf("\n --Step version: %s --Step version", cache.stepVersion)
+	}
+	if cache.xcodeVersion != "" {
+		content += fmt.Sprintf("\n --Xcode version: %s --Xcode version", cache.xcodeVersion)
+	}
+	if cache.keyFilesHash != "" {
+		content += fmt.Sprintf("\n --Key files: %s --Key files", cache.keyFilesHash)
+	}
+	if cache.libraryEvolution != "" {
+		content += fmt.Sprintf("\n --%s: %s --%s", LibraryEvolutionSetting, cache.libraryEvolution, LibraryEvolutionSetting)
+	}
+	return content
 }
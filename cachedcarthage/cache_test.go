@@ -1,14 +1,21 @@
 package cachedcarthage
 
 import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
 	"github.com/bitrise-io/go-utils/pathutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -42,7 +49,7 @@ func Test_GivenCarthageDirDoesNotExist_WhenCreateIndicatorCalled_ThenExpectCarth
 		err := os.RemoveAll(tempDir)
 		require.NoError(t, err)
 	}()
-	project := Project{tempDir}
+	project := Project{projectDir: tempDir}
 	mockStateProvider := givenMockProjectStateProvider().GivenParseStateSucceeds(ProjectState{})
 	mockFileCache := givenMockFileCache()
 
@@ -92,16 +99,60 @@ func Test_WhenCacheFileContentCalled_ThenExpectCorrectValue(t *testing.T) {
 	assert.Equal(t, expectedContent, actualContent)
 }
 
+func Test_GivenNoSkipCurrent_WhenKeyCalled_ThenExpectDifferentKey(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, "github \"Alamofire/Alamofire\" \"5.4.0\"\n")
+	defer removeProject(t, project)
+	cache := NewCache(project, "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm))
+
+	// When
+	key, err := cache.Key()
+	require.NoError(t, err)
+	noSkipCurrentKey, err := cache.WithNoSkipCurrent(true).Key()
+	require.NoError(t, err)
+
+	// Then
+	assert.NotEqual(t, key, noSkipCurrentKey)
+}
+
+func Test_GivenStepVersion_WhenKeyCalled_ThenExpectKeyDependingOnStepVersion(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, "github \"Alamofire/Alamofire\" \"5.4.0\"\n")
+	defer removeProject(t, project)
+	cache := NewCache(project, "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm))
+
+	// When
+	key, err := cache.Key()
+	require.NoError(t, err)
+	versionKey, err := cache.WithStepVersion("4.1.0").Key()
+	require.NoError(t, err)
+	sameVersionKey, err := cache.WithStepVersion("4.1.0").Key()
+	require.NoError(t, err)
+	otherVersionKey, err := cache.WithStepVersion("4.2.0").Key()
+	require.NoError(t, err)
+
+	// Then
+	assert.NotEqual(t, key, versionKey)
+	assert.Equal(t, versionKey, sameVersionKey)
+	assert.NotEqual(t, versionKey, otherVersionKey)
+}
+
 // Commit
 func Test_GivenFileCacheCommitFails_WhenCommitCalled_ThenExpectError(t *testing.T) {
 	// Given
 	expectedError := errors.New("failed to commit cache paths")
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "iOS", "A.framework", "A"), 16)
 	mockStateProvider := givenMockProjectStateProvider()
 	mockFileCache := givenMockFileCache().
 		GivenIncludeSucceeds().
 		GivenCommitFails(expectedError)
 	cache := Cache{
-		project:       Project{},
+		project:       Project{projectDir: tempDir},
 		swiftVersion:  "whatever",
 		filecache:     mockFileCache,
 		stateProvider: mockStateProvider,
@@ -116,7 +167,12 @@ func Test_GivenFileCacheCommitFails_WhenCommitCalled_ThenExpectError(t *testing.
 
 func Test_GivenFileCacheCommitSucceeds_WhenCommitCalled_ThenExpectIncludePathCalledWithCorrectValue(t *testing.T) {
 	// Given
-	projectDir := "/awesomepath"
+	projectDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(projectDir)
+		require.NoError(t, err)
+	}()
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Build", "iOS", "A.framework", "A"), 16)
 	expectedCacheCall := []string{fmt.Sprintf(
 		"%s -> %s",
 		filepath.Join(projectDir, "Carthage"),
@@ -126,7 +182,7 @@ func Test_GivenFileCacheCommitSucceeds_WhenCommitCalled_ThenExpectIncludePathCal
 		GivenIncludeSucceeds().
 		GivenCommitSucceeds()
 	cache := Cache{
-		project:       Project{projectDir},
+		project:       Project{projectDir: projectDir},
 		swiftVersion:  "whatever",
 		filecache:     mockFileCache,
 		stateProvider: mockStateProvider,
@@ -141,6 +197,431 @@ func Test_GivenFileCacheCommitSucceeds_WhenCommitCalled_ThenExpectIncludePathCal
 	mockFileCache.AssertCalled(t, "Commit")
 }
 
+func Test_GivenNoBuildDir_WhenCommitCalled_ThenExpectErrorAndNothingIncluded(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Checkouts", "A", "A.swift"), 16)
+	mockFileCache := givenMockFileCache()
+	cache := Cache{
+		project:       Project{projectDir: tempDir},
+		swiftVersion:  "whatever",
+		filecache:     mockFileCache,
+		stateProvider: givenMockProjectStateProvider(),
+	}
+
+	// When
+	actualError := cache.Commit()
+
+	// Then
+	assert.EqualError(t, actualError, fmt.Sprintf("no build output to cache, build dir (%s) does not exist", filepath.Join(tempDir, "Carthage", "Build")))
+	mockFileCache.AssertNotCalled(t, "IncludePath", mock.Anything)
+	mockFileCache.AssertNotCalled(t, "Commit")
+}
+
+func Test_GivenEmptyBuildDir_WhenCommitCalled_ThenExpectErrorAndNothingIncluded(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "Carthage", "Build"), 0755))
+	mockFileCache := givenMockFileCache()
+	cache := Cache{
+		project:       Project{projectDir: tempDir},
+		swiftVersion:  "whatever",
+		filecache:     mockFileCache,
+		stateProvider: givenMockProjectStateProvider(),
+	}
+
+	// When
+	actualError := cache.Commit()
+
+	// Then
+	assert.EqualError(t, actualError, fmt.Sprintf("no build output to cache, build dir (%s) is empty", filepath.Join(tempDir, "Carthage", "Build")))
+	mockFileCache.AssertNotCalled(t, "IncludePath", mock.Anything)
+	mockFileCache.AssertNotCalled(t, "Commit")
+}
+
+func Test_GivenCarthageDirWithFiles_WhenCommitCalled_ThenExpectCachePathAndSizeLogged(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "iOS", "A.framework", "A"), 1024)
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Cachefile"), 512)
+
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	mockFileCache := givenMockFileCache().
+		GivenIncludeSucceeds().
+		GivenCommitSucceeds()
+	cache := Cache{
+		project:       Project{projectDir: tempDir},
+		swiftVersion:  "whatever",
+		filecache:     mockFileCache,
+		stateProvider: givenMockProjectStateProvider(),
+	}
+
+	// When
+	actualError := cache.Commit()
+
+	// Then
+	assert.NoError(t, actualError)
+	assert.Contains(t, logs.String(), fmt.Sprintf("Caching %s (1.5 KB)", filepath.Join(tempDir, "Carthage")))
+}
+
+func Test_GivenPlatformDirs_WhenCommitCalled_ThenExpectPlatformDirsIncludedWithSameIndicator(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "iOS", "A.framework", "A"), 1024)
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "tvOS", "A.framework", "A"), 1024)
+	cacheFilePth := filepath.Join(tempDir, "Carthage", "Cachefile")
+
+	mockFileCache := givenMockFileCache().
+		GivenIncludeSucceeds().
+		GivenCommitSucceeds()
+	cache := Cache{
+		project:       Project{projectDir: tempDir},
+		swiftVersion:  "whatever",
+		filecache:     mockFileCache,
+		stateProvider: givenMockProjectStateProvider(),
+	}.WithPlatformDirs([]string{"iOS", "tvOS"})
+
+	// When
+	actualError := cache.Commit()
+
+	// Then
+	assert.NoError(t, actualError)
+	mockFileCache.AssertCalled(t, "IncludePath", []string{fmt.Sprintf("%s -> %s", filepath.Join(tempDir, "Carthage", "Build", "iOS"), cacheFilePth)})
+	mockFileCache.AssertCalled(t, "IncludePath", []string{fmt.Sprintf("%s -> %s", filepath.Join(tempDir, "Carthage", "Build", "tvOS"), cacheFilePth)})
+	mockFileCache.AssertCalled(t, "IncludePath", []string{cacheFilePth})
+	mockFileCache.AssertNumberOfCalls(t, "IncludePath", 3)
+	mockFileCache.AssertCalled(t, "Commit")
+}
+
+func Test_GivenPlatformDirsSubsetOfBuilt_WhenCommitCalled_ThenExpectOnlySelectedPlatformsIncluded(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	for _, platform := range []string{"iOS", "Mac", "tvOS", "watchOS"} {
+		givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", platform, "A.framework", "A"), 16)
+	}
+	cacheFilePth := filepath.Join(tempDir, "Carthage", "Cachefile")
+
+	mockFileCache := givenMockFileCache().
+		GivenIncludeSucceeds().
+		GivenCommitSucceeds()
+	cache := Cache{
+		project:       Project{projectDir: tempDir},
+		swiftVersion:  "whatever",
+		filecache:     mockFileCache,
+		stateProvider: givenMockProjectStateProvider(),
+	}.WithPlatformDirs([]string{"ios", "macOS"})
+
+	// When
+	actualError := cache.Commit()
+
+	// Then
+	assert.NoError(t, actualError)
+	mockFileCache.AssertCalled(t, "IncludePath", []string{fmt.Sprintf("%s -> %s", filepath.Join(tempDir, "Carthage", "Build", "iOS"), cacheFilePth)})
+	mockFileCache.AssertCalled(t, "IncludePath", []string{fmt.Sprintf("%s -> %s", filepath.Join(tempDir, "Carthage", "Build", "Mac"), cacheFilePth)})
+	mockFileCache.AssertCalled(t, "IncludePath", []string{cacheFilePth})
+	mockFileCache.AssertNumberOfCalls(t, "IncludePath", 3)
+}
+
+func Test_GivenMissingPlatformDir_WhenCommitCalled_ThenExpectPlatformSkipped(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "iOS", "A.framework", "A"), 1024)
+	cacheFilePth := filepath.Join(tempDir, "Carthage", "Cachefile")
+
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	mockFileCache := givenMockFileCache().
+		GivenIncludeSucceeds().
+		GivenCommitSucceeds()
+	cache := Cache{
+		project:       Project{projectDir: tempDir},
+		swiftVersion:  "whatever",
+		filecache:     mockFileCache,
+		stateProvider: givenMockProjectStateProvider(),
+	}.WithPlatformDirs([]string{"iOS", "watchOS"})
+
+	// When
+	actualError := cache.Commit()
+
+	// Then
+	assert.NoError(t, actualError)
+	mockFileCache.AssertCalled(t, "IncludePath", []string{fmt.Sprintf("%s -> %s", filepath.Join(tempDir, "Carthage", "Build", "iOS"), cacheFilePth)})
+	mockFileCache.AssertCalled(t, "IncludePath", []string{cacheFilePth})
+	mockFileCache.AssertNumberOfCalls(t, "IncludePath", 2)
+	assert.Contains(t, logs.String(), "No build dir found for the platforms: watchOS, skipping them")
+}
+
+func Test_GivenXCFrameworksBuildDirAndPlatformDirs_WhenCommitCalled_ThenExpectWholeCarthageDirIncluded(t *testing.T) {
+	// Given
+	tempDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "A.xcframework", "ios-arm64", "A.framework", "A"), 1024)
+	carthageDir := filepath.Join(tempDir, "Carthage")
+	cacheFilePth := filepath.Join(carthageDir, "Cachefile")
+
+	mockFileCache := givenMockFileCache().
+		GivenIncludeSucceeds().
+		GivenCommitSucceeds()
+	cache := Cache{
+		project:       Project{projectDir: tempDir},
+		swiftVersion:  "whatever",
+		filecache:     mockFileCache,
+		stateProvider: givenMockProjectStateProvider(),
+	}.WithPlatformDirs([]string{"iOS", "macCatalyst"})
+
+	// When
+	actualError := cache.Commit()
+
+	// Then
+	assert.NoError(t, actualError)
+	mockFileCache.AssertCalled(t, "IncludePath", []string{fmt.Sprintf("%s -> %s", carthageDir, cacheFilePth)})
+	mockFileCache.AssertNumberOfCalls(t, "IncludePath", 1)
+}
+
+func Test_GivenNoPlatformDirOfPlatforms_WhenCommitCalled_ThenExpectWholeCarthageDirIncluded(t *testing.T) {
+	// Given
+	tempDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "Mac", "A.framework", "A"), 1024)
+	carthageDir := filepath.Join(tempDir, "Carthage")
+	cacheFilePth := filepath.Join(carthageDir, "Cachefile")
+
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	mockFileCache := givenMockFileCache().
+		GivenIncludeSucceeds().
+		GivenCommitSucceeds()
+	cache := Cache{
+		project:       Project{projectDir: tempDir},
+		swiftVersion:  "whatever",
+		filecache:     mockFileCache,
+		stateProvider: givenMockProjectStateProvider(),
+	}.WithPlatformDirs([]string{"iOS", "tvOS"})
+
+	// When
+	actualError := cache.Commit()
+
+	// Then
+	assert.NoError(t, actualError)
+	mockFileCache.AssertCalled(t, "IncludePath", []string{fmt.Sprintf("%s -> %s", carthageDir, cacheFilePth)})
+	mockFileCache.AssertNumberOfCalls(t, "IncludePath", 1)
+	assert.Contains(t, logs.String(), "caching the whole Carthage dir")
+}
+
+func Test_GivenProjectDirWithSpacesAndUnicode_WhenIndicatorCreatedAndCommitted_ThenExpectCacheAvailableAndPathsIncluded(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	projectDir := filepath.Join(tempDir, "My App", "Árvíztűrő ώ->x")
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Build", "iOS", "A.framework", "A"), 16)
+	require.NoError(t, fileutil.WriteStringToFile(filepath.Join(projectDir, "Cartfile.resolved"), "github \"Alamofire/Alamofire\" \"5.4.0\"\n"))
+
+	localCacheDir := filepath.Join(tempDir, "local cache")
+	localFileCache := NewLocalFileCache(localCacheDir, "key", projectDir)
+	mockFileCache := givenMockFileCache().
+		GivenIncludeSucceeds().
+		GivenCommitSucceeds()
+	cache := NewCache(NewProject(projectDir), "5.3", mockFileCache, NewDefaultStateProvider(DefaultHashAlgorithm))
+
+	// When
+	require.NoError(t, cache.CreateIndicator())
+	require.NoError(t, cache.Commit())
+	require.NoError(t, cache.WithFileCache(localFileCache).Commit())
+	available, err := cache.IsAvailable()
+
+	// Then
+	require.NoError(t, err)
+	assert.True(t, available)
+	mockFileCache.AssertCalled(t, "IncludePath", []string{fmt.Sprintf("%s -> %s",
+		filepath.Join(projectDir, "Carthage"),
+		filepath.Join(projectDir, "Carthage", "Cachefile"))})
+	assert.Equal(t, []string{filepath.Join(projectDir, "Carthage")}, localFileCache.paths)
+	assert.FileExists(t, filepath.Join(localCacheDir, "key.tar.gz"))
+}
+
+// Invalidate
+func Test_GivenRestoredCache_WhenInvalidateCalled_ThenExpectBuildDirAndCacheFileRemoved(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	buildDir := filepath.Join(tempDir, "Carthage", "Build")
+	cacheFile := filepath.Join(tempDir, "Carthage", "Cachefile")
+	givenFileWithSize(t, filepath.Join(buildDir, "iOS", "A.framework", "A"), 16)
+	givenFileWithSize(t, cacheFile, 16)
+
+	cache := Cache{
+		project:       Project{projectDir: tempDir},
+		swiftVersion:  "whatever",
+		filecache:     givenMockFileCache(),
+		stateProvider: givenMockProjectStateProvider(),
+	}
+
+	// When
+	actualError := cache.Invalidate()
+
+	// Then
+	assert.NoError(t, actualError)
+	assert.NoDirExists(t, buildDir)
+	assert.NoFileExists(t, cacheFile)
+	assert.DirExists(t, filepath.Join(tempDir, "Carthage"))
+}
+
+// Key
+func Test_GivenResolvedFile_WhenKeyCalled_ThenExpectStableKeyDependingOnSwiftVersion(t *testing.T) {
+	// Given
+	state := ProjectState{resolvedFileExists: true, resolvedFileHash: "sha256:abc"}
+	cache := Cache{
+		project:       Project{},
+		swiftVersion:  "5.5",
+		stateProvider: givenMockProjectStateProvider().GivenParseStateSucceeds(state),
+	}
+	otherSwiftCache := cache
+	otherSwiftCache.swiftVersion = "5.4"
+
+	// When
+	key, err := cache.Key()
+	sameKey, sameErr := cache.Key()
+	otherKey, otherErr := otherSwiftCache.Key()
+
+	// Then
+	require.NoError(t, err)
+	require.NoError(t, sameErr)
+	require.NoError(t, otherErr)
+	assert.Len(t, key, 64)
+	assert.Equal(t, key, sameKey)
+	assert.NotEqual(t, key, otherKey)
+}
+
+func Test_GivenHashAlgorithm_WhenKeyCalled_ThenExpectKeyComputedWithAlgorithm(t *testing.T) {
+	// Given
+	state := ProjectState{resolvedFileExists: true, resolvedFileHash: "sha512:abc"}
+	cache := Cache{
+		project:       Project{},
+		swiftVersion:  "5.5",
+		stateProvider: givenMockProjectStateProvider().GivenParseStateSucceeds(state),
+	}.WithHashAlgorithm(SHA512)
+	expectedSum := sha512.Sum512([]byte(cache.createContentOfCacheFile("sha512:abc")))
+
+	// When
+	key, err := cache.Key()
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(expectedSum[:]), key)
+}
+
+func Test_GivenIgnoredSwiftVersion_WhenKeyCalled_ThenExpectKeyStableAcrossSwiftVersions(t *testing.T) {
+	// Given
+	state := ProjectState{resolvedFileExists: true, resolvedFileHash: "sha256:abc"}
+	cache := Cache{
+		project:       Project{},
+		swiftVersion:  "5.5",
+		stateProvider: givenMockProjectStateProvider().GivenParseStateSucceeds(state),
+	}
+	otherSwiftCache := cache
+	otherSwiftCache.swiftVersion = "5.5.1"
+
+	// When
+	key, err := cache.Key()
+	require.NoError(t, err)
+	ignoredKey, err := cache.WithoutSwiftVersion().Key()
+	require.NoError(t, err)
+	otherSwiftIgnoredKey, err := otherSwiftCache.WithoutSwiftVersion().Key()
+	require.NoError(t, err)
+
+	// Then
+	assert.NotEqual(t, key, ignoredKey)
+	assert.Equal(t, ignoredKey, otherSwiftIgnoredKey)
+	assert.Contains(t, cache.WithoutSwiftVersion().createContentOfCacheFile("sha256:abc"), "--Swift version: ignored --Swift version")
+}
+
+func Test_GivenNoResolvedFile_WhenKeyCalled_ThenExpectError(t *testing.T) {
+	// Given
+	cache := Cache{
+		project:       Project{projectDir: "/project"},
+		stateProvider: givenMockProjectStateProvider().GivenParseStateSucceeds(ProjectState{}),
+	}
+
+	// When
+	key, err := cache.Key()
+
+	// Then
+	assert.EqualError(t, err, "no Cartfile.resolved found at: /project/Cartfile.resolved")
+	assert.Empty(t, key)
+}
+
+func Test_GivenResolvedFilePathOverride_WhenKeyCalled_ThenExpectKeyOfTheOverride(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, "github \"Alamofire/Alamofire\" \"5.4.0\"\n")
+	defer removeProject(t, project)
+	overridePath := filepath.Join(project.projectDir, "build", "Cartfile.resolved")
+	require.NoError(t, os.MkdirAll(filepath.Dir(overridePath), 0777))
+	require.NoError(t, fileutil.WriteStringToFile(overridePath, "github \"Alamofire/Alamofire\" \"5.4.4\"\n"))
+	stateProvider := NewDefaultStateProvider(DefaultHashAlgorithm)
+
+	// When
+	key, err := NewCache(project, "5.3", givenMockFileCache(), stateProvider).Key()
+	require.NoError(t, err)
+	overrideKey, err := NewCache(project.WithResolvedFilePath(overridePath), "5.3", givenMockFileCache(), stateProvider).Key()
+	require.NoError(t, err)
+	require.NoError(t, fileutil.WriteStringToFile(filepath.Join(project.projectDir, "Cartfile.resolved"), "github \"Alamofire/Alamofire\" \"5.2.0\"\n"))
+	unchangedOverrideKey, err := NewCache(project.WithResolvedFilePath(overridePath), "5.3", givenMockFileCache(), stateProvider).Key()
+	require.NoError(t, err)
+
+	// Then
+	assert.NotEqual(t, key, overrideKey)
+	assert.Equal(t, overrideKey, unchangedOverrideKey)
+}
+
+func Test_GivenMissingResolvedFilePathOverride_WhenKeyCalled_ThenExpectErrorWithOverridePath(t *testing.T) {
+	// Given
+	cache := Cache{
+		project:       NewProject("/project").WithResolvedFilePath("/project/build/Cartfile.resolved"),
+		stateProvider: givenMockProjectStateProvider().GivenParseStateSucceeds(ProjectState{}),
+	}
+
+	// When
+	_, err := cache.Key()
+
+	// Then
+	assert.EqualError(t, err, "no Cartfile.resolved found at: /project/build/Cartfile.resolved")
+}
+
 // IsAvailable
 func Test_GivenStateCouldNotBeParsed_WhenIsAvailableCalled_ThenExpectError(t *testing.T) {
 	// Given
@@ -223,11 +704,11 @@ func Test_GivenStateIsIntactAndCacheFileIsCorrect_WhenIsAvailableCalled_ThenExpe
 		resolvedFileName)
 
 	state := ProjectState{
-		buildDirNotEmpty:    true,
-		cacheFileExists:     true,
-		cacheFileContent:    expectedContent,
-		resolvedFileExists:  true,
-		resolvedFileContent: resolvedContent,
+		buildDirNotEmpty:   true,
+		cacheFileExists:    true,
+		cacheFileContent:   expectedContent,
+		resolvedFileExists: true,
+		resolvedFileHash:   resolvedContent,
 	}
 	mockStateProvider := givenMockProjectStateProvider().GivenParseStateSucceeds(state)
 	mockFileCache := givenMockFileCache()
@@ -247,6 +728,45 @@ func Test_GivenStateIsIntactAndCacheFileIsCorrect_WhenIsAvailableCalled_ThenExpe
 	assert.True(t, actualValue)
 }
 
+func Test_GivenLocalFileCacheArchive_WhenSavedSizeCalled_ThenExpectArchiveSize(t *testing.T) {
+	// Given
+	cacheDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(cacheDir, "key.tar.gz"), 4321)
+	cache := Cache{
+		project:   NewProject(t.TempDir()),
+		filecache: NewLocalFileCache(cacheDir, "key", t.TempDir()),
+	}
+
+	// When
+	size, err := cache.SavedSize()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4321), size)
+}
+
+func Test_GivenBitriseFileCache_WhenSavedSizeCalled_ThenExpectCachedFilesSize(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Build", "iOS", "A.framework", "A"), 1000)
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Build", "Mac", "A.framework", "A"), 200)
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Cachefile"), 30)
+	cache := Cache{
+		project:   NewProject(projectDir),
+		filecache: givenMockFileCache(),
+	}
+
+	// When
+	size, err := cache.SavedSize()
+	platformsSize, platformsErr := cache.WithPlatformDirs([]string{"iOS"}).SavedSize()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1230), size)
+	assert.NoError(t, platformsErr)
+	assert.Equal(t, int64(1030), platformsSize)
+}
+
 // helpers
 func givenMockProjectStateProvider() *MockProjectStateProvider {
 	return new(MockProjectStateProvider)
@@ -256,6 +776,11 @@ func givenMockFileCache() *MockFileCache {
 	return new(MockFileCache)
 }
 
+func givenFileWithSize(t *testing.T, pth string, size int) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0777))
+	require.NoError(t, ioutil.WriteFile(pth, make([]byte, size), 0666))
+}
+
 func givenTempDir(t *testing.T) string {
 	path, err := pathutil.NormalizedOSTempDirPath("test")
 	require.NoError(t, err)
@@ -0,0 +1,38 @@
+package cachedcarthage
+
+import (
+	"path/filepath"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+// carthageKitCacheDir is where Carthage keeps its downloaded binaries and dependency repositories.
+const carthageKitCacheDir = "~/Library/Caches/org.carthage.CarthageKit"
+
+// CarthageKitCacheDir returns the absolute path of Carthage's own cache dir in the user's home.
+func CarthageKitCacheDir() (string, error) {
+	return pathutil.AbsPath(carthageKitCacheDir)
+}
+
+// WithCarthageKitCacheDir returns a copy of the cache, which caches the given CarthageKit cache dir too.
+// The dir is included without an indicator, so it is keyed by its own content, independently of the build dir.
+func (cache Cache) WithCarthageKitCacheDir(dir string) Cache {
+	cache.carthageKitDir = dir
+	return cache
+}
+
+func (cache Cache) includeCarthageKitCacheDir() {
+	absCarthageKitDir, err := filepath.Abs(cache.carthageKitDir)
+	if err != nil {
+		log.Warnf("Failed to determine absolute CarthageKit cache dir (%s), skipping it: %s", cache.carthageKitDir, err)
+		return
+	}
+	if exists, err := pathutil.IsDirExists(absCarthageKitDir); err != nil || !exists {
+		log.Warnf("No CarthageKit cache dir found at: %s, skipping it", absCarthageKitDir)
+		return
+	}
+
+	cache.logCachePath(absCarthageKitDir)
+	cache.filecache.IncludePath(absCarthageKitDir)
+}
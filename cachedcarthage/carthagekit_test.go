@@ -0,0 +1,78 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WhenCarthageKitCacheDirCalled_ThenExpectDirInHome(t *testing.T) {
+	// Given
+	home, err := pathutil.AbsPath("~")
+	require.NoError(t, err)
+
+	// When
+	dir, err := CarthageKitCacheDir()
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, "Library", "Caches", "org.carthage.CarthageKit"), dir)
+}
+
+func Test_GivenCarthageKitCacheDir_WhenCommitCalled_ThenExpectDirIncludedWithoutIndicator(t *testing.T) {
+	// Given
+	tempDir := t.TempDir()
+	projectDir := filepath.Join(tempDir, "project")
+	carthageKitDir := filepath.Join(tempDir, "org.carthage.CarthageKit")
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Build", "iOS", "A.framework", "A"), 16)
+	givenFileWithSize(t, filepath.Join(carthageKitDir, "binaries", "A", "1.0.0", "A.framework.zip"), 16)
+	cacheFilePth := filepath.Join(projectDir, "Carthage", "Cachefile")
+
+	mockFileCache := givenMockFileCache().
+		GivenIncludeSucceeds().
+		GivenCommitSucceeds()
+	cache := Cache{
+		project:       Project{projectDir: projectDir},
+		swiftVersion:  "whatever",
+		filecache:     mockFileCache,
+		stateProvider: givenMockProjectStateProvider(),
+	}.WithCarthageKitCacheDir(carthageKitDir)
+
+	// When
+	actualError := cache.Commit()
+
+	// Then
+	assert.NoError(t, actualError)
+	mockFileCache.AssertCalled(t, "IncludePath", []string{fmt.Sprintf("%s -> %s", filepath.Join(projectDir, "Carthage"), cacheFilePth)})
+	mockFileCache.AssertCalled(t, "IncludePath", []string{carthageKitDir})
+	mockFileCache.AssertNumberOfCalls(t, "IncludePath", 2)
+	mockFileCache.AssertCalled(t, "Commit")
+}
+
+func Test_GivenMissingCarthageKitCacheDir_WhenCommitCalled_ThenExpectDirSkipped(t *testing.T) {
+	// Given
+	tempDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "iOS", "A.framework", "A"), 16)
+
+	mockFileCache := givenMockFileCache().
+		GivenIncludeSucceeds().
+		GivenCommitSucceeds()
+	cache := Cache{
+		project:       Project{projectDir: tempDir},
+		swiftVersion:  "whatever",
+		filecache:     mockFileCache,
+		stateProvider: givenMockProjectStateProvider(),
+	}.WithCarthageKitCacheDir(filepath.Join(tempDir, "org.carthage.CarthageKit"))
+
+	// When
+	actualError := cache.Commit()
+
+	// Then
+	assert.NoError(t, actualError)
+	mockFileCache.AssertNumberOfCalls(t, "IncludePath", 1)
+	mockFileCache.AssertCalled(t, "Commit")
+}
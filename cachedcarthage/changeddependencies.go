@@ -0,0 +1,20 @@
+package cachedcarthage
+
+import "sort"
+
+// ChangedDependencies returns the names of the dependencies added or resolved to a different version,
+// compared to the baseline Cartfile.resolved content, in alphabetical order.
+// Removed dependencies are not reported, as there is nothing to build for them.
+func ChangedDependencies(baselineResolvedFileContent, resolvedFileContent string) []string {
+	baseline := resolvedDependencyVersions(baselineResolvedFileContent)
+
+	var changed []string
+	for name, version := range resolvedDependencyVersions(resolvedFileContent) {
+		if baselineVersion, ok := baseline[name]; !ok || baselineVersion != version {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+
+	return changed
+}
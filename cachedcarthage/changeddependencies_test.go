@@ -0,0 +1,45 @@
+package cachedcarthage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GivenBumpedAndAddedDependencies_WhenChangedDependenciesCalled_ThenExpectTheirNames(t *testing.T) {
+	// Given
+	baseline := `github "Alamofire/Alamofire" "5.4.0"
+github "onevcat/Kingfisher" "6.3.0"
+github "ReactiveX/RxSwift" "6.2.0"
+`
+	current := `github "Alamofire/Alamofire" "5.4.4"
+github "onevcat/Kingfisher" "6.3.0"
+binary "https://example.com/Firebase.json" "8.8.0"
+git "https://github.com/socketio/socket.io-client-swift.git" "v16.0.1"
+`
+
+	// When
+	changed := ChangedDependencies(baseline, current)
+
+	// Then
+	assert.Equal(t, []string{"Alamofire", "Firebase", "socket.io-client-swift"}, changed)
+}
+
+func Test_GivenSameResolvedFiles_WhenChangedDependenciesCalled_ThenExpectNone(t *testing.T) {
+	// Given
+	content := "github \"Alamofire/Alamofire\" \"5.4.0\"\r\n"
+
+	// When
+	changed := ChangedDependencies(content, "github \"Alamofire/Alamofire\" \"5.4.0\"\n")
+
+	// Then
+	assert.Empty(t, changed)
+}
+
+func Test_GivenNoBaseline_WhenChangedDependenciesCalled_ThenExpectEveryDependency(t *testing.T) {
+	// When
+	changed := ChangedDependencies("", "github \"onevcat/Kingfisher\" \"6.3.0\"\ngithub \"Alamofire/Alamofire\" \"5.4.0\"\n")
+
+	// Then
+	assert.Equal(t, []string{"Alamofire", "Kingfisher"}, changed)
+}
@@ -0,0 +1,139 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const (
+	checkoutsDirName = "Checkouts"
+	// checkoutsMarkerName is the copy of the Cartfile.resolved the checkouts were made for,
+	// stored in the checkouts dir so it is cached together with them.
+	checkoutsMarkerName = ".resolved"
+	noCheckoutArg       = "--no-checkout"
+	noSkipCurrentArg    = "--no-skip-current"
+)
+
+func (project Project) checkoutsDir() string {
+	return filepath.Join(project.carthageDir(), checkoutsDirName)
+}
+
+func (project Project) checkoutsMarkerPath() string {
+	return filepath.Join(project.checkoutsDir(), checkoutsMarkerName)
+}
+
+// recordCheckouts stores the current Cartfile.resolved next to the checkouts, if there are any.
+func (project Project) recordCheckouts() error {
+	if exists, err := pathutil.IsDirExists(project.checkoutsDir()); err != nil || !exists {
+		return err
+	}
+
+	content, err := fileutil.ReadBytesFromFile(project.resolvedFilePath())
+	if err != nil {
+		return fmt.Errorf("failed to read %s, error: %s", project.resolvedFilePath(), err)
+	}
+
+	return fileutil.WriteBytesToFile(project.checkoutsMarkerPath(), content)
+}
+
+// checkoutsMatchResolved returns if the checkouts were made for the current Cartfile.resolved and every checkout is present,
+// so the dependencies can be built without checking them out again.
+// Binary dependencies have no checkout, they are installed while checking out, so they are expected under the build dir already.
+func (project Project) checkoutsMatchResolved() (bool, error) {
+	current, err := readResolvedEntries(project.resolvedFilePath())
+	if err != nil || current == nil {
+		return false, err
+	}
+
+	recorded, err := readResolvedEntries(project.checkoutsMarkerPath())
+	if err != nil || recorded == nil {
+		return false, err
+	}
+
+	recordedVersions := map[string]string{}
+	for _, entry := range recorded {
+		recordedVersions[entry.Identifier] = entry.Version
+	}
+	if len(recordedVersions) != len(current) {
+		log.Debugf("Restored checkouts were made for a different set of dependencies")
+		return false, nil
+	}
+
+	for _, entry := range current {
+		if version, ok := recordedVersions[entry.Identifier]; !ok || version != entry.Version {
+			log.Debugf("Restored checkout of %s does not match the resolved version %s", entry.Name(), entry.Version)
+			return false, nil
+		}
+
+		if !entry.HasCheckout() {
+			if installed, err := project.isBinaryInstalled(entry.Name()); err != nil {
+				return false, err
+			} else if !installed {
+				log.Debugf("Binary dependency %s is not installed in: %s", entry.Name(), project.buildDir())
+				return false, nil
+			}
+			continue
+		}
+
+		checkoutDir := filepath.Join(project.checkoutsDir(), entry.Name())
+		if exists, err := pathutil.IsDirExists(checkoutDir); err != nil {
+			return false, err
+		} else if !exists {
+			log.Debugf("No checkout of %s found at: %s", entry.Name(), checkoutDir)
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// isBinaryInstalled returns if the build dir has the version file of the binary dependency,
+// or a framework named after it (an XCFramework in the build dir or a framework in a platform dir).
+func (project Project) isBinaryInstalled(name string) (bool, error) {
+	candidates := []string{
+		filepath.Join(project.buildDir(), "."+name+versionFileExtension),
+		filepath.Join(project.buildDir(), name+".xcframework"),
+	}
+	for _, platformDirName := range platformBuildDirNames {
+		candidates = append(candidates, filepath.Join(project.buildDir(), platformDirName, name+".framework"))
+	}
+
+	for _, candidate := range candidates {
+		if exists, err := pathutil.IsPathExists(candidate); err != nil {
+			return false, err
+		} else if exists {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// readResolvedEntries returns nil if the file does not exist.
+func readResolvedEntries(pth string) ([]ResolvedEntry, error) {
+	file, err := os.Open(pth)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open %s, error: %s", pth, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %s", pth, err)
+		}
+	}()
+
+	entries, err := ParseResolved(file)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []ResolvedEntry{}
+	}
+	return entries, nil
+}
@@ -0,0 +1,137 @@
+package cachedcarthage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const checkoutsTestResolved = `github "Alamofire/Alamofire" "5.4.4"
+git "https://github.com/ReactiveX/RxSwift.git" "6.2.0"
+`
+
+func Test_GivenCheckoutsRecordedForResolved_WhenCheckoutsMatchResolvedCalled_ThenExpectTrue(t *testing.T) {
+	// Given
+	project := givenProjectWithCheckouts(t, checkoutsTestResolved, "Alamofire", "RxSwift")
+	require.NoError(t, project.recordCheckouts())
+
+	// When
+	match, err := project.checkoutsMatchResolved()
+
+	// Then
+	require.NoError(t, err)
+	assert.True(t, match)
+}
+
+func Test_GivenCheckoutsRecordedForOtherVersion_WhenCheckoutsMatchResolvedCalled_ThenExpectFalse(t *testing.T) {
+	// Given
+	project := givenProjectWithCheckouts(t, checkoutsTestResolved, "Alamofire", "RxSwift")
+	require.NoError(t, project.recordCheckouts())
+	require.NoError(t, fileutil.WriteStringToFile(project.resolvedFilePath(), `github "Alamofire/Alamofire" "5.5.0"
+git "https://github.com/ReactiveX/RxSwift.git" "6.2.0"
+`))
+
+	// When
+	match, err := project.checkoutsMatchResolved()
+
+	// Then
+	require.NoError(t, err)
+	assert.False(t, match)
+}
+
+func Test_GivenRecordedCheckoutMissing_WhenCheckoutsMatchResolvedCalled_ThenExpectFalse(t *testing.T) {
+	// Given
+	project := givenProjectWithCheckouts(t, checkoutsTestResolved, "Alamofire")
+	require.NoError(t, project.recordCheckouts())
+
+	// When
+	match, err := project.checkoutsMatchResolved()
+
+	// Then
+	require.NoError(t, err)
+	assert.False(t, match)
+}
+
+func Test_GivenCheckoutsNotRecorded_WhenCheckoutsMatchResolvedCalled_ThenExpectFalse(t *testing.T) {
+	// Given
+	project := givenProjectWithCheckouts(t, checkoutsTestResolved, "Alamofire", "RxSwift")
+
+	// When
+	match, err := project.checkoutsMatchResolved()
+
+	// Then
+	require.NoError(t, err)
+	assert.False(t, match)
+}
+
+func Test_GivenBinaryDependencyNotInstalled_WhenCheckoutsMatchResolvedCalled_ThenExpectFalse(t *testing.T) {
+	// Given
+	project := givenProjectWithCheckouts(t, checkoutsTestResolved+`binary "https://dl.google.com/dl/firebase/ios/carthage/FirebaseAnalyticsBinary.json" "8.8.0"
+`, "Alamofire", "RxSwift")
+	require.NoError(t, project.recordCheckouts())
+
+	// When
+	match, err := project.checkoutsMatchResolved()
+
+	// Then
+	require.NoError(t, err)
+	assert.False(t, match)
+}
+
+func Test_GivenInstalledBinaryDependencies_WhenCheckoutsMatchResolvedCalled_ThenExpectTrueWithoutTheirCheckouts(t *testing.T) {
+	tests := []struct {
+		name          string
+		installedPath string
+	}{
+		{name: "version file", installedPath: ".FirebaseAnalyticsBinary.version"},
+		{name: "xcframework", installedPath: "FirebaseAnalyticsBinary.xcframework/Info.plist"},
+		{name: "platform framework", installedPath: "iOS/FirebaseAnalyticsBinary.framework/Info.plist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			project := givenProjectWithCheckouts(t, checkoutsTestResolved+`binary "https://dl.google.com/dl/firebase/ios/carthage/FirebaseAnalyticsBinary.json?alt=media" "8.8.0"
+`, "Alamofire", "RxSwift")
+			require.NoError(t, project.recordCheckouts())
+			givenFileWithSize(t, filepath.Join(project.buildDir(), tt.installedPath), 16)
+
+			// When
+			match, err := project.checkoutsMatchResolved()
+
+			// Then
+			require.NoError(t, err)
+			assert.True(t, match)
+		})
+	}
+}
+
+func Test_GivenBinaryOnlyResolvedAndBinaryRecordedForOtherVersion_WhenCheckoutsMatchResolvedCalled_ThenExpectFalse(t *testing.T) {
+	// Given
+	project := givenProjectWithCheckouts(t, `binary "https://example.com/Firebase.json" "8.8.0"
+`)
+	require.NoError(t, project.recordCheckouts())
+	givenFileWithSize(t, filepath.Join(project.buildDir(), ".Firebase.version"), 16)
+	require.NoError(t, fileutil.WriteStringToFile(project.resolvedFilePath(), `binary "https://example.com/Firebase.json" "8.9.0"
+`))
+
+	// When
+	match, err := project.checkoutsMatchResolved()
+
+	// Then
+	require.NoError(t, err)
+	assert.False(t, match)
+}
+
+func givenProjectWithCheckouts(t *testing.T, resolved string, checkouts ...string) Project {
+	project := NewProject(t.TempDir())
+	require.NoError(t, fileutil.WriteStringToFile(project.resolvedFilePath(), resolved))
+	require.NoError(t, os.MkdirAll(project.checkoutsDir(), 0777))
+	for _, checkout := range checkouts {
+		givenFileWithSize(t, filepath.Join(project.checkoutsDir(), checkout, "README.md"), 16)
+	}
+	return project
+}
@@ -0,0 +1,98 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/env"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// UnsignedCodeSignature is the ExpectedCodeSignature requiring every built framework to be unsigned.
+const UnsignedCodeSignature = "unsigned"
+
+const codesignNotSignedMessage = "code object is not signed at all"
+
+// codesignTeamPattern matches the team of the `codesign -dv` output, for example:
+// TeamIdentifier=ABCDE12345
+// TeamIdentifier=not set
+var codesignTeamPattern = regexp.MustCompile(`(?m)^TeamIdentifier=(.+)$`)
+
+// codesignInfo returns the output of `codesign -dv` for the bundle.
+// The command fails for an unsigned bundle, its output is returned in this case too.
+func codesignInfo(pth string) (string, error) {
+	cmd := command.NewFactory(env.NewRepository()).Create("codesign", []string{"-dv", pth}, nil)
+	out, err := cmd.RunAndReturnTrimmedCombinedOutput()
+	if err != nil && !strings.Contains(out, codesignNotSignedMessage) {
+		return "", fmt.Errorf("%s failed, output: %s, error: %s", cmd.PrintableCommandArgs(), out, err)
+	}
+	return out, nil
+}
+
+// codeSignature describes the signature of the `codesign -dv` output: `unsigned`, `ad-hoc signed` or `team <team ID>`.
+func codeSignature(output string) string {
+	if strings.Contains(output, codesignNotSignedMessage) {
+		return UnsignedCodeSignature
+	}
+
+	match := codesignTeamPattern.FindStringSubmatch(output)
+	if match == nil || strings.TrimSpace(match[1]) == "not set" {
+		return "ad-hoc signed"
+	}
+	return "team " + strings.TrimSpace(match[1])
+}
+
+// verifyCodeSignatures fails if a built framework of the build dir (in a platform dir or an XCFramework slice)
+// is not unsigned, if UnsignedCodeSignature is expected, or is not signed by the expected team otherwise.
+func verifyCodeSignatures(buildDir, expected string, info func(pth string) (string, error)) error {
+	frameworks, err := buildDirFrameworks(buildDir)
+	if err != nil {
+		return err
+	}
+
+	expectedSignature := UnsignedCodeSignature
+	if expected != UnsignedCodeSignature {
+		expectedSignature = "team " + expected
+	}
+
+	var failures []string
+	for _, framework := range frameworks {
+		out, err := info(framework.path)
+		if err != nil {
+			return fmt.Errorf("failed to inspect the code signature of %s: %s", framework.path, err)
+		}
+
+		if signature := codeSignature(out); signature != expectedSignature {
+			name := framework.path
+			if rel, err := filepath.Rel(buildDir, framework.path); err == nil {
+				name = filepath.ToSlash(rel)
+			}
+			failures = append(failures, fmt.Sprintf("%s (%s)", name, signature))
+		}
+	}
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return fmt.Errorf("built frameworks do not match the expected code signature (%s): %s", expectedSignature, strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+func (runner Runner) verifyCodeSignatures() error {
+	info := runner.codesignInfo
+	if info == nil {
+		info = codesignInfo
+	}
+
+	log.Infof("Verifying the code signatures of the built frameworks: %s", runner.opts.ExpectedCodeSignature)
+	if err := verifyCodeSignatures(runner.buildDir(), runner.opts.ExpectedCodeSignature, info); err != nil {
+		return err
+	}
+	log.Donef("Every built framework has the expected code signature")
+	return nil
+}
@@ -0,0 +1,109 @@
+package cachedcarthage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	unsignedCodesignOutput = "Carthage/Build/iOS/Alamofire.framework: code object is not signed at all"
+	teamCodesignOutput     = `Executable=/Carthage/Build/iOS/Alamofire.framework/Alamofire
+Identifier=org.alamofire.Alamofire
+Format=bundle with Mach-O thin (arm64)
+CodeDirectory v=20400 size=1234 flags=0x0(none) hashes=28+7 location=embedded
+Signature size=4790
+Authority=Apple Development: John Doe (ABCDE12345)
+TeamIdentifier=TEAM123456`
+	adhocCodesignOutput = `Executable=/Carthage/Build/iOS/Kingfisher.framework/Kingfisher
+Identifier=com.onevcat.Kingfisher
+CodeDirectory v=20400 size=1234 flags=0x2(adhoc) hashes=28+7 location=embedded
+Signature=adhoc
+TeamIdentifier=not set`
+)
+
+func Test_GivenCodesignOutputs_WhenCodeSignatureCalled_ThenExpectSignatures(t *testing.T) {
+	assert.Equal(t, "unsigned", codeSignature(unsignedCodesignOutput))
+	assert.Equal(t, "team TEAM123456", codeSignature(teamCodesignOutput))
+	assert.Equal(t, "ad-hoc signed", codeSignature(adhocCodesignOutput))
+}
+
+func Test_GivenUnsignedFrameworks_WhenVerifyCodeSignaturesCalledWithUnsigned_ThenExpectNoError(t *testing.T) {
+	// Given
+	buildDir := givenBuildDirWithFrameworks(t, "iOS/Alamofire.framework", "Kingfisher.xcframework/ios-arm64/Kingfisher.framework")
+	info := givenFakeCodesign(map[string]string{"Alamofire.framework": unsignedCodesignOutput, "Kingfisher.framework": unsignedCodesignOutput})
+
+	// When
+	err := verifyCodeSignatures(buildDir, UnsignedCodeSignature, info)
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func Test_GivenSignedAndAdhocFrameworks_WhenVerifyCodeSignaturesCalledWithUnsigned_ThenExpectError(t *testing.T) {
+	// Given
+	buildDir := givenBuildDirWithFrameworks(t, "iOS/Alamofire.framework", "Kingfisher.xcframework/ios-arm64/Kingfisher.framework")
+	info := givenFakeCodesign(map[string]string{"Alamofire.framework": teamCodesignOutput, "Kingfisher.framework": adhocCodesignOutput})
+
+	// When
+	err := verifyCodeSignatures(buildDir, UnsignedCodeSignature, info)
+
+	// Then
+	assert.EqualError(t, err, "built frameworks do not match the expected code signature (unsigned): "+
+		"Kingfisher.xcframework/ios-arm64/Kingfisher.framework (ad-hoc signed); iOS/Alamofire.framework (team TEAM123456)")
+}
+
+func Test_GivenFrameworksOfDifferentTeams_WhenVerifyCodeSignaturesCalledWithTeam_ThenExpectErrorListingMismatches(t *testing.T) {
+	// Given
+	buildDir := givenBuildDirWithFrameworks(t, "iOS/Alamofire.framework", "iOS/Kingfisher.framework")
+	info := givenFakeCodesign(map[string]string{"Alamofire.framework": teamCodesignOutput, "Kingfisher.framework": unsignedCodesignOutput})
+
+	// When
+	err := verifyCodeSignatures(buildDir, "TEAM123456", info)
+
+	// Then
+	assert.EqualError(t, err, "built frameworks do not match the expected code signature (team TEAM123456): iOS/Kingfisher.framework (unsigned)")
+}
+
+func Test_GivenCodesignFails_WhenVerifyCodeSignaturesCalled_ThenExpectError(t *testing.T) {
+	// Given
+	buildDir := givenBuildDirWithFrameworks(t, "iOS/Alamofire.framework")
+
+	// When
+	err := verifyCodeSignatures(buildDir, UnsignedCodeSignature, givenFakeCodesign(nil))
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to inspect the code signature of "+filepath.Join(buildDir, "iOS", "Alamofire.framework"))
+}
+
+func Test_GivenSignedFrameworkAndUnsignedExpected_WhenBuildRunCalled_ThenExpectValidationError(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Build", "iOS", "Alamofire.framework", "Alamofire"), 16)
+	runner := givenRunnerWithMainAndCommandBuilderCommands("build", []CommandBlueprint{{Command: "true"}})
+	runner.opts = RunnerOpts{ProjectDir: projectDir, ExpectedCodeSignature: UnsignedCodeSignature}
+	runner.codesignInfo = givenFakeCodesign(map[string]string{"Alamofire.framework": teamCodesignOutput})
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrValidation))
+	assert.Contains(t, err.Error(), "iOS/Alamofire.framework (team TEAM123456)")
+}
+
+// givenFakeCodesign returns the codesign output of the framework bundles by their name.
+func givenFakeCodesign(outputs map[string]string) func(pth string) (string, error) {
+	return func(pth string) (string, error) {
+		output, ok := outputs[filepath.Base(pth)]
+		if !ok {
+			return "", errors.New("unexpected bundle: " + pth)
+		}
+		return output, nil
+	}
+}
@@ -4,13 +4,24 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/bitrise-io/go-utils/fileutil"
 	"github.com/bitrise-io/go-utils/pathutil"
 )
 
+const projectDirPlaceholder = "$PROJECT_DIR"
+
 // DefaultStateProvider reads the current state of a cached Carthage project.
 type DefaultStateProvider struct {
+	hashAlgorithm HashAlgorithm
+}
+
+// NewDefaultStateProvider ...
+func NewDefaultStateProvider(hashAlgorithm HashAlgorithm) DefaultStateProvider {
+	return DefaultStateProvider{hashAlgorithm: hashAlgorithm}
 }
 
 // ParseState ...
@@ -25,6 +36,14 @@ func (provider DefaultStateProvider) ParseState(project Project) (ProjectState,
 		return ProjectState{}, err
 	}
 
+	resolvedFileHash := ""
+	if resolvedFileExists {
+		resolvedFileHash, err = hashContent(provider.hashAlgorithm, pathIndependentResolvedContent(resolvedFileContent, project.projectDir))
+		if err != nil {
+			return ProjectState{}, fmt.Errorf("failed to hash %s, error: %s", resolvedFileName, err)
+		}
+	}
+
 	carthageDirExists, err := pathutil.IsPathExists(project.carthageDir())
 	if err != nil {
 		return ProjectState{}, fmt.Errorf("failed to check if dir exists at (%s), error: %s", project.carthageDir(), err)
@@ -38,6 +57,7 @@ func (provider DefaultStateProvider) ParseState(project Project) (ProjectState,
 
 		resolvedFileExists:  resolvedFileExists,
 		resolvedFileContent: resolvedFileContent,
+		resolvedFileHash:    resolvedFileHash,
 
 		carthageDirExists: carthageDirExists,
 	}, nil
@@ -81,7 +101,35 @@ func (provider DefaultStateProvider) parseResolvedFileState(path string) (bool,
 		return false, "", fmt.Errorf("Catfile.resolved is empty")
 	}
 
-	return true, resolvedFileContent, nil
+	return true, normalizeResolvedFileContent(resolvedFileContent), nil
+}
+
+// normalizeResolvedFileContent unifies line endings and drops trailing whitespace,
+// so the same dependency set committed from different platforms results in the same cache content.
+func normalizeResolvedFileContent(content string) string {
+	content = strings.Replace(content, "\r\n", "\n", -1)
+	content = strings.Replace(content, "\r", "\n", -1)
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// pathIndependentResolvedContent replaces the project dir in the paths of local dependencies (like `git "file:///<project dir>/Libs/A"`)
+// with a placeholder, so the same project cloned to different paths results in the same cache key.
+func pathIndependentResolvedContent(content, projectDir string) string {
+	absProjectDir, err := filepath.Abs(projectDir)
+	if err != nil || absProjectDir == string(filepath.Separator) {
+		return content
+	}
+
+	pattern := regexp.MustCompile(regexp.QuoteMeta(filepath.ToSlash(absProjectDir)) + `[/"]`)
+	return pattern.ReplaceAllStringFunc(content, func(match string) string {
+		return projectDirPlaceholder + match[len(match)-1:]
+	})
 }
 
 func (provider DefaultStateProvider) contentOfFile(pth string) (string, error) {
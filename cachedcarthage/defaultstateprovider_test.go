@@ -0,0 +1,138 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenResolvedFilesWithDifferentLineEndings_WhenCacheFileContentCreated_ThenExpectSameContent(t *testing.T) {
+	// Given
+	lfContent := "github \"Alamofire/Alamofire\" \"5.4.4\"\ngithub \"onevcat/Kingfisher\" \"7.1.1\"\n"
+	crlfContent := "github \"Alamofire/Alamofire\" \"5.4.4\"  \r\ngithub \"onevcat/Kingfisher\" \"7.1.1\"\t\r\n\r\n"
+
+	lfProject := givenProjectWithResolvedFile(t, lfContent)
+	defer removeProject(t, lfProject)
+	crlfProject := givenProjectWithResolvedFile(t, crlfContent)
+	defer removeProject(t, crlfProject)
+
+	provider := DefaultStateProvider{}
+
+	// When
+	lfState, lfErr := provider.ParseState(lfProject)
+	crlfState, crlfErr := provider.ParseState(crlfProject)
+
+	// Then
+	require.NoError(t, lfErr)
+	require.NoError(t, crlfErr)
+	cache := Cache{swiftVersion: "5.5"}
+	assert.Equal(t, cache.createContentOfCacheFile(lfState.resolvedFileHash), cache.createContentOfCacheFile(crlfState.resolvedFileHash))
+}
+
+func Test_GivenDifferentHashAlgorithms_WhenParseStateCalled_ThenExpectDifferentButStableHashes(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, "github \"Alamofire/Alamofire\" \"5.4.4\"\n")
+	defer removeProject(t, project)
+
+	var hashes []string
+	for _, algorithm := range []HashAlgorithm{SHA256, SHA384, SHA512} {
+		provider := NewDefaultStateProvider(algorithm)
+
+		// When
+		first, err := provider.ParseState(project)
+		require.NoError(t, err)
+		second, err := provider.ParseState(project)
+		require.NoError(t, err)
+
+		// Then
+		assert.Equal(t, first.resolvedFileHash, second.resolvedFileHash)
+		assert.True(t, strings.HasPrefix(first.resolvedFileHash, string(algorithm)+":"))
+		assert.NotContains(t, hashes, first.resolvedFileHash)
+		hashes = append(hashes, first.resolvedFileHash)
+	}
+}
+
+func Test_GivenUnsupportedHashAlgorithm_WhenParseStateCalled_ThenExpectError(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, "github \"Alamofire/Alamofire\" \"5.4.4\"\n")
+	defer removeProject(t, project)
+
+	// When
+	_, err := NewDefaultStateProvider("md5").ParseState(project)
+
+	// Then
+	assert.EqualError(t, err, "failed to hash Cartfile.resolved, error: unsupported hash algorithm: md5")
+}
+
+func Test_WhenNormalizeResolvedFileContentCalled_ThenExpectNormalizedContent(t *testing.T) {
+	testScenarios := []struct {
+		content  string
+		expected string
+	}{
+		{"github \"a/a\" \"1.0\"\n", "github \"a/a\" \"1.0\""},
+		{"github \"a/a\" \"1.0\"\r\ngithub \"b/b\" \"2.0\"\r\n", "github \"a/a\" \"1.0\"\ngithub \"b/b\" \"2.0\""},
+		{"github \"a/a\" \"1.0\" \t\ngithub \"b/b\" \"2.0\"  ", "github \"a/a\" \"1.0\"\ngithub \"b/b\" \"2.0\""},
+		{"github \"a/a\" \"1.0\"\r\n\r\n\r\n", "github \"a/a\" \"1.0\""},
+	}
+
+	for _, scenario := range testScenarios {
+		// When
+		actual := normalizeResolvedFileContent(scenario.content)
+
+		// Then
+		assert.Equal(t, scenario.expected, actual)
+	}
+}
+
+// helpers
+func Test_GivenSameProjectsAtDifferentPaths_WhenKeyCalled_ThenExpectSameKey(t *testing.T) {
+	// Given
+	resolved := "github \"Alamofire/Alamofire\" \"5.4.0\"\n"
+	firstProject := givenProjectWithResolvedFile(t, resolved)
+	defer removeProject(t, firstProject)
+	secondProject := givenProjectWithResolvedFile(t, resolved)
+	defer removeProject(t, secondProject)
+	localDependency := func(project Project) string {
+		return fmt.Sprintf("git \"file://%s/Libs/Networking\" \"1.0.0\"\n", filepath.ToSlash(project.projectDir))
+	}
+	require.NoError(t, ioutil.WriteFile(firstProject.resolvedFilePath(), []byte(resolved+localDependency(firstProject)), 0666))
+	require.NoError(t, ioutil.WriteFile(secondProject.resolvedFilePath(), []byte(resolved+localDependency(secondProject)), 0666))
+	require.NotEqual(t, firstProject.projectDir, secondProject.projectDir)
+
+	// When
+	firstKey, err := NewCache(firstProject, "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm)).Key()
+	require.NoError(t, err)
+	secondKey, err := NewCache(secondProject, "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm)).Key()
+	require.NoError(t, err)
+
+	// Then
+	assert.Equal(t, firstKey, secondKey)
+}
+
+func Test_GivenLocalDependencyOutsideProject_WhenPathIndependentResolvedContentCalled_ThenExpectPathKept(t *testing.T) {
+	// Given
+	content := "git \"file:///Users/ci/clone-abc-libs/A\" \"1.0.0\"\ngit \"file:///Users/ci/clone-abc/Libs/B\" \"1.0.0\""
+
+	// When
+	normalized := pathIndependentResolvedContent(content, "/Users/ci/clone-abc")
+
+	// Then
+	assert.Equal(t, "git \"file:///Users/ci/clone-abc-libs/A\" \"1.0.0\"\ngit \"file://$PROJECT_DIR/Libs/B\" \"1.0.0\"", normalized)
+}
+
+func givenProjectWithResolvedFile(t *testing.T, content string) Project {
+	tempDir, err := ioutil.TempDir("", "project")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "Cartfile.resolved"), []byte(content), 0666))
+	return NewProject(tempDir)
+}
+
+func removeProject(t *testing.T, project Project) {
+	require.NoError(t, os.RemoveAll(project.projectDir))
+}
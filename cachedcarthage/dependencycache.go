@@ -0,0 +1,290 @@
+package cachedcarthage
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const toolchainArg = "--toolchain"
+
+// LocalDependencyCache stores the build output of each dependency as a separate archive in a local directory.
+// An archive is addressed by the hash of the dependency's Cartfile.resolved entry, the toolchain, the built platforms
+// and the build settings (the build affecting arguments, the xcconfig and the key files), so it is reused by every branch and dependency set resolving the dependency to the same version,
+// and changing one dependency does not invalidate the others.
+type LocalDependencyCache struct {
+	dir           string
+	project       Project
+	stateProvider ProjectStateProvider
+	swiftVersion  string
+	xcodeVersion  string
+	platformKey   string
+	buildArgs     string
+	xcconfig      string
+	keyFilesHash  string
+}
+
+// NewLocalDependencyCache creates a LocalDependencyCache storing the archives of the project's dependencies in the dir.
+// The resolved dependencies are read with the state provider.
+func NewLocalDependencyCache(dir string, project Project, stateProvider ProjectStateProvider) LocalDependencyCache {
+	return LocalDependencyCache{
+		dir:           dir,
+		project:       project,
+		stateProvider: stateProvider,
+	}
+}
+
+// WithToolchain makes the Swift and Xcode versions part of the dependency archives' keys,
+// as the frameworks built by a different toolchain may not be compatible.
+func (cache LocalDependencyCache) WithToolchain(swiftVersion, xcodeVersion string) LocalDependencyCache {
+	cache.swiftVersion = swiftVersion
+	cache.xcodeVersion = xcodeVersion
+	return cache
+}
+
+// WithPlatformKey makes the built platforms (see PlatformKey) part of the dependency archives' keys,
+// so an archive built for fewer platforms is not restored.
+func (cache LocalDependencyCache) WithPlatformKey(platformKey string) LocalDependencyCache {
+	cache.platformKey = platformKey
+	return cache
+}
+
+// WithBuildArgs makes the build affecting Carthage arguments (`--configuration`, `--toolchain` and `--use-xcframeworks`)
+// part of the dependency archives' keys, as they change the build output.
+func (cache LocalDependencyCache) WithBuildArgs(args []string) LocalDependencyCache {
+	configuration := argValue(args, configurationArg)
+	if configuration == "" {
+		configuration = "Release"
+	}
+
+	cache.buildArgs = fmt.Sprintf("configuration=%s toolchain=%s xcframeworks=%t",
+		configuration, argValue(args, toolchainArg), contains(args, useXCFrameworksArg))
+	return cache
+}
+
+// WithXCConfig makes the xcconfig's content (with its `#include` lines resolved) part of the dependency archives' keys,
+// as its build settings (like BUILD_LIBRARY_FOR_DISTRIBUTION) change the build output.
+func (cache LocalDependencyCache) WithXCConfig(content string) LocalDependencyCache {
+	if content != "" {
+		content = fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	}
+	cache.xcconfig = content
+	return cache
+}
+
+// WithKeyFiles makes the content of the files part of the dependency archives' keys, like Cache.WithKeyFiles.
+func (cache LocalDependencyCache) WithKeyFiles(paths []string) (LocalDependencyCache, error) {
+	if len(paths) == 0 {
+		cache.keyFilesHash = ""
+		return cache, nil
+	}
+
+	hash, err := hashKeyFiles(paths)
+	if err != nil {
+		return cache, err
+	}
+	cache.keyFilesHash = hash
+	return cache, nil
+}
+
+// Restore extracts the archives available for the resolved dependencies into the project dir,
+// and returns the names of the restored and of the missing dependencies, in alphabetical order.
+func (cache LocalDependencyCache) Restore() ([]string, []string, error) {
+	keys, err := cache.dependencyKeys()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var restored, missing []string
+	for _, name := range sortedKeys(keys) {
+		ok, err := cache.archive(keys[name].key).Restore()
+		if err != nil {
+			return restored, nil, fmt.Errorf("failed to restore %s, error: %s", name, err)
+		}
+
+		if ok {
+			restored = append(restored, name)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	return restored, missing, nil
+}
+
+// Save archives the build output of the resolved dependencies without an archive, and returns their names.
+// A dependency is skipped if its version file is missing or built from a different version than the resolved one,
+// as there is no (valid) build output to save.
+func (cache LocalDependencyCache) Save() ([]string, error) {
+	keys, err := cache.dependencyKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []string
+	for _, name := range sortedKeys(keys) {
+		dependency := keys[name]
+		archive := cache.archive(dependency.key)
+		if _, err := archive.ArchiveSize(); err == nil {
+			continue
+		}
+
+		pths, err := cache.project.dependencyBuildPaths(name, dependency.version)
+		if err != nil {
+			log.Warnf("The build output of %s is not saved: %s", name, err)
+			continue
+		}
+
+		archive.IncludePath(pths...)
+		if err := archive.Commit(); err != nil {
+			return saved, fmt.Errorf("failed to save %s, error: %s", name, err)
+		}
+		saved = append(saved, name)
+	}
+	return saved, nil
+}
+
+func (cache LocalDependencyCache) archive(key string) *LocalFileCache {
+	return NewLocalFileCache(cache.dir, key, cache.project.projectDir)
+}
+
+type cachedDependency struct {
+	version string
+	key     string
+}
+
+// dependencyKeys returns the archive keys (like `Alamofire-<sha256>`) and versions of the resolved dependencies by name.
+func (cache LocalDependencyCache) dependencyKeys() (map[string]cachedDependency, error) {
+	state, err := cache.stateProvider.ParseState(cache.project)
+	if err != nil {
+		return nil, err
+	}
+	if !state.resolvedFileExists {
+		return nil, fmt.Errorf("no %s found at: %s", resolvedFileName, cache.project.resolvedFilePath())
+	}
+
+	content := pathIndependentResolvedContent(state.resolvedFileContent, cache.project.projectDir)
+	entries, err := ParseResolved(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]cachedDependency{}
+	for _, entry := range entries {
+		keyContent := fmt.Sprintf("dependency: %s %q %q\nswift: %s\nxcode: %s\nplatforms: %s\nbuild args: %s\nxcconfig: %s\nkey files: %s",
+			entry.Origin, entry.Identifier, entry.Version, cache.swiftVersion, cache.xcodeVersion, cache.platformKey,
+			cache.buildArgs, cache.xcconfig, cache.keyFilesHash)
+		keys[entry.Name()] = cachedDependency{
+			version: entry.Version,
+			key:     NamespacedKey(entry.Name(), fmt.Sprintf("%x", sha256.Sum256([]byte(keyContent)))),
+		}
+	}
+	return keys, nil
+}
+
+// dependencyBuildPaths returns the dependency's version file and the build output listed in it:
+// the XCFrameworks (the container of the platform entries), or the frameworks of the platform dirs with their dSYMs.
+// It fails if the version file is missing or was written for a different version.
+func (project Project) dependencyBuildPaths(name, version string) ([]string, error) {
+	versionFilePath := filepath.Join(project.buildDir(), "."+name+versionFileExtension)
+	if stale, reason := isVersionFileStale(versionFilePath, version); stale {
+		return nil, fmt.Errorf("invalid version file: %s", reason)
+	}
+
+	content, err := os.ReadFile(versionFilePath)
+	if err != nil {
+		return nil, err
+	}
+	var platforms map[string]json.RawMessage
+	if err := json.Unmarshal(content, &platforms); err != nil {
+		return nil, fmt.Errorf("failed to parse version file (%s), error: %s", versionFilePath, err)
+	}
+
+	pths := []string{versionFilePath}
+	var candidates []string
+	for platform, value := range platforms {
+		var frameworks []versionFileFramework
+		if err := json.Unmarshal(value, &frameworks); err != nil {
+			// Not a platform list, like the commitish.
+			continue
+		}
+
+		for _, framework := range frameworks {
+			if framework.Container != "" {
+				candidates = append(candidates, filepath.Join(project.buildDir(), framework.Container))
+				continue
+			}
+
+			platformDir := filepath.Join(project.buildDir(), platform)
+			candidates = append(candidates,
+				filepath.Join(platformDir, framework.Name+".framework"),
+				filepath.Join(platformDir, framework.Name+".framework"+dSYMExtension),
+				filepath.Join(platformDir, "Static", framework.Name+".framework"),
+			)
+		}
+	}
+
+	sort.Strings(candidates)
+	for _, pth := range candidates {
+		if exists, err := pathutil.IsPathExists(pth); err != nil {
+			return nil, err
+		} else if exists && !contains(pths, pth) {
+			pths = append(pths, pth)
+		}
+	}
+	return pths, nil
+}
+
+func sortedKeys(dependencies map[string]cachedDependency) []string {
+	var names []string
+	for name := range dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// restoreDependencies restores the dependencies available in the dependency cache,
+// and returns whether every dependency is restored, or the dependencies to build otherwise.
+// If none is restored, the restore fails or the project's own schemes are built too, every dependency is built.
+func (runner Runner) restoreDependencies() (bool, []string) {
+	log.Infof("Restoring the dependencies from the dependency cache")
+	restored, missing, err := runner.opts.DependencyCache.Restore()
+	if err != nil {
+		log.Warnf("Failed to restore the dependencies: %s", err)
+		return false, nil
+	}
+	if len(restored) == 0 {
+		log.Printf("No dependency found in the dependency cache")
+		return false, nil
+	}
+
+	log.Donef("Restored dependencies: %s", strings.Join(restored, ", "))
+	if len(missing) == 0 {
+		if contains(runner.args, noSkipCurrentArg) {
+			log.Printf("The project's own schemes are built (%s), running the Carthage command for every dependency", noSkipCurrentArg)
+			return false, nil
+		}
+		return true, nil
+	}
+
+	log.Infof("Building only the dependencies missing from the dependency cache: %s", strings.Join(missing, ", "))
+	return false, missing
+}
+
+// saveDependencies saves the built dependencies missing from the dependency cache, failures are only printed as warnings.
+func (runner Runner) saveDependencies() {
+	saved, err := runner.opts.DependencyCache.Save()
+	if err != nil {
+		log.Warnf("Failed to save the dependencies: %s", err)
+	}
+	if len(saved) > 0 {
+		log.Donef("Saved dependencies: %s", strings.Join(saved, ", "))
+	}
+}
@@ -0,0 +1,276 @@
+package cachedcarthage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dependencyCacheResolvedContent = `github "Alamofire/Alamofire" "5.4.4"
+github "onevcat/Kingfisher" "7.1.2"`
+
+func Test_GivenSavedAndMissingDependencies_WhenRestoreCalled_ThenExpectMixedHitAndMiss(t *testing.T) {
+	// Given
+	blobDir := t.TempDir()
+	builtProjectDir := givenDependencyCacheProject(t, dependencyCacheResolvedContent)
+	givenBuiltDependency(t, builtProjectDir, "Alamofire", "5.4.4")
+	saved, err := givenLocalDependencyCache(blobDir, builtProjectDir).Save()
+	require.NoError(t, err)
+	require.Equal(t, []string{"Alamofire"}, saved)
+
+	projectDir := givenDependencyCacheProject(t, dependencyCacheResolvedContent)
+
+	// When
+	restored, missing, err := givenLocalDependencyCache(blobDir, projectDir).Restore()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Alamofire"}, restored)
+	assert.Equal(t, []string{"Kingfisher"}, missing)
+	assert.FileExists(t, filepath.Join(projectDir, "Carthage", "Build", ".Alamofire.version"))
+	assert.FileExists(t, filepath.Join(projectDir, "Carthage", "Build", "iOS", "Alamofire.framework", "Alamofire"))
+	assert.NoFileExists(t, filepath.Join(projectDir, "Carthage", "Build", "iOS", "Kingfisher.framework", "Kingfisher"))
+}
+
+func Test_GivenDependencyBumped_WhenRestoreCalled_ThenExpectOnlyBumpedDependencyMissing(t *testing.T) {
+	// Given
+	blobDir := t.TempDir()
+	builtProjectDir := givenDependencyCacheProject(t, dependencyCacheResolvedContent)
+	givenBuiltDependency(t, builtProjectDir, "Alamofire", "5.4.4")
+	givenBuiltDependency(t, builtProjectDir, "Kingfisher", "7.1.2")
+	_, err := givenLocalDependencyCache(blobDir, builtProjectDir).Save()
+	require.NoError(t, err)
+
+	projectDir := givenDependencyCacheProject(t, `github "Alamofire/Alamofire" "5.4.4"
+github "onevcat/Kingfisher" "7.2.0"`)
+
+	// When
+	restored, missing, err := givenLocalDependencyCache(blobDir, projectDir).Restore()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Alamofire"}, restored)
+	assert.Equal(t, []string{"Kingfisher"}, missing)
+}
+
+func Test_GivenDifferentToolchain_WhenRestoreCalled_ThenExpectEveryDependencyMissing(t *testing.T) {
+	// Given
+	blobDir := t.TempDir()
+	builtProjectDir := givenDependencyCacheProject(t, dependencyCacheResolvedContent)
+	givenBuiltDependency(t, builtProjectDir, "Alamofire", "5.4.4")
+	_, err := givenLocalDependencyCache(blobDir, builtProjectDir).Save()
+	require.NoError(t, err)
+
+	projectDir := givenDependencyCacheProject(t, dependencyCacheResolvedContent)
+	cache := givenLocalDependencyCache(blobDir, projectDir).WithToolchain("5.6", "13.3")
+
+	// When
+	restored, missing, err := cache.Restore()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Empty(t, restored)
+	assert.Equal(t, []string{"Alamofire", "Kingfisher"}, missing)
+}
+
+func Test_GivenStaleAndAlreadySavedDependencies_WhenSaveCalled_ThenExpectOnlyNewValidDependenciesSaved(t *testing.T) {
+	// Given
+	blobDir := t.TempDir()
+	projectDir := givenDependencyCacheProject(t, dependencyCacheResolvedContent)
+	givenBuiltDependency(t, projectDir, "Alamofire", "5.4.4")
+	givenBuiltDependency(t, projectDir, "Kingfisher", "7.0.0")
+	cache := givenLocalDependencyCache(blobDir, projectDir)
+	firstSaved, err := cache.Save()
+	require.NoError(t, err)
+
+	// When
+	secondSaved, err := cache.Save()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Alamofire"}, firstSaved)
+	assert.Empty(t, secondSaved)
+	entries, err := os.ReadDir(blobDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func Test_GivenXCFrameworkDependency_WhenDependencyBuildPathsCalled_ThenExpectContainer(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	buildDir := filepath.Join(projectDir, "Carthage", "Build")
+	givenFileWithSize(t, filepath.Join(buildDir, "Alamofire.xcframework", "Info.plist"), 16)
+	givenFileWithSize(t, filepath.Join(buildDir, "Kingfisher.xcframework", "Info.plist"), 16)
+	require.NoError(t, os.WriteFile(filepath.Join(buildDir, ".Alamofire.version"),
+		[]byte(`{"commitish": "5.4.4", "iOS": [{"name": "Alamofire", "hash": "abc", "container": "Alamofire.xcframework"}]}`), 0644))
+
+	// When
+	pths, err := NewProject(projectDir).dependencyBuildPaths("Alamofire", "5.4.4")
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(buildDir, ".Alamofire.version"), filepath.Join(buildDir, "Alamofire.xcframework")}, pths)
+}
+
+func Test_GivenSomeDependenciesRestored_WhenBootstrapRunCalled_ThenExpectOnlyMissingBuiltAndNewSaved(t *testing.T) {
+	// Given
+	mockDependencyCache := new(MockDependencyCache).
+		GivenRestoreSucceeds([]string{"Alamofire"}, []string{"Kingfisher"}).
+		GivenSaveSucceeds([]string{"Kingfisher"})
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", []CommandBlueprint{{Command: "true"}})
+	runner.args = []string{"--platform", "iOS"}
+	runner.opts = RunnerOpts{ProjectDir: t.TempDir(), DependencyCache: mockDependencyCache}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Contains(t, appendedArgs(runner.commandBuilder.(*MockCommandBuilder)), []string{"--platform", "iOS", "Kingfisher"})
+	mockDependencyCache.AssertCalled(t, "Save")
+}
+
+func Test_GivenEveryDependencyRestored_WhenBootstrapRunCalled_ThenExpectCommandSkippedAndCacheCommitted(t *testing.T) {
+	// Given
+	mockDependencyCache := new(MockDependencyCache).
+		GivenRestoreSucceeds([]string{"Alamofire", "Kingfisher"}, nil).
+		GivenSaveSucceeds(nil)
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", []CommandBlueprint{{Command: "false"}})
+	runner.opts = RunnerOpts{ProjectDir: t.TempDir(), DependencyCache: mockDependencyCache}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+	runner.commandBuilder.(*MockCommandBuilder).AssertNotCalled(t, "Command")
+	runner.cache.(*MockCarthageCache).AssertCalled(t, "Commit")
+}
+
+func Test_GivenNoDependencyRestored_WhenBootstrapRunCalled_ThenExpectEveryDependencyBuilt(t *testing.T) {
+	// Given
+	mockDependencyCache := new(MockDependencyCache).
+		GivenRestoreSucceeds(nil, []string{"Alamofire", "Kingfisher"}).
+		GivenSaveSucceeds([]string{"Alamofire", "Kingfisher"})
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", []CommandBlueprint{{Command: "true"}})
+	runner.args = []string{"--platform", "iOS"}
+	runner.opts = RunnerOpts{ProjectDir: t.TempDir(), DependencyCache: mockDependencyCache}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Contains(t, appendedArgs(runner.commandBuilder.(*MockCommandBuilder)), []string{"--platform", "iOS"})
+}
+
+func givenLocalDependencyCache(blobDir, projectDir string) LocalDependencyCache {
+	return NewLocalDependencyCache(blobDir, NewProject(projectDir), NewDefaultStateProvider(DefaultHashAlgorithm)).
+		WithToolchain("5.5", "13.0").
+		WithPlatformKey("ios")
+}
+
+func givenDependencyCacheProject(t *testing.T, resolvedContent string) string {
+	projectDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(projectDir, "Cartfile.resolved"), []byte(resolvedContent), 0644))
+	return projectDir
+}
+
+// givenBuiltDependency writes the iOS framework, dSYM and version file of the dependency into the project's build dir.
+func givenBuiltDependency(t *testing.T, projectDir, name, version string) {
+	buildDir := filepath.Join(projectDir, "Carthage", "Build")
+	givenFileWithSize(t, filepath.Join(buildDir, "iOS", name+".framework", name), 16)
+	givenFileWithSize(t, filepath.Join(buildDir, "iOS", name+".framework.dSYM", "Contents", "Info.plist"), 16)
+	content := `{"commitish": "` + version + `", "iOS": [{"name": "` + name + `", "hash": "abc"}]}`
+	require.NoError(t, os.WriteFile(filepath.Join(buildDir, "."+name+".version"), []byte(content), 0644))
+}
+
+func Test_GivenEveryDependencyRestoredAndNoSkipCurrent_WhenBootstrapRunCalled_ThenExpectCommandRun(t *testing.T) {
+	// Given
+	mockDependencyCache := new(MockDependencyCache).
+		GivenRestoreSucceeds([]string{"Alamofire"}, nil).
+		GivenSaveSucceeds(nil)
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", []CommandBlueprint{{Command: "true"}})
+	runner.args = []string{"--no-skip-current"}
+	runner.opts = RunnerOpts{ProjectDir: t.TempDir(), DependencyCache: mockDependencyCache}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Contains(t, appendedArgs(runner.commandBuilder.(*MockCommandBuilder)), []string{"--no-skip-current"})
+}
+
+func Test_GivenDifferentBuildSettings_WhenRestoreCalled_ThenExpectEveryDependencyMissing(t *testing.T) {
+	// Given
+	blobDir := t.TempDir()
+	builtProjectDir := givenDependencyCacheProject(t, dependencyCacheResolvedContent)
+	givenBuiltDependency(t, builtProjectDir, "Alamofire", "5.4.4")
+	keyFile := filepath.Join(t.TempDir(), "Brewfile.lock")
+	require.NoError(t, os.WriteFile(keyFile, []byte("carthage 0.39.0"), 0644))
+	builtCache, err := givenLocalDependencyCache(blobDir, builtProjectDir).
+		WithBuildArgs([]string{"--platform", "iOS", "--configuration", "Release", "--use-xcframeworks"}).
+		WithXCConfig("BUILD_LIBRARY_FOR_DISTRIBUTION = YES").
+		WithKeyFiles([]string{keyFile})
+	require.NoError(t, err)
+	_, err = builtCache.Save()
+	require.NoError(t, err)
+
+	projectDir := givenDependencyCacheProject(t, dependencyCacheResolvedContent)
+	cache, err := givenLocalDependencyCache(blobDir, projectDir).
+		WithBuildArgs([]string{"--use-xcframeworks", "--platform", "iOS"}).
+		WithXCConfig("BUILD_LIBRARY_FOR_DISTRIBUTION = YES").
+		WithKeyFiles([]string{keyFile})
+	require.NoError(t, err)
+
+	for name, changed := range map[string]LocalDependencyCache{
+		"configuration": cache.WithBuildArgs([]string{"--use-xcframeworks", "--configuration", "Debug"}),
+		"xcframeworks":  cache.WithBuildArgs(nil),
+		"toolchain":     cache.WithBuildArgs([]string{"--use-xcframeworks", "--toolchain", "swift-5.5"}),
+		"xcconfig":      cache.WithXCConfig("BUILD_LIBRARY_FOR_DISTRIBUTION = NO"),
+		"no xcconfig":   cache.WithXCConfig(""),
+	} {
+		// When
+		restored, missing, err := changed.Restore()
+
+		// Then
+		assert.NoError(t, err, name)
+		assert.Empty(t, restored, name)
+		assert.Equal(t, []string{"Alamofire", "Kingfisher"}, missing, name)
+	}
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("carthage 0.39.1"), 0644))
+	changedKeyFiles, err := cache.WithKeyFiles([]string{keyFile})
+	require.NoError(t, err)
+	restored, _, err := changedKeyFiles.Restore()
+	assert.NoError(t, err)
+	assert.Empty(t, restored)
+}
+
+func Test_GivenSameBuildSettings_WhenRestoreCalled_ThenExpectDependencyRestored(t *testing.T) {
+	// Given
+	blobDir := t.TempDir()
+	builtProjectDir := givenDependencyCacheProject(t, dependencyCacheResolvedContent)
+	givenBuiltDependency(t, builtProjectDir, "Alamofire", "5.4.4")
+	_, err := givenLocalDependencyCache(blobDir, builtProjectDir).
+		WithBuildArgs([]string{"--platform", "iOS", "--configuration", "Release", "--use-xcframeworks"}).
+		WithXCConfig("BUILD_LIBRARY_FOR_DISTRIBUTION = YES").
+		Save()
+	require.NoError(t, err)
+
+	projectDir := givenDependencyCacheProject(t, dependencyCacheResolvedContent)
+	cache := givenLocalDependencyCache(blobDir, projectDir).
+		WithBuildArgs([]string{"--use-xcframeworks", "--cache-builds", "--platform", "iOS"}).
+		WithXCConfig("BUILD_LIBRARY_FOR_DISTRIBUTION = YES")
+
+	// When
+	restored, _, err := cache.Restore()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Alamofire"}, restored)
+}
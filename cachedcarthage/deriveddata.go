@@ -0,0 +1,59 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const (
+	derivedDataArg = "--derived-data"
+	// defaultDerivedDataDir is where Carthage puts the DerivedData, if no `--derived-data` is given.
+	defaultDerivedDataDir = "~/Library/Caches/org.carthage.CarthageKit/DerivedData"
+	// derivedDataSizeWarningLimit is the DerivedData size above which caching it likely costs more than rebuilding.
+	derivedDataSizeWarningLimit = 2 * 1024 * 1024 * 1024
+)
+
+// DerivedDataDir returns the DerivedData dir used by the Carthage command:
+// the `--derived-data` option's value if given, Carthage's default DerivedData dir otherwise.
+func DerivedDataDir(args []string) (string, error) {
+	dir := argValue(args, derivedDataArg)
+	if dir == "" {
+		dir = defaultDerivedDataDir
+	}
+
+	return pathutil.AbsPath(dir)
+}
+
+// WithDerivedDataDir returns a copy of the cache, which caches the given DerivedData dir too,
+// using the Cachefile as indicator, so it is invalidated together with the build dir.
+func (cache Cache) WithDerivedDataDir(dir string) Cache {
+	cache.derivedDataDir = dir
+	return cache
+}
+
+func (cache Cache) includeDerivedDataDir(absCacheFilePth string) {
+	absDerivedDataDir, err := filepath.Abs(cache.derivedDataDir)
+	if err != nil {
+		log.Warnf("Failed to determine absolute DerivedData dir (%s), skipping it: %s", cache.derivedDataDir, err)
+		return
+	}
+	if exists, err := pathutil.IsDirExists(absDerivedDataDir); err != nil || !exists {
+		log.Warnf("No DerivedData dir found at: %s, skipping it", absDerivedDataDir)
+		return
+	}
+
+	size, err := dirSize(absDerivedDataDir)
+	if err != nil {
+		log.Warnf("Failed to calculate size of DerivedData dir (%s), error: %s", absDerivedDataDir, err)
+	} else {
+		log.Infof("Caching %s (%s)", absDerivedDataDir, formatSize(size))
+		if size > derivedDataSizeWarningLimit {
+			log.Warnf("The DerivedData dir is larger than %s, uploading and downloading it may take longer than rebuilding the dependencies", formatSize(derivedDataSizeWarningLimit))
+		}
+	}
+
+	cache.filecache.IncludePath(fmt.Sprintf("%s -> %s", absDerivedDataDir, absCacheFilePth))
+}
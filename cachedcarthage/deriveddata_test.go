@@ -0,0 +1,96 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenDerivedDataArg_WhenDerivedDataDirCalled_ThenExpectArgValue(t *testing.T) {
+	// When
+	dir, err := DerivedDataDir([]string{"--platform", "iOS", "--derived-data", "/tmp/DerivedData"})
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/DerivedData", dir)
+}
+
+func Test_GivenNoDerivedDataArg_WhenDerivedDataDirCalled_ThenExpectCarthageDefault(t *testing.T) {
+	// Given
+	expectedDir, err := pathutil.AbsPath("~/Library/Caches/org.carthage.CarthageKit/DerivedData")
+	require.NoError(t, err)
+
+	// When
+	dir, err := DerivedDataDir([]string{"--platform", "iOS"})
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, expectedDir, dir)
+}
+
+func Test_GivenDerivedDataDir_WhenCommitCalled_ThenExpectDerivedDataIncludedWithCacheFileIndicator(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	projectDir := filepath.Join(tempDir, "project")
+	derivedDataDir := filepath.Join(tempDir, "DerivedData")
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Build", "iOS", "A.framework", "A"), 16)
+	givenFileWithSize(t, filepath.Join(derivedDataDir, "A", "Build", "Intermediates.noindex", "A.o"), 16)
+	cacheFilePth := filepath.Join(projectDir, "Carthage", "Cachefile")
+
+	mockFileCache := givenMockFileCache().
+		GivenIncludeSucceeds().
+		GivenCommitSucceeds()
+	cache := Cache{
+		project:       Project{projectDir: projectDir},
+		swiftVersion:  "whatever",
+		filecache:     mockFileCache,
+		stateProvider: givenMockProjectStateProvider(),
+	}.WithDerivedDataDir(derivedDataDir)
+
+	// When
+	actualError := cache.Commit()
+
+	// Then
+	assert.NoError(t, actualError)
+	mockFileCache.AssertCalled(t, "IncludePath", []string{fmt.Sprintf("%s -> %s", filepath.Join(projectDir, "Carthage"), cacheFilePth)})
+	mockFileCache.AssertCalled(t, "IncludePath", []string{fmt.Sprintf("%s -> %s", derivedDataDir, cacheFilePth)})
+	mockFileCache.AssertNumberOfCalls(t, "IncludePath", 2)
+	mockFileCache.AssertCalled(t, "Commit")
+}
+
+func Test_GivenMissingDerivedDataDir_WhenCommitCalled_ThenExpectDerivedDataSkipped(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "iOS", "A.framework", "A"), 16)
+
+	mockFileCache := givenMockFileCache().
+		GivenIncludeSucceeds().
+		GivenCommitSucceeds()
+	cache := Cache{
+		project:       Project{projectDir: tempDir},
+		swiftVersion:  "whatever",
+		filecache:     mockFileCache,
+		stateProvider: givenMockProjectStateProvider(),
+	}.WithDerivedDataDir(filepath.Join(tempDir, "DerivedData"))
+
+	// When
+	actualError := cache.Commit()
+
+	// Then
+	assert.NoError(t, actualError)
+	mockFileCache.AssertNumberOfCalls(t, "IncludePath", 1)
+	mockFileCache.AssertCalled(t, "Commit")
+}
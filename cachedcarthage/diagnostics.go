@@ -0,0 +1,69 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"strings"
+)
+
+const configurationArg = "--configuration"
+
+// Diagnostics returns the inputs of the cache key, and the ones affecting the build output, as `name: value` lines.
+// The key lines follow the Cachefile content (see createContentOfCacheFile), the key prefix is the namespace
+// of the branch and the `--platform` argument (see KeyPrefix). None of them are secrets.
+func (cache Cache) Diagnostics(carthageVersion string, args []string, branch string) ([]string, error) {
+	state, err := cache.stateProvider.ParseState(cache.project)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := cache.Key()
+	if err != nil {
+		key = fmt.Sprintf("unavailable (%s)", err)
+	}
+
+	platforms := "all"
+	if requested := requestedPlatforms(args); len(requested) > 0 {
+		platforms = strings.Join(requested, ", ")
+	}
+
+	configuration := "Release"
+	if value := argValue(args, configurationArg); value != "" {
+		configuration = value
+	}
+
+	platformKey := PlatformKey(args)
+
+	return []string{
+		fmt.Sprintf("Cache key: %s", key),
+		fmt.Sprintf("Cache key prefix: %s", valueOrNone(KeyPrefix(branch, platformKey))),
+		fmt.Sprintf("Cache branch: %s", valueOrNone(branch)),
+		fmt.Sprintf("Platform key: %s", valueOrNone(platformKey)),
+		fmt.Sprintf("Hash algorithm: %s", algorithmName(cache.hashAlgorithm)),
+		fmt.Sprintf("%s hash: %s", resolvedFileName, valueOrNone(state.resolvedFileHash)),
+		fmt.Sprintf("Swift version: %s", strings.Replace(cache.keySwiftVersion(), "\n", " ", -1)),
+		fmt.Sprintf("Xcode version: %s", valueOrNone(cache.xcodeVersion)),
+		fmt.Sprintf("Step version: %s", valueOrNone(cache.stepVersion)),
+		fmt.Sprintf("No skip current: %t", cache.noSkipCurrent),
+		fmt.Sprintf("Key files hash: %s", valueOrNone(cache.keyFilesHash)),
+		fmt.Sprintf("%s: %s", LibraryEvolutionSetting, valueOrNone(cache.libraryEvolution)),
+		fmt.Sprintf("Carthage version: %s", valueOrNone(carthageVersion)),
+		fmt.Sprintf("Platforms: %s", platforms),
+		fmt.Sprintf("Configuration: %s", configuration),
+	}, nil
+}
+
+func argValue(args []string, arg string) string {
+	for i, a := range args {
+		if a == arg && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
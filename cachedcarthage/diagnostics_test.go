@@ -0,0 +1,89 @@
+package cachedcarthage
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenProject_WhenDiagnosticsCalled_ThenExpectEveryKeyComponent(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, "github \"Alamofire/Alamofire\" \"5.4.0\"\n")
+	defer removeProject(t, project)
+	cache := NewCache(project, "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm)).
+		WithXcodeVersion("13.0").
+		WithStepVersion("4.1.0").
+		WithNoSkipCurrent(true).
+		WithLibraryEvolution("yes").
+		WithHashAlgorithm(SHA512)
+	cache.keyFilesHash = "sha256:abc"
+	state, err := cache.stateProvider.ParseState(project)
+	require.NoError(t, err)
+	key, err := cache.Key()
+	require.NoError(t, err)
+
+	// When
+	lines, err := cache.Diagnostics("0.38.0", []string{"--platform", "iOS,tvOS", "--configuration", "Debug"}, "feature/a")
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"Cache key: " + key,
+		"Cache key prefix: feature-a-ios_tvos-",
+		"Cache branch: feature/a",
+		"Platform key: ios_tvos",
+		"Hash algorithm: sha512",
+		"Cartfile.resolved hash: " + state.resolvedFileHash,
+		"Swift version: 5.3",
+		"Xcode version: 13.0",
+		"Step version: 4.1.0",
+		"No skip current: true",
+		"Key files hash: sha256:abc",
+		"BUILD_LIBRARY_FOR_DISTRIBUTION: YES",
+		"Carthage version: 0.38.0",
+		"Platforms: iOS, tvOS",
+		"Configuration: Debug",
+	}, lines)
+}
+
+func Test_GivenIgnoredSwiftVersion_WhenDiagnosticsCalled_ThenExpectSwiftVersionOfCacheKey(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, "github \"Alamofire/Alamofire\" \"5.4.0\"\n")
+	defer removeProject(t, project)
+	cache := NewCache(project, "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm)).WithoutSwiftVersion()
+
+	// When
+	lines, err := cache.Diagnostics("0.38.0", nil, "master")
+
+	// Then
+	assert.NoError(t, err)
+	assert.Contains(t, lines, "Swift version: ignored")
+	assert.Contains(t, lines, "Cache key prefix: master-")
+	assert.Contains(t, lines, "Platform key: none")
+	assert.Contains(t, lines, "Hash algorithm: sha256")
+}
+
+func Test_GivenNoResolvedFile_WhenDiagnosticsCalled_ThenExpectDefaultsAndKeyUnavailable(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	cache := NewCache(NewProject(tempDir), "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm))
+
+	// When
+	lines, err := cache.Diagnostics("", nil, "")
+
+	// Then
+	assert.NoError(t, err)
+	assert.Contains(t, lines[0], "Cache key: unavailable (no Cartfile.resolved found at: ")
+	assert.Contains(t, lines, "Cache key prefix: none")
+	assert.Contains(t, lines, "Cache branch: none")
+	assert.Contains(t, lines, "Cartfile.resolved hash: none")
+	assert.Contains(t, lines, "Key files hash: none")
+	assert.Contains(t, lines, "BUILD_LIBRARY_FOR_DISTRIBUTION: none")
+	assert.Contains(t, lines, "Platforms: all")
+	assert.Contains(t, lines, "Configuration: Release")
+}
@@ -0,0 +1,11 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package cachedcarthage
+
+import "fmt"
+
+// freeDiskSpace returns the available bytes on the volume containing the given path.
+func freeDiskSpace(pth string) (uint64, error) {
+	return 0, fmt.Errorf("checking free disk space is not supported on this platform")
+}
@@ -0,0 +1,16 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package cachedcarthage
+
+import "syscall"
+
+// freeDiskSpace returns the available bytes on the volume containing the given path.
+func freeDiskSpace(pth string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(pth, &stat); err != nil {
+		return 0, err
+	}
+
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,111 @@
+package cachedcarthage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// DuplicateFrameworksMode defines how the framework names built by more than one dependency are handled.
+type DuplicateFrameworksMode string
+
+// Duplicate frameworks modes.
+const (
+	// DuplicateFrameworksNone skips the check.
+	DuplicateFrameworksNone DuplicateFrameworksMode = "none"
+	// DuplicateFrameworksWarn prints the conflicting dependencies as a warning.
+	DuplicateFrameworksWarn DuplicateFrameworksMode = "warn"
+	// DuplicateFrameworksFail fails the run, before the build dir is cached.
+	DuplicateFrameworksFail DuplicateFrameworksMode = "fail"
+)
+
+// versionFileFramework is a framework entry of a version file's platform list, like:
+// {"commitish": "5.4.4", "iOS": [{"name": "Alamofire", "hash": "..."}]}
+// The container is the XCFramework holding the framework, if built with `--use-xcframeworks`.
+type versionFileFramework struct {
+	Name      string `json:"name"`
+	Container string `json:"container"`
+}
+
+// duplicateFrameworks returns the framework names built by more than one dependency, with the dependencies building them.
+// The frameworks of a dependency are listed in its version file, as a framework of the same name overwrites the other one
+// in the build dir.
+func (project Project) duplicateFrameworks() (map[string][]string, error) {
+	pths, err := project.versionFilePaths()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list version files, error: %s", err)
+	}
+
+	dependenciesByFramework := map[string][]string{}
+	for _, pth := range pths {
+		content, err := os.ReadFile(pth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read version file (%s), error: %s", pth, err)
+		}
+
+		var platforms map[string]json.RawMessage
+		if err := json.Unmarshal(content, &platforms); err != nil {
+			return nil, fmt.Errorf("failed to parse version file (%s), error: %s", pth, err)
+		}
+
+		dependency := versionFileDependencyName(pth)
+		for _, value := range platforms {
+			var frameworks []versionFileFramework
+			if err := json.Unmarshal(value, &frameworks); err != nil {
+				// Not a platform list, like the commitish.
+				continue
+			}
+
+			for _, framework := range frameworks {
+				if framework.Name != "" && !contains(dependenciesByFramework[framework.Name], dependency) {
+					dependenciesByFramework[framework.Name] = append(dependenciesByFramework[framework.Name], dependency)
+				}
+			}
+		}
+	}
+
+	duplicates := map[string][]string{}
+	for name, dependencies := range dependenciesByFramework {
+		if len(dependencies) > 1 {
+			sort.Strings(dependencies)
+			duplicates[name] = dependencies
+		}
+	}
+	return duplicates, nil
+}
+
+// checkDuplicateFrameworks returns the warning printed about the framework names built by more than one dependency,
+// or an error instead in DuplicateFrameworksFail mode. The check is skipped with a warning, if the version files can not be read.
+func (runner Runner) checkDuplicateFrameworks() (string, error) {
+	duplicates, err := Project{projectDir: runner.opts.ProjectDir}.duplicateFrameworks()
+	if err != nil {
+		log.Warnf("Failed to check the duplicate frameworks: %s", err)
+		return "", nil
+	}
+	if len(duplicates) == 0 {
+		return "", nil
+	}
+
+	var names []string
+	for name := range duplicates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var conflicts []string
+	for _, name := range names {
+		conflicts = append(conflicts, fmt.Sprintf("%s (%s)", name, strings.Join(duplicates[name], ", ")))
+	}
+
+	message := fmt.Sprintf("Frameworks with the same name are built by more than one dependency: %s", strings.Join(conflicts, "; "))
+	if runner.opts.DuplicateFrameworksMode == DuplicateFrameworksFail {
+		return "", fmt.Errorf("%s", message)
+	}
+
+	log.Warnf("%s", message)
+	return message, nil
+}
@@ -0,0 +1,82 @@
+package cachedcarthage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenVersionFilesWithDuplicateFramework_WhenDuplicateFrameworksCalled_ThenExpectConflictingDependencies(t *testing.T) {
+	// Given
+	projectDir := givenBuildDirWithVersionFiles(t, map[string]string{
+		"Alamofire":     `{"commitish": "5.4.4", "iOS": [{"name": "Alamofire", "hash": "a"}]}`,
+		"AlamofireFork": `{"commitish": "fix", "iOS": [{"name": "Alamofire", "hash": "b"}], "Mac": [{"name": "Alamofire", "hash": "c"}]}`,
+		"Kingfisher":    `{"commitish": "7.0.0", "iOS": [{"name": "Kingfisher", "hash": "d"}]}`,
+	})
+
+	// When
+	duplicates, err := Project{projectDir: projectDir}.duplicateFrameworks()
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"Alamofire": {"Alamofire", "AlamofireFork"}}, duplicates)
+}
+
+func Test_GivenDuplicateFrameworkAndFailMode_WhenBootstrapRunCalled_ThenExpectValidationErrorAndNoCacheCommit(t *testing.T) {
+	// Given
+	projectDir := givenBuildDirWithVersionFiles(t, map[string]string{
+		"Alamofire":     `{"commitish": "5.4.4", "iOS": [{"name": "Alamofire", "hash": "a"}]}`,
+		"AlamofireFork": `{"commitish": "fix", "iOS": [{"name": "Alamofire", "hash": "b"}]}`,
+	})
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", []CommandBlueprint{{Command: "true"}})
+	runner.opts = RunnerOpts{ProjectDir: projectDir, DuplicateFrameworksMode: DuplicateFrameworksFail}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrValidation))
+	assert.Contains(t, err.Error(), "Frameworks with the same name are built by more than one dependency: Alamofire (Alamofire, AlamofireFork)")
+	runner.cache.(*MockCarthageCache).AssertNotCalled(t, "Commit")
+}
+
+func Test_GivenDuplicateFrameworkAndWarnMode_WhenBootstrapRunCalled_ThenExpectWarningAndCacheCommit(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	projectDir := givenBuildDirWithVersionFiles(t, map[string]string{
+		"Alamofire":     `{"commitish": "5.4.4", "iOS": [{"name": "Alamofire", "hash": "a"}]}`,
+		"AlamofireFork": `{"commitish": "fix", "iOS": [{"name": "Alamofire", "hash": "b"}]}`,
+	})
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", []CommandBlueprint{{Command: "true"}})
+	runner.opts = RunnerOpts{ProjectDir: projectDir, DuplicateFrameworksMode: DuplicateFrameworksWarn}
+
+	// When
+	result, err := runner.RunContext(context.Background())
+
+	// Then
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "Frameworks with the same name are built by more than one dependency: Alamofire (Alamofire, AlamofireFork)")
+	assert.Len(t, result.Warnings, 1)
+	runner.cache.(*MockCarthageCache).AssertCalled(t, "Commit")
+}
+
+func givenBuildDirWithVersionFiles(t *testing.T, versionFiles map[string]string) string {
+	projectDir := t.TempDir()
+	buildDir := filepath.Join(projectDir, "Carthage", "Build")
+	require.NoError(t, os.MkdirAll(buildDir, 0755))
+	for dependency, content := range versionFiles {
+		require.NoError(t, os.WriteFile(filepath.Join(buildDir, "."+dependency+".version"), []byte(content), 0644))
+	}
+	return projectDir
+}
@@ -0,0 +1,24 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+)
+
+const failureLogFileName = "carthage-failure.log"
+
+// writeFailureLog writes the captured output of the failed Carthage command, followed by the error, into the dir.
+func writeFailureLog(dir string, output commandOutput, runErr error) (string, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", fmt.Errorf("failed to create dir (%s), error: %s", dir, err)
+	}
+
+	pth := filepath.Join(dir, failureLogFileName)
+	if err := fileutil.WriteStringToFile(pth, fmt.Sprintf("%s\nError: %s\n", output.all(), runErr)); err != nil {
+		return "", err
+	}
+	return pth, nil
+}
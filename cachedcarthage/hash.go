@@ -0,0 +1,65 @@
+package cachedcarthage
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+)
+
+// HashAlgorithm is the algorithm used for hashing the cache key inputs.
+type HashAlgorithm string
+
+// Supported hash algorithms.
+const (
+	SHA256 HashAlgorithm = "sha256"
+	SHA384 HashAlgorithm = "sha384"
+	SHA512 HashAlgorithm = "sha512"
+)
+
+// DefaultHashAlgorithm ...
+const DefaultHashAlgorithm = SHA256
+
+func newHash(algorithm HashAlgorithm) (hash.Hash, error) {
+	switch algorithm {
+	case SHA256, "":
+		return sha256.New(), nil
+	case SHA384:
+		return sha512.New384(), nil
+	case SHA512:
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+	}
+}
+
+func hashContent(algorithm HashAlgorithm, content string) (string, error) {
+	digest, err := hexDigest(algorithm, content)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s:%s", algorithmName(algorithm), digest), nil
+}
+
+// hexDigest returns the hex encoded digest of the content, without the algorithm name.
+func hexDigest(algorithm HashAlgorithm, content string) (string, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := h.Write([]byte(content)); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func algorithmName(algorithm HashAlgorithm) HashAlgorithm {
+	if algorithm == "" {
+		return DefaultHashAlgorithm
+	}
+	return algorithm
+}
@@ -0,0 +1,213 @@
+package cachedcarthage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// validCachePattern matches the dependencies Carthage did not rebuild, as their `--cache-builds` version file is valid, like:
+// *** Valid cache found for Alamofire, skipping build
+var validCachePattern = regexp.MustCompile(`(?m)^\*\*\* Valid cache found for (.+), skipping build`)
+
+// schemeBuild is a scheme Carthage built, with the time spent on it.
+type schemeBuild struct {
+	scheme   string
+	duration time.Duration
+}
+
+// buildProgressTimer is an io.Writer timing Carthage's `*** Building scheme` progress lines:
+// a scheme is built until the next one starts, or the command exits.
+// It is safe for concurrent use, so the standard output and error of a command can write into it.
+type buildProgressTimer struct {
+	mu      sync.Mutex
+	pending []byte
+	schemes []string
+	starts  []time.Time
+	now     func() time.Time
+}
+
+func newBuildProgressTimer() *buildProgressTimer {
+	return &buildProgressTimer{now: time.Now}
+}
+
+// Write records the start of the schemes of the complete lines written.
+func (timer *buildProgressTimer) Write(p []byte) (int, error) {
+	timer.mu.Lock()
+	defer timer.mu.Unlock()
+
+	timer.pending = append(timer.pending, p...)
+	for {
+		i := bytes.IndexByte(timer.pending, '\n')
+		if i < 0 {
+			break
+		}
+
+		if match := buildingSchemePattern.FindStringSubmatch(string(timer.pending[:i])); match != nil {
+			timer.schemes = append(timer.schemes, match[1])
+			timer.starts = append(timer.starts, timer.now())
+		}
+		timer.pending = timer.pending[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// builds returns the built schemes with their duration, the last one is built until now.
+func (timer *buildProgressTimer) builds() []schemeBuild {
+	timer.mu.Lock()
+	defer timer.mu.Unlock()
+
+	end := timer.now()
+	builds := make([]schemeBuild, len(timer.schemes))
+	for i, scheme := range timer.schemes {
+		finish := end
+		if i+1 < len(timer.starts) {
+			finish = timer.starts[i+1]
+		}
+		builds[i] = schemeBuild{scheme: scheme, duration: finish.Sub(timer.starts[i])}
+	}
+	return builds
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitReport returns the run as a JUnit test suite, with a test case per dependency:
+// the built schemes pass (the last one fails, if the Carthage command failed), the dependencies not built
+// (restored from the cache, having a valid `--cache-builds` version file or no shared schemes) are skipped.
+// A run failing for another reason gets a failed test case of its own.
+func junitReport(result RunResult, runErr error, restored []string) junitTestSuites {
+	className := "carthage." + result.Command
+	suite := junitTestSuite{
+		Name: "carthage " + result.Command,
+		Time: junitSeconds(result.Duration),
+	}
+
+	builds := result.output.schemeBuilds
+	if builds == nil {
+		for _, scheme := range result.BuiltDependencies {
+			builds = append(builds, schemeBuild{scheme: scheme})
+		}
+	}
+
+	var runnerErr *RunnerError
+	commandFailed := errors.As(runErr, &runnerErr)
+	for i, build := range builds {
+		testCase := junitTestCase{Name: build.scheme, ClassName: className, Time: junitSeconds(build.duration)}
+		if commandFailed && i == len(builds)-1 {
+			testCase.Failure = &junitMessage{Message: firstLine(runErr.Error())}
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	if runErr != nil && suite.Failures == 0 {
+		// The run failed outside of building a scheme, like checking out the dependencies or validating the build.
+		suite.TestCases = append(suite.TestCases, junitTestCase{
+			Name: suite.Name, ClassName: className, Time: junitSeconds(result.Duration),
+			Failure: &junitMessage{Message: firstLine(runErr.Error())},
+		})
+		suite.Failures++
+	}
+
+	skip := func(name, reason string) {
+		suite.TestCases = append(suite.TestCases, junitTestCase{Name: name, ClassName: className, Time: junitSeconds(0), Skipped: &junitMessage{Message: reason}})
+		suite.Skipped++
+	}
+	for _, name := range restored {
+		skip(name, "restored from the cache")
+	}
+	for _, match := range validCachePattern.FindAllStringSubmatch(result.output.all(), -1) {
+		skip(match[1], "valid --cache-builds version file found")
+	}
+	for _, name := range parseNoSharedSchemesDependencies(result.output.all()) {
+		skip(name, "no shared framework schemes")
+	}
+
+	suite.Tests = len(suite.TestCases)
+	return junitTestSuites{Suites: []junitTestSuite{suite}}
+}
+
+// restoredDependencies returns the dependencies of the Cartfile.resolved, if the run was served from the cache.
+func (runner Runner) restoredDependencies(result RunResult) []string {
+	if !result.CacheHit {
+		return nil
+	}
+
+	pth := Project{projectDir: runner.opts.ProjectDir}.resolvedFilePath()
+	file, err := os.Open(pth)
+	if err != nil {
+		log.Warnf("Failed to read %s, the restored dependencies are left out of the JUnit report: %s", pth, err)
+		return nil
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %s", pth, err)
+		}
+	}()
+
+	entries, err := ParseResolved(file)
+	if err != nil {
+		log.Warnf("Failed to parse %s, the restored dependencies are left out of the JUnit report: %s", pth, err)
+		return nil
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func writeJUnitReport(pth string, report junitTestSuites) error {
+	content, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(pth), 0777); err != nil {
+		return fmt.Errorf("failed to create dir (%s), error: %s", filepath.Dir(pth), err)
+	}
+	return fileutil.WriteStringToFile(pth, xml.Header+string(content)+"\n")
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func firstLine(s string) string {
+	return strings.SplitN(strings.TrimSpace(s), "\n", 2)[0]
+}
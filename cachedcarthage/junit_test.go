@@ -0,0 +1,130 @@
+package cachedcarthage
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenCannedOutput_WhenJUnitReportWritten_ThenExpectValidJUnitXML(t *testing.T) {
+	// Given
+	result := RunResult{
+		Command:  "bootstrap",
+		Duration: 5 * time.Second,
+		output: commandOutput{
+			stdout: `*** Valid cache found for Kingfisher, skipping build
+*** Building scheme "Alamofire iOS" in Alamofire.xcworkspace
+*** Building scheme "SnapKit iOS" in SnapKit.xcworkspace
+`,
+			stderr:       `Dependency "Legacy" has no shared framework schemes for any of the platforms: iOS`,
+			schemeBuilds: []schemeBuild{{scheme: "Alamofire iOS", duration: 1500 * time.Millisecond}, {scheme: "SnapKit iOS", duration: 2 * time.Second}},
+		},
+	}
+	pth := filepath.Join(t.TempDir(), "reports", "carthage.xml")
+
+	// When
+	err := writeJUnitReport(pth, junitReport(result, nil, nil))
+
+	// Then
+	require.NoError(t, err)
+	content, err := os.ReadFile(pth)
+	require.NoError(t, err)
+	var report junitTestSuites
+	require.NoError(t, xml.Unmarshal(content, &report))
+	require.Len(t, report.Suites, 1)
+	suite := report.Suites[0]
+	assert.Equal(t, "carthage bootstrap", suite.Name)
+	assert.Equal(t, 4, suite.Tests)
+	assert.Equal(t, 0, suite.Failures)
+	assert.Equal(t, 2, suite.Skipped)
+	assert.Equal(t, "5.000", suite.Time)
+	assert.Equal(t, []junitTestCase{
+		{Name: "Alamofire iOS", ClassName: "carthage.bootstrap", Time: "1.500"},
+		{Name: "SnapKit iOS", ClassName: "carthage.bootstrap", Time: "2.000"},
+		{Name: "Kingfisher", ClassName: "carthage.bootstrap", Time: "0.000", Skipped: &junitMessage{Message: "valid --cache-builds version file found"}},
+		{Name: "Legacy", ClassName: "carthage.bootstrap", Time: "0.000", Skipped: &junitMessage{Message: "no shared framework schemes"}},
+	}, suite.TestCases)
+}
+
+func Test_GivenFailedCommand_WhenJUnitReportCalled_ThenExpectLastBuiltSchemeFailed(t *testing.T) {
+	// Given
+	result := RunResult{
+		Command: "bootstrap",
+		output:  commandOutput{schemeBuilds: []schemeBuild{{scheme: "Alamofire iOS"}, {scheme: "SnapKit iOS"}}},
+	}
+	runErr := &RunnerError{Output: "Build Failed", Err: errors.New("Carthage command failed, error: exit status 1")}
+
+	// When
+	report := junitReport(result, runErr, nil)
+
+	// Then
+	suite := report.Suites[0]
+	assert.Equal(t, 1, suite.Failures)
+	assert.Nil(t, suite.TestCases[0].Failure)
+	require.NotNil(t, suite.TestCases[1].Failure)
+	assert.Equal(t, "Carthage command failed, error: exit status 1", suite.TestCases[1].Failure.Message)
+}
+
+func Test_GivenCacheHit_WhenJUnitReportCalled_ThenExpectRestoredDependenciesSkipped(t *testing.T) {
+	// Given
+	result := RunResult{Command: "bootstrap", CacheHit: true}
+
+	// When
+	report := junitReport(result, nil, []string{"Alamofire", "SnapKit"})
+
+	// Then
+	suite := report.Suites[0]
+	assert.Equal(t, 2, suite.Tests)
+	assert.Equal(t, 2, suite.Skipped)
+	assert.Equal(t, "restored from the cache", suite.TestCases[0].Skipped.Message)
+}
+
+func Test_GivenBuildingSchemeLines_WhenBuildProgressTimerWritten_ThenExpectSchemeDurations(t *testing.T) {
+	// Given
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	timer := newBuildProgressTimer()
+	timer.now = func() time.Time { return now }
+
+	// When
+	_, err := timer.Write([]byte("*** Building scheme \"A iOS\" in A.xcodeproj\n*** Building sch"))
+	require.NoError(t, err)
+	now = start.Add(3 * time.Second)
+	_, err = timer.Write([]byte("eme \"B iOS\" in B.xcodeproj\n"))
+	require.NoError(t, err)
+	now = start.Add(4 * time.Second)
+
+	// Then
+	assert.Equal(t, []schemeBuild{{scheme: "A iOS", duration: 3 * time.Second}, {scheme: "B iOS", duration: time.Second}}, timer.builds())
+}
+
+func Test_GivenJUnitReportPath_WhenRunCalled_ThenExpectReportWithBuiltSchemes(t *testing.T) {
+	// Given
+	pth := filepath.Join(t.TempDir(), "carthage.xml")
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "sh",
+			Arguments: []string{"-c", `echo '*** Building scheme "Alamofire iOS" in Alamofire.xcworkspace'`},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("build", blueprints)
+	runner.opts = RunnerOpts{JUnitReportPath: pth}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.NoError(t, err)
+	content, err := os.ReadFile(pth)
+	require.NoError(t, err)
+	var report junitTestSuites
+	require.NoError(t, xml.Unmarshal(content, &report))
+	require.Len(t, report.Suites[0].TestCases, 1)
+	assert.Equal(t, "Alamofire iOS", report.Suites[0].TestCases[0].Name)
+}
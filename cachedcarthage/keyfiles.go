@@ -0,0 +1,44 @@
+package cachedcarthage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+// WithKeyFiles returns a copy of the cache, which keys the cache on the content of the given files too,
+// like a `Package.resolved` of the same project. Every file is expected to exist.
+func (cache Cache) WithKeyFiles(paths []string) (Cache, error) {
+	if len(paths) == 0 {
+		cache.keyFilesHash = ""
+		return cache, nil
+	}
+
+	hash, err := hashKeyFiles(paths)
+	if err != nil {
+		return cache, err
+	}
+
+	cache.keyFilesHash = hash
+	return cache, nil
+}
+
+// hashKeyFiles returns the digest of the files' contents, in the given order.
+// The paths are left out, so the same project cloned to different paths results in the same cache key.
+func hashKeyFiles(paths []string) (string, error) {
+	hash := sha256.New()
+	for _, pth := range paths {
+		content, err := os.ReadFile(pth)
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("cache key file does not exist: %s", pth)
+		} else if err != nil {
+			return "", fmt.Errorf("failed to read cache key file (%s), error: %s", pth, err)
+		}
+
+		fmt.Fprintf(hash, "%d\x00", len(content))
+		hash.Write(content)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
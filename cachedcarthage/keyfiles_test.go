@@ -0,0 +1,89 @@
+package cachedcarthage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenKeyFile_WhenKeyCalled_ThenExpectKeyDependingOnFileContent(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, "github \"Alamofire/Alamofire\" \"5.4.0\"\n")
+	defer removeProject(t, project)
+	packageResolved := filepath.Join(project.projectDir, "Package.resolved")
+	require.NoError(t, fileutil.WriteStringToFile(packageResolved, `{"pins": [{"identity": "swift-log", "state": {"version": "1.4.2"}}]}`))
+	cache := NewCache(project, "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm))
+
+	// When
+	key, err := cache.Key()
+	require.NoError(t, err)
+	keyFilesCache, err := cache.WithKeyFiles([]string{packageResolved})
+	require.NoError(t, err)
+	keyFilesKey, err := keyFilesCache.Key()
+	require.NoError(t, err)
+
+	require.NoError(t, fileutil.WriteStringToFile(packageResolved, `{"pins": [{"identity": "swift-log", "state": {"version": "1.4.3"}}]}`))
+	changedCache, err := cache.WithKeyFiles([]string{packageResolved})
+	require.NoError(t, err)
+	changedKey, err := changedCache.Key()
+	require.NoError(t, err)
+
+	// Then
+	assert.NotEqual(t, key, keyFilesKey)
+	assert.NotEqual(t, keyFilesKey, changedKey)
+}
+
+func Test_GivenMultipleKeyFiles_WhenKeyCalled_ThenExpectKeyDependingOnEveryFile(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, "github \"Alamofire/Alamofire\" \"5.4.0\"\n")
+	defer removeProject(t, project)
+	first := filepath.Join(project.projectDir, "Package.resolved")
+	second := filepath.Join(project.projectDir, "Mintfile")
+	require.NoError(t, fileutil.WriteStringToFile(first, "first"))
+	require.NoError(t, fileutil.WriteStringToFile(second, "second"))
+	cache := NewCache(project, "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm))
+
+	// When
+	keyFilesCache, err := cache.WithKeyFiles([]string{first, second})
+	require.NoError(t, err)
+	key, err := keyFilesCache.Key()
+	require.NoError(t, err)
+
+	require.NoError(t, fileutil.WriteStringToFile(second, "second changed"))
+	changedCache, err := cache.WithKeyFiles([]string{first, second})
+	require.NoError(t, err)
+	changedKey, err := changedCache.Key()
+	require.NoError(t, err)
+
+	// Then
+	assert.NotEqual(t, key, changedKey)
+}
+
+func Test_GivenMissingKeyFile_WhenWithKeyFilesCalled_ThenExpectError(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, "github \"Alamofire/Alamofire\" \"5.4.0\"\n")
+	defer removeProject(t, project)
+	missing := filepath.Join(project.projectDir, "Package.resolved")
+	cache := NewCache(project, "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm))
+
+	// When
+	_, err := cache.WithKeyFiles([]string{missing})
+
+	// Then
+	assert.EqualError(t, err, "cache key file does not exist: "+missing)
+}
+
+func Test_GivenChangedKeyFiles_WhenClassifyCacheMissCalled_ThenExpectKeyFilesChanged(t *testing.T) {
+	// Given
+	cacheFileContent := "--Swift version: 5.3 --Swift version \n --Cartfile.resolved: a --Cartfile.resolved\n --Key files: b --Key files"
+	expectedContent := "--Swift version: 5.3 --Swift version \n --Cartfile.resolved: a --Cartfile.resolved\n --Key files: c --Key files"
+
+	// When
+	reason := classifyCacheMiss(cacheFileContent, expectedContent)
+
+	// Then
+	assert.Equal(t, CacheMissKeyFilesChanged, reason)
+}
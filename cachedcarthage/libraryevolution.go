@@ -0,0 +1,13 @@
+package cachedcarthage
+
+import "strings"
+
+// LibraryEvolutionSetting is the build setting enabling library evolution, frameworks built with and without it are ABI incompatible.
+const LibraryEvolutionSetting = "BUILD_LIBRARY_FOR_DISTRIBUTION"
+
+// WithLibraryEvolution returns a copy of the cache, which keys the cache on the given `BUILD_LIBRARY_FOR_DISTRIBUTION` value too,
+// an empty value (the setting is not set) leaves the cache key unchanged.
+func (cache Cache) WithLibraryEvolution(value string) Cache {
+	cache.libraryEvolution = strings.ToUpper(strings.TrimSpace(value))
+	return cache
+}
@@ -0,0 +1,46 @@
+package cachedcarthage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenLibraryEvolutionOnOffAndUnset_WhenKeyCalled_ThenExpectDistinctKeys(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, "github \"Alamofire/Alamofire\" \"5.4.0\"\n")
+	defer removeProject(t, project)
+	cache := NewCache(project, "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm))
+
+	// When
+	unsetKey, err := cache.WithLibraryEvolution("").Key()
+	require.NoError(t, err)
+	onKey, err := cache.WithLibraryEvolution("YES").Key()
+	require.NoError(t, err)
+	offKey, err := cache.WithLibraryEvolution("NO").Key()
+	require.NoError(t, err)
+	lowercaseOnKey, err := cache.WithLibraryEvolution(" yes ").Key()
+	require.NoError(t, err)
+	defaultKey, err := cache.Key()
+	require.NoError(t, err)
+
+	// Then
+	assert.NotEqual(t, unsetKey, onKey)
+	assert.NotEqual(t, unsetKey, offKey)
+	assert.NotEqual(t, onKey, offKey)
+	assert.Equal(t, onKey, lowercaseOnKey)
+	assert.Equal(t, defaultKey, unsetKey)
+}
+
+func Test_GivenChangedLibraryEvolution_WhenClassifyCacheMissCalled_ThenExpectLibraryEvolutionChanged(t *testing.T) {
+	// Given
+	cacheFileContent := "--Swift version: 5.3 --Swift version \n --Cartfile.resolved: a --Cartfile.resolved"
+	expectedContent := cacheFileContent + "\n --BUILD_LIBRARY_FOR_DISTRIBUTION: YES --BUILD_LIBRARY_FOR_DISTRIBUTION"
+
+	// When
+	reason := classifyCacheMiss(cacheFileContent, expectedContent)
+
+	// Then
+	assert.Equal(t, CacheMissLibraryEvolutionChanged, reason)
+}
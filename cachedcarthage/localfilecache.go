@@ -0,0 +1,459 @@
+package cachedcarthage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+var unsafeKeyCharsPattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+const (
+	archiveExtension = ".tar.gz"
+	// archiveKeyPattern matches the cache key part of the archive names, the hex encoded SHA-256, SHA-384 or SHA-512 digest.
+	archiveKeyPattern = `(?:[0-9a-f]{64}|[0-9a-f]{96}|[0-9a-f]{128})`
+)
+
+// LocalFileCache stores the included paths as an archive in a local (for example network mounted) directory,
+// instead of the Bitrise cache backend.
+type LocalFileCache struct {
+	dir         string
+	key         string
+	restoreKeys []string
+	// restorePrefixes are tried after the restore keys, matching the most recently saved archive.
+	restorePrefixes []string
+	// anyPlatformRestorePrefixes are tried last, matching the most recently saved archive of any platform key.
+	anyPlatformRestorePrefixes []string
+	rootDir                    string
+	// externalDirs are the dirs outside of the root dir, whose absolute archive entries are restored.
+	externalDirs []string
+	paths        []string
+}
+
+// NewLocalFileCache creates a LocalFileCache storing archives under the given key in the dir.
+// Paths inside the rootDir are archived relative to it, so the archive can be restored into a different root.
+func NewLocalFileCache(dir, key, rootDir string) *LocalFileCache {
+	return &LocalFileCache{
+		dir:     dir,
+		key:     key,
+		rootDir: rootDir,
+	}
+}
+
+// WithRestoreKeys sets the keys tried in order, if no archive is stored under the cache key.
+// Commit always stores the archive under the cache key.
+func (cache *LocalFileCache) WithRestoreKeys(keys ...string) *LocalFileCache {
+	cache.restoreKeys = keys
+	return cache
+}
+
+// WithRestorePrefixes sets the key prefixes tried in order, if no archive is stored under the cache key or the restore keys.
+// The most recently saved archive whose key is the prefix followed by a cache key is restored.
+func (cache *LocalFileCache) WithRestorePrefixes(prefixes ...string) *LocalFileCache {
+	cache.restorePrefixes = prefixes
+	return cache
+}
+
+// WithAnyPlatformRestorePrefixes sets the key prefixes tried in order after the restore prefixes.
+// The most recently saved archive whose key is the prefix followed by an optional platform key and a cache key is restored.
+func (cache *LocalFileCache) WithAnyPlatformRestorePrefixes(prefixes ...string) *LocalFileCache {
+	cache.anyPlatformRestorePrefixes = prefixes
+	return cache
+}
+
+// WithExternalDirs sets the dirs outside of the root dir (like the DerivedData dir) allowed to be restored.
+// Archive entries outside of the root dir and these dirs are rejected.
+func (cache *LocalFileCache) WithExternalDirs(dirs ...string) *LocalFileCache {
+	cache.externalDirs = dirs
+	return cache
+}
+
+// NamespacedKey prefixes the key with the namespace (like a branch name), made safe to use in a file name.
+func NamespacedKey(namespace, key string) string {
+	if namespace == "" {
+		return key
+	}
+	return unsafeKeyCharsPattern.ReplaceAllString(namespace, "-") + "-" + key
+}
+
+// KeyPrefix returns the prefix of the cache key namespaced by the branch and the platform key (like `master-ios-`),
+// empty if neither is set.
+func KeyPrefix(branch, platformKey string) string {
+	return NamespacedKey(branch, NamespacedKey(platformKey, ""))
+}
+
+// IncludePath adds the paths to the cache, the Bitrise cache indicator syntax (`path -> indicator`) is accepted.
+func (cache *LocalFileCache) IncludePath(items ...string) {
+	for _, item := range items {
+		cache.paths = append(cache.paths, includedPath(item))
+	}
+}
+
+// includedPath returns the path of an include path item, splitting on the ` -> ` indicator separator first,
+// so a path containing `->` without the surrounding spaces is kept intact.
+func includedPath(item string) string {
+	separator := " -> "
+	if !strings.Contains(item, separator) {
+		separator = "->"
+	}
+	return strings.TrimSpace(strings.Split(item, separator)[0])
+}
+
+// Commit writes the included paths into the archive of the cache key.
+// The archive is streamed into a temporary file next to the final one, file by file,
+// so the memory use does not grow with the size of the cached paths.
+func (cache *LocalFileCache) Commit() error {
+	if cache.key == "" {
+		return fmt.Errorf("no cache key provided")
+	}
+
+	if err := os.MkdirAll(cache.dir, 0777); err != nil {
+		return fmt.Errorf("failed to create local cache dir (%s), error: %s", cache.dir, err)
+	}
+
+	tmpFile, err := ioutil.TempFile(cache.dir, cache.key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create archive, error: %s", err)
+	}
+	defer func() {
+		if err := os.Remove(tmpFile.Name()); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Failed to remove temporary archive (%s), error: %s", tmpFile.Name(), err)
+		}
+	}()
+
+	if err := cache.writeArchive(tmpFile); err != nil {
+		if cerr := tmpFile.Close(); cerr != nil {
+			log.Warnf("Failed to close archive, error: %s", cerr)
+		}
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close archive, error: %s", err)
+	}
+
+	if err := os.Rename(tmpFile.Name(), cache.archivePath(cache.key)); err != nil {
+		return fmt.Errorf("failed to move archive in place, error: %s", err)
+	}
+
+	log.Donef("Cache archive saved: %s", cache.archivePath(cache.key))
+	return nil
+}
+
+// ArchiveSize returns the size of the archive stored under the cache key.
+func (cache *LocalFileCache) ArchiveSize() (int64, error) {
+	info, err := os.Stat(cache.archivePath(cache.key))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Restore extracts the archive of the cache key, if available,
+// falling back to the restore keys and then to the latest archive matching a restore prefix.
+func (cache *LocalFileCache) Restore() (bool, error) {
+	for _, key := range append([]string{cache.key}, cache.restoreKeys...) {
+		restored, err := cache.restore(cache.archivePath(key))
+		if err != nil || restored {
+			return restored, err
+		}
+	}
+
+	prefixes := append(append([]string{}, cache.restorePrefixes...), cache.anyPlatformRestorePrefixes...)
+	for i, prefix := range prefixes {
+		infix := ""
+		if i >= len(cache.restorePrefixes) {
+			infix = platformKeyPattern()
+		}
+
+		pth, err := cache.latestArchivePath(archiveNamePattern(prefix, infix))
+		if err != nil {
+			return false, err
+		}
+		if pth == "" {
+			continue
+		}
+
+		log.Printf("No local cache found for the cache key, restoring the latest archive with the %q prefix: %s", prefix, filepath.Base(pth))
+		return cache.restore(pth)
+	}
+
+	return false, nil
+}
+
+// archiveNamePattern matches the archive names of the prefix, followed by the (regexp) infix and a cache key.
+func archiveNamePattern(prefix, infix string) *regexp.Regexp {
+	return regexp.MustCompile("^" + regexp.QuoteMeta(prefix) + infix + archiveKeyPattern + regexp.QuoteMeta(archiveExtension) + "$")
+}
+
+// platformKeyPattern matches an optional PlatformKey segment with its separator (like `ios_tvos-`).
+func platformKeyPattern() string {
+	var names []string
+	for _, dirName := range platformBuildDirNames {
+		name := regexp.QuoteMeta(strings.ToLower(dirName))
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	name := "(?:" + strings.Join(names, "|") + ")"
+	return "(?:" + name + "(?:_" + name + ")*-)?"
+}
+
+// latestArchivePath returns the most recently saved archive whose name matches the pattern, empty if there is none.
+// The archive of the cache self-test is never matched.
+func (cache *LocalFileCache) latestArchivePath(pattern *regexp.Regexp) (string, error) {
+	entries, err := os.ReadDir(cache.dir)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to list local cache dir (%s), error: %s", cache.dir, err)
+	}
+
+	latestName := ""
+	var latestModTime time.Time
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !pattern.MatchString(name) || name == SelfTestKey+archiveExtension {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return "", err
+		}
+		if latestName == "" || info.ModTime().After(latestModTime) {
+			latestName, latestModTime = name, info.ModTime()
+		}
+	}
+
+	if latestName == "" {
+		return "", nil
+	}
+	return filepath.Join(cache.dir, latestName), nil
+}
+
+func (cache *LocalFileCache) restore(archivePath string) (bool, error) {
+	file, err := os.Open(archivePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to open archive (%s), error: %s", archivePath, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warnf("Failed to close archive, error: %s", err)
+		}
+	}()
+
+	if err := cache.extractArchive(file); err != nil {
+		return false, err
+	}
+
+	log.Donef("Cache archive restored: %s", archivePath)
+	return true, nil
+}
+
+func (cache *LocalFileCache) archivePath(key string) string {
+	return filepath.Join(cache.dir, key+archiveExtension)
+}
+
+// archiveName returns the name of the path inside the archive: relative to the root dir if possible, absolute otherwise.
+func (cache *LocalFileCache) archiveName(pth string) string {
+	if rel, err := filepath.Rel(cache.rootDir, pth); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(pth)
+}
+
+// extractPath returns the path of the archive entry and the dir it is restored into:
+// the root dir for relative entries, the matching external dir for absolute ones.
+func (cache *LocalFileCache) extractPath(name string) (string, string, error) {
+	for _, component := range strings.Split(name, "/") {
+		if component == ".." {
+			return "", "", fmt.Errorf("invalid archive entry: %s", name)
+		}
+	}
+
+	pth := filepath.Clean(filepath.FromSlash(name))
+	if !filepath.IsAbs(pth) {
+		if pth == "." {
+			return "", "", fmt.Errorf("invalid archive entry: %s", name)
+		}
+		return filepath.Join(cache.rootDir, pth), cache.rootDir, nil
+	}
+
+	for _, dir := range cache.externalDirs {
+		if isPathInDir(pth, dir) {
+			return pth, dir, nil
+		}
+	}
+	return "", "", fmt.Errorf("archive entry outside of the project and the cached dirs: %s", name)
+}
+
+// isPathInDir returns true if the path is the dir itself or inside it.
+func isPathInDir(pth, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), pth)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkNoSymlinkParents returns an error if any existing parent of the path below the dir is a symlink,
+// so an archive entry can not be written through a symlink restored (or placed) earlier.
+func checkNoSymlinkParents(pth, dir string) error {
+	dir = filepath.Clean(dir)
+	for parent := filepath.Dir(pth); parent != dir && isPathInDir(parent, dir); parent = filepath.Dir(parent) {
+		info, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("invalid archive entry, its parent is a symlink: %s", parent)
+		}
+	}
+	return nil
+}
+
+func (cache *LocalFileCache) writeArchive(w io.Writer) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, root := range cache.paths {
+		if err := filepath.Walk(root, func(pth string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			link := ""
+			if info.Mode()&os.ModeSymlink != 0 {
+				if link, err = os.Readlink(pth); err != nil {
+					return err
+				}
+			}
+
+			header, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			header.Name = cache.archiveName(pth)
+
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return err
+			}
+
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			return copyFileTo(tarWriter, pth)
+		}); err != nil {
+			return fmt.Errorf("failed to archive (%s), error: %s", root, err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// extractArchive restores the archive entries. The included paths (the entries without a parent in the archive)
+// are removed before they are extracted, so they are replaced, like on a Bitrise cache restore, instead of merged.
+func (cache *LocalFileCache) extractArchive(r io.Reader) error {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to read archive, error: %s", err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	extracted := map[string]bool{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read archive, error: %s", err)
+		}
+
+		pth, dir, err := cache.extractPath(header.Name)
+		if err != nil {
+			return err
+		}
+		if err := checkNoSymlinkParents(pth, dir); err != nil {
+			return err
+		}
+
+		if !extracted[filepath.Dir(pth)] {
+			if err := os.RemoveAll(pth); err != nil {
+				return err
+			}
+		}
+		extracted[pth] = true
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(pth, os.FileMode(header.Mode)); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.RemoveAll(pth); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, pth); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.RemoveAll(pth); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(pth), 0777); err != nil {
+				return err
+			}
+			if err := writeFileFrom(tarReader, pth, os.FileMode(header.Mode)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func copyFileTo(w io.Writer, pth string) error {
+	file, err := os.Open(pth)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warnf("Failed to close file (%s), error: %s", pth, err)
+		}
+	}()
+
+	_, err = io.Copy(w, file)
+	return err
+}
+
+func writeFileFrom(r io.Reader, pth string, mode os.FileMode) error {
+	file, err := os.OpenFile(pth, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		if cerr := file.Close(); cerr != nil {
+			log.Warnf("Failed to close file (%s), error: %s", pth, cerr)
+		}
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,461 @@
+package cachedcarthage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenCommittedCache_WhenRestoreCalled_ThenExpectContentRestored(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	projectDir := filepath.Join(tempDir, "project")
+	cacheDir := filepath.Join(tempDir, "cache")
+	carthageDir := filepath.Join(projectDir, "Carthage")
+	frameworkDir := filepath.Join(carthageDir, "Build", "Mac", "A.framework")
+	require.NoError(t, os.MkdirAll(filepath.Join(frameworkDir, "Versions", "A"), 0777))
+	require.NoError(t, fileutil.WriteStringToFile(filepath.Join(frameworkDir, "Versions", "A", "A"), "binary"))
+	require.NoError(t, os.Symlink("A", filepath.Join(frameworkDir, "Versions", "Current")))
+	require.NoError(t, fileutil.WriteStringToFile(filepath.Join(carthageDir, "Cachefile"), "cachefile"))
+
+	savingCache := NewLocalFileCache(cacheDir, "key", projectDir)
+	savingCache.IncludePath(carthageDir + " -> " + filepath.Join(carthageDir, "Cachefile"))
+	require.NoError(t, savingCache.Commit())
+	require.NoError(t, os.RemoveAll(carthageDir))
+
+	restoringCache := NewLocalFileCache(cacheDir, "key", projectDir)
+
+	// When
+	restored, err := restoringCache.Restore()
+
+	// Then
+	require.NoError(t, err)
+	assert.True(t, restored)
+	assert.FileExists(t, filepath.Join(cacheDir, "key.tar.gz"))
+
+	content, err := fileutil.ReadStringFromFile(filepath.Join(frameworkDir, "Versions", "Current", "A"))
+	require.NoError(t, err)
+	assert.Equal(t, "binary", content)
+
+	link, err := os.Readlink(filepath.Join(frameworkDir, "Versions", "Current"))
+	require.NoError(t, err)
+	assert.Equal(t, "A", link)
+
+	content, err = fileutil.ReadStringFromFile(filepath.Join(carthageDir, "Cachefile"))
+	require.NoError(t, err)
+	assert.Equal(t, "cachefile", content)
+}
+
+func Test_GivenLargeCachedFile_WhenArchiveWritten_ThenExpectArchiveStreamedInChunks(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	binaryPath := filepath.Join(projectDir, "Carthage", "Build", "iOS", "A.framework", "A")
+	require.NoError(t, os.MkdirAll(filepath.Dir(binaryPath), 0777))
+	content := make([]byte, 8*1024*1024)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(binaryPath, content, 0644))
+
+	cache := NewLocalFileCache(t.TempDir(), "key", projectDir)
+	cache.IncludePath(filepath.Join(projectDir, "Carthage"))
+	backend := &chunkRecordingWriter{}
+
+	// When
+	err = cache.writeArchive(backend)
+
+	// Then
+	require.NoError(t, err)
+	assert.Greater(t, backend.total, len(content))
+	assert.Greater(t, backend.writes, 1)
+	assert.LessOrEqual(t, backend.largestWrite, 1024*1024)
+}
+
+// chunkRecordingWriter is a fake cache backend recording how the archive is written into it.
+type chunkRecordingWriter struct {
+	writes       int
+	total        int
+	largestWrite int
+}
+
+func (w *chunkRecordingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	w.total += len(p)
+	if len(p) > w.largestWrite {
+		w.largestWrite = len(p)
+	}
+	return len(p), nil
+}
+
+func Test_GivenNoArchiveForKey_WhenRestoreCalled_ThenExpectNotRestored(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	cache := NewLocalFileCache(tempDir, "missing", filepath.Join(tempDir, "project"))
+
+	// When
+	restored, err := cache.Restore()
+
+	// Then
+	assert.NoError(t, err)
+	assert.False(t, restored)
+}
+
+func Test_GivenNoKey_WhenCommitCalled_ThenExpectError(t *testing.T) {
+	// Given
+	cache := NewLocalFileCache("/cache", "", "/project")
+
+	// When
+	err := cache.Commit()
+
+	// Then
+	assert.EqualError(t, err, "no cache key provided")
+}
+
+func Test_GivenEntryEscapingRoot_WhenExtractPathCalled_ThenExpectError(t *testing.T) {
+	// Given
+	cache := NewLocalFileCache("/cache", "key", "/project")
+
+	// When
+	_, _, err := cache.extractPath("Carthage/../../etc/passwd")
+
+	// Then
+	assert.EqualError(t, err, "invalid archive entry: Carthage/../../etc/passwd")
+}
+
+func Test_GivenAbsoluteEntryOutsideExternalDirs_WhenExtractPathCalled_ThenExpectError(t *testing.T) {
+	// Given
+	cache := NewLocalFileCache("/cache", "key", "/project").WithExternalDirs("/derived-data")
+
+	// When
+	_, _, err := cache.extractPath("/derived-data-other/file")
+
+	// Then
+	assert.EqualError(t, err, "archive entry outside of the project and the cached dirs: /derived-data-other/file")
+}
+
+func Test_GivenAbsoluteEntryInExternalDir_WhenExtractPathCalled_ThenExpectPathInExternalDir(t *testing.T) {
+	// Given
+	cache := NewLocalFileCache("/cache", "key", "/project").WithExternalDirs("/derived-data")
+
+	// When
+	pth, dir, err := cache.extractPath("/derived-data/Build/file")
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, filepath.FromSlash("/derived-data/Build/file"), pth)
+	assert.Equal(t, "/derived-data", dir)
+}
+
+func Test_GivenCommittedExternalDir_WhenRestoreCalled_ThenExpectExternalDirRestored(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	projectDir := filepath.Join(tempDir, "project")
+	cacheDir := filepath.Join(tempDir, "cache")
+	derivedDataDir := filepath.Join(tempDir, "DerivedData")
+	require.NoError(t, os.MkdirAll(derivedDataDir, 0777))
+	require.NoError(t, fileutil.WriteStringToFile(filepath.Join(derivedDataDir, "module"), "module"))
+
+	savingCache := NewLocalFileCache(cacheDir, "key", projectDir)
+	savingCache.IncludePath(derivedDataDir)
+	require.NoError(t, savingCache.Commit())
+	require.NoError(t, os.RemoveAll(derivedDataDir))
+
+	restoringCache := NewLocalFileCache(cacheDir, "key", projectDir).WithExternalDirs(derivedDataDir)
+
+	// When
+	restored, err := restoringCache.Restore()
+
+	// Then
+	require.NoError(t, err)
+	assert.True(t, restored)
+	content, err := fileutil.ReadStringFromFile(filepath.Join(derivedDataDir, "module"))
+	require.NoError(t, err)
+	assert.Equal(t, "module", content)
+}
+
+func Test_GivenArchiveWritingThroughSymlink_WhenRestoreCalled_ThenExpectError(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	projectDir := filepath.Join(tempDir, "project")
+	cacheDir := filepath.Join(tempDir, "cache")
+	outsideDir := filepath.Join(tempDir, "outside")
+	require.NoError(t, os.MkdirAll(outsideDir, 0777))
+	givenArchiveWithEntries(t, filepath.Join(cacheDir, "key"+archiveExtension), []tar.Header{
+		{Name: "Carthage", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "Carthage/Build", Typeflag: tar.TypeSymlink, Linkname: outsideDir},
+		{Name: "Carthage/Build/file", Typeflag: tar.TypeReg, Mode: 0644},
+	})
+
+	cache := NewLocalFileCache(cacheDir, "key", projectDir)
+
+	// When
+	_, err := cache.Restore()
+
+	// Then
+	assert.EqualError(t, err, "invalid archive entry, its parent is a symlink: "+filepath.Join(projectDir, "Carthage", "Build"))
+	assert.NoFileExists(t, filepath.Join(outsideDir, "file"))
+}
+
+func Test_GivenExistingIncludedDir_WhenRestoreCalled_ThenExpectDirReplaced(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	projectDir := filepath.Join(tempDir, "project")
+	cacheDir := filepath.Join(tempDir, "cache")
+	givenCommittedLocalCache(t, cacheDir, "key", projectDir, "cached")
+	staleDir := filepath.Join(projectDir, "Carthage", "Build", "iOS", "Stale.framework")
+	require.NoError(t, os.MkdirAll(staleDir, 0777))
+
+	cache := NewLocalFileCache(cacheDir, "key", projectDir)
+
+	// When
+	restored, err := cache.Restore()
+
+	// Then
+	require.NoError(t, err)
+	assert.True(t, restored)
+	assertRestoredCachefile(t, projectDir, "cached")
+	assert.NoDirExists(t, staleDir)
+}
+
+func Test_GivenArchiveForBranch_WhenRestoreCalled_ThenExpectBranchArchiveRestored(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	projectDir := filepath.Join(tempDir, "project")
+	cacheDir := filepath.Join(tempDir, "cache")
+	givenCommittedLocalCache(t, cacheDir, NamespacedKey("feature/a", "key"), projectDir, "feature")
+	givenCommittedLocalCache(t, cacheDir, NamespacedKey("master", "key"), projectDir, "master")
+
+	cache := NewLocalFileCache(cacheDir, NamespacedKey("feature/a", "key"), projectDir).WithRestoreKeys(NamespacedKey("master", "key"))
+
+	// When
+	restored, err := cache.Restore()
+
+	// Then
+	require.NoError(t, err)
+	assert.True(t, restored)
+	assert.FileExists(t, filepath.Join(cacheDir, "feature-a-key.tar.gz"))
+	content, err := fileutil.ReadStringFromFile(filepath.Join(projectDir, "Carthage", "Cachefile"))
+	require.NoError(t, err)
+	assert.Equal(t, "feature", content)
+}
+
+func Test_GivenArchiveForDefaultBranchOnly_WhenRestoreCalled_ThenExpectDefaultBranchArchiveRestored(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	projectDir := filepath.Join(tempDir, "project")
+	cacheDir := filepath.Join(tempDir, "cache")
+	givenCommittedLocalCache(t, cacheDir, NamespacedKey("master", "key"), projectDir, "master")
+
+	cache := NewLocalFileCache(cacheDir, NamespacedKey("feature/a", "key"), projectDir).WithRestoreKeys(NamespacedKey("master", "key"))
+
+	// When
+	restored, err := cache.Restore()
+
+	// Then
+	require.NoError(t, err)
+	assert.True(t, restored)
+	content, err := fileutil.ReadStringFromFile(filepath.Join(projectDir, "Carthage", "Cachefile"))
+	require.NoError(t, err)
+	assert.Equal(t, "master", content)
+}
+
+func Test_GivenNoArchiveForBranches_WhenRestoreCalled_ThenExpectNotRestored(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	projectDir := filepath.Join(tempDir, "project")
+	cacheDir := filepath.Join(tempDir, "cache")
+	givenCommittedLocalCache(t, cacheDir, NamespacedKey("master", "other-key"), projectDir, "master")
+
+	cache := NewLocalFileCache(cacheDir, NamespacedKey("feature/a", "key"), projectDir).WithRestoreKeys(NamespacedKey("master", "key"))
+
+	// When
+	restored, err := cache.Restore()
+
+	// Then
+	require.NoError(t, err)
+	assert.False(t, restored)
+}
+
+func Test_GivenArchiveForExactKey_WhenRestoreCalledWithPrefixes_ThenExpectExactArchiveRestored(t *testing.T) {
+	// Given
+	projectDir := filepath.Join(t.TempDir(), "project")
+	cacheDir := t.TempDir()
+	givenCommittedLocalCache(t, cacheDir, "master-ios-"+givenArchiveKey("a"), projectDir, "exact")
+	givenCommittedLocalCache(t, cacheDir, "master-ios-"+givenArchiveKey("b"), projectDir, "platform")
+	givenArchiveModTime(t, cacheDir, "master-ios-"+givenArchiveKey("b"), time.Now().Add(time.Hour))
+
+	cache := NewLocalFileCache(cacheDir, "master-ios-"+givenArchiveKey("a"), projectDir).WithRestorePrefixes("master-ios-").WithAnyPlatformRestorePrefixes("master-")
+
+	// When
+	restored, err := cache.Restore()
+
+	// Then
+	require.NoError(t, err)
+	assert.True(t, restored)
+	assertRestoredCachefile(t, projectDir, "exact")
+}
+
+func Test_GivenArchivesForPlatformPrefix_WhenRestoreCalled_ThenExpectLatestPlatformArchiveRestored(t *testing.T) {
+	// Given
+	projectDir := filepath.Join(t.TempDir(), "project")
+	cacheDir := t.TempDir()
+	givenCommittedLocalCache(t, cacheDir, "master-ios-"+givenArchiveKey("c"), projectDir, "old")
+	givenArchiveModTime(t, cacheDir, "master-ios-"+givenArchiveKey("c"), time.Now().Add(-time.Hour))
+	givenCommittedLocalCache(t, cacheDir, "master-ios-"+givenArchiveKey("d"), projectDir, "previous")
+	givenCommittedLocalCache(t, cacheDir, "master-mac-"+givenArchiveKey("e"), projectDir, "mac")
+	givenArchiveModTime(t, cacheDir, "master-mac-"+givenArchiveKey("e"), time.Now().Add(time.Hour))
+
+	cache := NewLocalFileCache(cacheDir, "master-ios-"+givenArchiveKey("a"), projectDir).WithRestorePrefixes("master-ios-").WithAnyPlatformRestorePrefixes("master-")
+
+	// When
+	restored, err := cache.Restore()
+
+	// Then
+	require.NoError(t, err)
+	assert.True(t, restored)
+	assertRestoredCachefile(t, projectDir, "previous")
+	assert.NoFileExists(t, filepath.Join(cacheDir, "master-ios-"+givenArchiveKey("a")+archiveExtension))
+}
+
+func Test_GivenArchiveForPrefixOnly_WhenRestoreCalled_ThenExpectPrefixArchiveRestored(t *testing.T) {
+	// Given
+	projectDir := filepath.Join(t.TempDir(), "project")
+	cacheDir := t.TempDir()
+	givenCommittedLocalCache(t, cacheDir, "master-mac-"+givenArchiveKey("b"), projectDir, "mac")
+	givenCommittedLocalCache(t, cacheDir, "develop-ios-"+givenArchiveKey("b"), projectDir, "develop")
+	givenCommittedLocalCache(t, cacheDir, SelfTestKey, projectDir, "selftest")
+	givenArchiveModTime(t, cacheDir, SelfTestKey, time.Now().Add(time.Hour))
+
+	cache := NewLocalFileCache(cacheDir, "master-ios-"+givenArchiveKey("a"), projectDir).WithRestorePrefixes("master-ios-").WithAnyPlatformRestorePrefixes("master-")
+
+	// When
+	restored, err := cache.Restore()
+
+	// Then
+	require.NoError(t, err)
+	assert.True(t, restored)
+	assertRestoredCachefile(t, projectDir, "mac")
+}
+
+func Test_GivenNoArchiveForPrefixes_WhenRestoreCalled_ThenExpectNotRestored(t *testing.T) {
+	// Given
+	projectDir := filepath.Join(t.TempDir(), "project")
+	cacheDir := t.TempDir()
+	givenCommittedLocalCache(t, cacheDir, "develop-ios-"+givenArchiveKey("a"), projectDir, "develop")
+
+	cache := NewLocalFileCache(cacheDir, "master-ios-"+givenArchiveKey("a"), projectDir).WithRestorePrefixes("master-ios-").WithAnyPlatformRestorePrefixes("master-")
+
+	// When
+	restored, err := cache.Restore()
+
+	// Then
+	require.NoError(t, err)
+	assert.False(t, restored)
+}
+
+func Test_GivenArchiveOfLongerBranchName_WhenRestoreCalled_ThenExpectNotRestored(t *testing.T) {
+	// Given
+	projectDir := filepath.Join(t.TempDir(), "project")
+	cacheDir := t.TempDir()
+	givenCommittedLocalCache(t, cacheDir, "master-foo-"+givenArchiveKey("b"), projectDir, "master-foo")
+	givenCommittedLocalCache(t, cacheDir, "master-ios-foo-"+givenArchiveKey("c"), projectDir, "master-ios-foo")
+
+	cache := NewLocalFileCache(cacheDir, "master-ios-"+givenArchiveKey("a"), projectDir).WithRestorePrefixes("master-ios-").WithAnyPlatformRestorePrefixes("master-")
+
+	// When
+	restored, err := cache.Restore()
+
+	// Then
+	require.NoError(t, err)
+	assert.False(t, restored)
+}
+
+func Test_GivenNamespace_WhenNamespacedKeyCalled_ThenExpectSanitizedPrefix(t *testing.T) {
+	assert.Equal(t, "feature-a_b-key", NamespacedKey("feature/a_b", "key"))
+	assert.Equal(t, "key", NamespacedKey("", "key"))
+}
+
+// givenArchiveWithEntries writes an archive with the given entries, regular files are written empty.
+func givenArchiveWithEntries(t *testing.T, pth string, headers []tar.Header) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0777))
+	file, err := os.Create(pth)
+	require.NoError(t, err)
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, header := range headers {
+		header := header
+		require.NoError(t, tarWriter.WriteHeader(&header))
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	require.NoError(t, file.Close())
+}
+
+// givenArchiveKey returns a cache key like the ones Cache.Key returns, made of the given hex digit.
+func givenArchiveKey(digit string) string {
+	return strings.Repeat(digit, 64)
+}
+
+func givenArchiveModTime(t *testing.T, cacheDir, key string, modTime time.Time) {
+	require.NoError(t, os.Chtimes(filepath.Join(cacheDir, key+archiveExtension), modTime, modTime))
+}
+
+func assertRestoredCachefile(t *testing.T, projectDir, expectedContent string) {
+	content, err := fileutil.ReadStringFromFile(filepath.Join(projectDir, "Carthage", "Cachefile"))
+	require.NoError(t, err)
+	assert.Equal(t, expectedContent, content)
+}
+
+// givenCommittedLocalCache commits a Carthage dir with the given Cachefile content under the key,
+// then removes the Carthage dir from the project.
+func givenCommittedLocalCache(t *testing.T, cacheDir, key, projectDir, cachefileContent string) {
+	carthageDir := filepath.Join(projectDir, "Carthage")
+	require.NoError(t, os.MkdirAll(carthageDir, 0777))
+	require.NoError(t, fileutil.WriteStringToFile(filepath.Join(carthageDir, "Cachefile"), cachefileContent))
+
+	cache := NewLocalFileCache(cacheDir, key, projectDir)
+	cache.IncludePath(carthageDir)
+	require.NoError(t, cache.Commit())
+	require.NoError(t, os.RemoveAll(carthageDir))
+}
@@ -0,0 +1,199 @@
+package cachedcarthage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	redactedSecret = "[REDACTED]"
+	// logStreamQueueSize is the number of chunks waiting for delivery, chunks written while the queue is full are dropped,
+	// so a slow endpoint never blocks the Carthage command.
+	logStreamQueueSize = 256
+	// logStreamRequestTimeout limits each POST request, if the http client has no timeout of its own.
+	logStreamRequestTimeout = 10 * time.Second
+	// logStreamCloseTimeout limits the whole flush on Close, the chunks not delivered by then are dropped.
+	logStreamCloseTimeout = 5 * time.Second
+)
+
+// logStream is an io.Writer POSTing the complete lines written to it to an HTTP endpoint, with the secrets redacted.
+// Delivery is best-effort: failed and dropped chunks are only reported when the stream is closed.
+// It is safe for concurrent use, so the standard output and error of a command can write into the same stream.
+type logStream struct {
+	url          string
+	client       *http.Client
+	replacer     *strings.Replacer
+	closeTimeout time.Duration
+
+	mu      sync.Mutex
+	pending []byte
+	closed  bool
+	dropped int
+
+	chunks chan []byte
+	done   chan struct{}
+	// ctx is cancelled when the flush on Close times out, aborting the delivery of the remaining chunks.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// failed, lastErr and abandoned are only accessed by the sender goroutine, until done is closed.
+	failed    int
+	lastErr   error
+	abandoned int
+}
+
+func newLogStream(url string, client *http.Client, secrets []string) *logStream {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var oldnew []string
+	for _, secret := range secrets {
+		if secret != "" {
+			oldnew = append(oldnew, secret, redactedSecret)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &logStream{
+		url:          url,
+		client:       client,
+		replacer:     strings.NewReplacer(oldnew...),
+		closeTimeout: logStreamCloseTimeout,
+		chunks:       make(chan []byte, logStreamQueueSize),
+		done:         make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+	go stream.send()
+
+	return stream
+}
+
+// Write queues the complete lines of the written data, the rest is kept until the line is completed or the stream is closed.
+func (stream *logStream) Write(p []byte) (int, error) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	if stream.closed {
+		return len(p), nil
+	}
+
+	stream.pending = append(stream.pending, p...)
+	if i := bytes.LastIndexByte(stream.pending, '\n'); i >= 0 {
+		stream.enqueue(stream.pending[:i+1])
+		stream.pending = append([]byte{}, stream.pending[i+1:]...)
+	}
+
+	return len(p), nil
+}
+
+// Close sends the incomplete last line, waits for the queued chunks to be delivered and reports the failed deliveries.
+// The chunks not delivered within the close timeout are dropped.
+func (stream *logStream) Close() error {
+	stream.mu.Lock()
+	if stream.closed {
+		stream.mu.Unlock()
+		return nil
+	}
+	if len(stream.pending) > 0 {
+		stream.enqueue(stream.pending)
+		stream.pending = nil
+	}
+	stream.closed = true
+	close(stream.chunks)
+	stream.mu.Unlock()
+
+	timer := time.NewTimer(stream.closeTimeout)
+	select {
+	case <-stream.done:
+		timer.Stop()
+	case <-timer.C:
+		stream.cancel()
+		<-stream.done
+	}
+	stream.cancel()
+
+	if stream.abandoned > 0 {
+		log.Warnf("Dropped %d chunk(s) of the Carthage output, the log stream was not flushed within %s", stream.abandoned, stream.closeTimeout)
+	}
+	if stream.failed > 0 {
+		log.Warnf("Failed to stream %d chunk(s) of the Carthage output to %s, last error: %s", stream.failed, stream.url, stream.lastErr)
+	}
+	if stream.dropped > 0 {
+		log.Warnf("Dropped %d chunk(s) of the Carthage output, the log stream endpoint was too slow", stream.dropped)
+	}
+
+	return nil
+}
+
+// enqueue expects the lock to be held.
+func (stream *logStream) enqueue(chunk []byte) {
+	select {
+	case stream.chunks <- []byte(stream.replacer.Replace(string(chunk))):
+	default:
+		stream.dropped++
+	}
+}
+
+func (stream *logStream) send() {
+	defer close(stream.done)
+
+	for chunk := range stream.chunks {
+		if stream.ctx.Err() != nil {
+			stream.abandoned++
+			continue
+		}
+		if err := stream.post(chunk); err != nil {
+			if stream.ctx.Err() != nil {
+				stream.abandoned++
+				continue
+			}
+			stream.failed++
+			stream.lastErr = err
+		}
+	}
+}
+
+func (stream *logStream) post(chunk []byte) error {
+	ctx := stream.ctx
+	if stream.client.Timeout == 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, logStreamRequestTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, stream.url, bytes.NewReader(chunk))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := stream.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+			log.Debugf("Failed to read the log stream response, error: %s", err)
+		}
+		if err := resp.Body.Close(); err != nil {
+			log.Debugf("Failed to close the log stream response, error: %s", err)
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
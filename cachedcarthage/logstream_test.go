@@ -0,0 +1,151 @@
+package cachedcarthage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenLogStreamServer_WhenLinesWritten_ThenExpectRedactedChunksPosted(t *testing.T) {
+	// Given
+	server, chunks := givenLogStreamServer(t, http.StatusOK)
+	stream := newLogStream(server.URL, server.Client(), []string{"secret-token", ""})
+
+	// When
+	_, err := stream.Write([]byte("*** Fetching Alamofire\n*** Downloading with secret-token"))
+	require.NoError(t, err)
+	_, err = stream.Write([]byte(" done\n*** Building"))
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+
+	// Then
+	assert.Equal(t, []string{
+		"*** Fetching Alamofire\n",
+		"*** Downloading with [REDACTED] done\n",
+		"*** Building",
+	}, chunks())
+}
+
+func Test_GivenFailingLogStreamServer_WhenClosed_ThenExpectWarningAndNoError(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	server, _ := givenLogStreamServer(t, http.StatusInternalServerError)
+	stream := newLogStream(server.URL, server.Client(), nil)
+
+	// When
+	_, writeErr := stream.Write([]byte("*** Fetching Alamofire\n"))
+	closeErr := stream.Close()
+
+	// Then
+	assert.NoError(t, writeErr)
+	assert.NoError(t, closeErr)
+	assert.Contains(t, logs.String(), "Failed to stream 1 chunk(s) of the Carthage output")
+	assert.Contains(t, logs.String(), "unexpected status: 500 Internal Server Error")
+}
+
+func Test_GivenHangingLogStreamServer_WhenClosed_ThenExpectRemainingChunksDroppedAfterTimeout(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	stream := newLogStream(server.URL, server.Client(), nil)
+	stream.closeTimeout = 100 * time.Millisecond
+	_, err := stream.Write([]byte("*** Fetching Alamofire\n"))
+	require.NoError(t, err)
+	_, err = stream.Write([]byte("*** Building Alamofire\n"))
+	require.NoError(t, err)
+
+	// When
+	start := time.Now()
+	closeErr := stream.Close()
+
+	// Then
+	assert.NoError(t, closeErr)
+	assert.Less(t, time.Since(start), logStreamRequestTimeout)
+	assert.Contains(t, logs.String(), "Dropped 2 chunk(s) of the Carthage output, the log stream was not flushed within 100ms")
+}
+
+func Test_GivenLogStreamURL_WhenRunCalled_ThenExpectOutputStreamedWithTokenRedacted(t *testing.T) {
+	// Given
+	server, chunks := givenLogStreamServer(t, http.StatusOK)
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "sh",
+			Arguments: []string{"-c", "echo '*** Fetching Alamofire'; echo 'using ghp_token' >&2"},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", blueprints)
+	runner.githubAccessToken = "ghp_token"
+	runner.opts = RunnerOpts{LogStreamURL: server.URL, LogStreamClient: server.Client()}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+	streamed := strings.Join(chunks(), "")
+	assert.Contains(t, streamed, "*** Fetching Alamofire\n")
+	assert.Contains(t, streamed, "using [REDACTED]\n")
+	assert.NotContains(t, streamed, "ghp_token")
+}
+
+func Test_GivenUnreachableLogStreamURL_WhenRunCalled_ThenExpectRunSucceeds(t *testing.T) {
+	// Given
+	server, _ := givenLogStreamServer(t, http.StatusOK)
+	server.Close()
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", []CommandBlueprint{{Command: "echo", Arguments: []string{"*** Fetching Alamofire"}}})
+	runner.opts = RunnerOpts{LogStreamURL: server.URL}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func givenLogStreamServer(t *testing.T, status int) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var chunks []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		mu.Lock()
+		chunks = append(chunks, string(body))
+		mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, chunks...)
+	}
+}
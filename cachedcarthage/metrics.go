@@ -0,0 +1,61 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// metric is a gauge of the Prometheus text exposition format.
+type metric struct {
+	name  string
+	help  string
+	value string
+}
+
+// metrics returns the run's metrics in the Prometheus text exposition format, labelled with the Carthage command.
+func metrics(result RunResult) string {
+	cacheHit := "0"
+	if result.CacheHit {
+		cacheHit = "1"
+	}
+
+	gauges := []metric{
+		{name: "carthage_step_build_duration_seconds", help: "Duration of the Carthage run.", value: fmt.Sprintf("%.3f", result.Duration.Seconds())},
+		{name: "carthage_step_cache_hit", help: "Whether the Carthage cache was used (1) or not (0).", value: cacheHit},
+		{name: "carthage_step_rebuilt_dependencies", help: "Number of schemes built by Carthage.", value: fmt.Sprintf("%d", len(result.BuiltDependencies))},
+		{name: "carthage_step_cache_size_bytes", help: "Size of the saved Carthage cache, 0 if the cache was not saved.", value: fmt.Sprintf("%d", result.CacheSize)},
+	}
+
+	label := fmt.Sprintf(`{command="%s"}`, strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(result.Command))
+
+	var lines []string
+	for _, gauge := range gauges {
+		lines = append(lines,
+			fmt.Sprintf("# HELP %s %s", gauge.name, gauge.help),
+			fmt.Sprintf("# TYPE %s gauge", gauge.name),
+			gauge.name+label+" "+gauge.value,
+		)
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// writeMetrics writes the content via a temporary file in the same dir,
+// so a textfile collector never reads a partially written file.
+func writeMetrics(pth, content string) error {
+	if err := os.MkdirAll(filepath.Dir(pth), 0777); err != nil {
+		return fmt.Errorf("failed to create dir (%s), error: %s", filepath.Dir(pth), err)
+	}
+
+	tmpPath := pth + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s, error: %s", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, pth); err != nil {
+		return fmt.Errorf("failed to move %s to %s, error: %s", tmpPath, pth, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package cachedcarthage
+
+import "regexp"
+
+// CacheMissReason describes why the cache could not be used.
+type CacheMissReason string
+
+// CacheMissReasons ...
+const (
+	CacheMissNoPriorEntry            CacheMissReason = "no_prior_entry"
+	CacheMissResolvedChanged         CacheMissReason = "resolved_changed"
+	CacheMissSwiftChanged            CacheMissReason = "swift_changed"
+	CacheMissXcodeChanged            CacheMissReason = "xcode_changed"
+	CacheMissKeyFilesChanged         CacheMissReason = "key_files_changed"
+	CacheMissLibraryEvolutionChanged CacheMissReason = "library_evolution_changed"
+	CacheMissForced                  CacheMissReason = "forced"
+)
+
+var (
+	cacheFileResolvedPattern         = regexp.MustCompile(`(?s)--` + regexp.QuoteMeta(resolvedFileName) + `: (.*?) --` + regexp.QuoteMeta(resolvedFileName))
+	cacheFileSwiftPattern            = regexp.MustCompile(`(?s)--Swift version: (.*?) --Swift version`)
+	cacheFileXcodePattern            = regexp.MustCompile(`(?s)--Xcode version: (.*?) --Xcode version`)
+	cacheFileKeyFilesPattern         = regexp.MustCompile(`(?s)--Key files: (.*?) --Key files`)
+	cacheFileLibraryEvolutionPattern = regexp.MustCompile(`(?s)--` + LibraryEvolutionSetting + `: (.*?) --` + LibraryEvolutionSetting)
+)
+
+// classifyCacheMiss compares the Cachefile's fields with the expected ones,
+// any other difference (like a changed Step version) is reported as forced.
+func classifyCacheMiss(cacheFileContent, expectedContent string) CacheMissReason {
+	fields := []struct {
+		pattern *regexp.Regexp
+		reason  CacheMissReason
+	}{
+		{cacheFileResolvedPattern, CacheMissResolvedChanged},
+		{cacheFileSwiftPattern, CacheMissSwiftChanged},
+		{cacheFileXcodePattern, CacheMissXcodeChanged},
+		{cacheFileKeyFilesPattern, CacheMissKeyFilesChanged},
+		{cacheFileLibraryEvolutionPattern, CacheMissLibraryEvolutionChanged},
+	}
+
+	for _, field := range fields {
+		if cacheFileField(field.pattern, cacheFileContent) != cacheFileField(field.pattern, expectedContent) {
+			return field.reason
+		}
+	}
+
+	return CacheMissForced
+}
+
+func cacheFileField(pattern *regexp.Regexp, content string) string {
+	match := pattern.FindStringSubmatch(content)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
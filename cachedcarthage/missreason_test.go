@@ -0,0 +1,106 @@
+package cachedcarthage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenNoCacheFile_WhenMissReasonCalled_ThenExpectNoPriorEntry(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, "github \"Alamofire/Alamofire\" \"5.4.0\"\n")
+	defer removeProject(t, project)
+	givenFileWithSize(t, filepath.Join(project.buildDir(), "iOS", "A.framework", "A"), 16)
+	cache := NewCache(project, "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm))
+
+	// When
+	reason, err := cache.MissReason()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, CacheMissNoPriorEntry, reason)
+}
+
+func Test_GivenChangedInputs_WhenMissReasonCalled_ThenExpectClassifiedReason(t *testing.T) {
+	resolved := "github \"Alamofire/Alamofire\" \"5.4.0\"\n"
+	base := func(project Project) Cache {
+		return NewCache(project, "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm)).
+			WithXcodeVersion("13.0")
+	}
+
+	tests := []struct {
+		name           string
+		changedCache   func(project Project) Cache
+		changedContent string
+		want           CacheMissReason
+	}{
+		{
+			name:           "resolved changed",
+			changedCache:   base,
+			changedContent: "github \"Alamofire/Alamofire\" \"5.5.0\"\n",
+			want:           CacheMissResolvedChanged,
+		},
+		{
+			name: "swift changed",
+			changedCache: func(project Project) Cache {
+				return NewCache(project, "5.5", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm)).
+					WithXcodeVersion("13.0")
+			},
+			want: CacheMissSwiftChanged,
+		},
+		{
+			name: "xcode changed",
+			changedCache: func(project Project) Cache {
+				return base(project).WithXcodeVersion("13.1")
+			},
+			want: CacheMissXcodeChanged,
+		},
+		{
+			name: "forced",
+			changedCache: func(project Project) Cache {
+				return base(project).WithStepVersion("4.2.0")
+			},
+			want: CacheMissForced,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			project := givenProjectWithResolvedFile(t, resolved)
+			defer removeProject(t, project)
+			givenFileWithSize(t, filepath.Join(project.buildDir(), "iOS", "A.framework", "A"), 16)
+			require.NoError(t, base(project).CreateIndicator())
+			if tt.changedContent != "" {
+				require.NoError(t, fileutil.WriteStringToFile(project.resolvedFilePath(), tt.changedContent))
+			}
+			cache := tt.changedCache(project)
+
+			// When
+			reason, err := cache.MissReason()
+
+			// Then
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, reason)
+		})
+	}
+}
+
+func Test_GivenNoBuildDir_WhenMissReasonCalled_ThenExpectNoPriorEntry(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, "github \"Alamofire/Alamofire\" \"5.4.0\"\n")
+	defer removeProject(t, project)
+	cache := NewCache(project, "5.3", givenMockFileCache(), NewDefaultStateProvider(DefaultHashAlgorithm))
+	require.NoError(t, cache.CreateIndicator())
+	require.NoError(t, os.RemoveAll(project.buildDir()))
+
+	// When
+	reason, err := cache.MissReason()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, CacheMissNoPriorEntry, reason)
+}
@@ -7,6 +7,12 @@ type MockCarthageCache struct {
 	mock.Mock
 }
 
+// CheckoutsRestored provides a mock function with given fields:
+func (m *MockCarthageCache) CheckoutsRestored() (bool, error) {
+	args := m.Called()
+	return args.Bool(0), args.Error(1)
+}
+
 // Commit provides a mock function with given fields:
 func (m *MockCarthageCache) Commit() error {
 	args := m.Called()
@@ -19,6 +25,49 @@ func (m *MockCarthageCache) CreateIndicator() error {
 	return args.Error(0)
 }
 
+// Invalidate provides a mock function with given fields:
+func (m *MockCarthageCache) Invalidate() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// IsRestored provides a mock function with given fields:
+func (m *MockCarthageCache) IsRestored() (bool, error) {
+	args := m.Called()
+	return args.Bool(0), args.Error(1)
+}
+
+// ReconcileVersionFiles provides a mock function with given fields: mode
+func (m *MockCarthageCache) ReconcileVersionFiles(mode VersionFileReconcileMode) error {
+	args := m.Called(mode)
+	return args.Error(0)
+}
+
+// SavedSize provides a mock function with given fields:
+func (m *MockCarthageCache) SavedSize() (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// MakeBuildDirWritable provides a mock function with given fields:
+func (m *MockCarthageCache) MakeBuildDirWritable() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// MissingPlatforms provides a mock function with given fields: platforms
+func (m *MockCarthageCache) MissingPlatforms(platforms []string) ([]string, error) {
+	args := m.Called(platforms)
+	missing, _ := args.Get(0).([]string)
+	return missing, args.Error(1)
+}
+
+// MissReason provides a mock function with given fields:
+func (m *MockCarthageCache) MissReason() (CacheMissReason, error) {
+	args := m.Called()
+	return args.Get(0).(CacheMissReason), args.Error(1)
+}
+
 // IsAvailable provides a mock function with given fields:
 func (m *MockCarthageCache) IsAvailable() (bool, error) {
 	args := m.Called()
@@ -54,3 +103,43 @@ func (m *MockCarthageCache) GivenCreateIndicatorSucceeds() *MockCarthageCache {
 	m.On("CreateIndicator").Return(nil)
 	return m
 }
+
+func (m *MockCarthageCache) GivenInvalidateSucceeds() *MockCarthageCache {
+	m.On("Invalidate").Return(nil)
+	return m
+}
+
+func (m *MockCarthageCache) GivenIsRestoredSucceeds(result bool) *MockCarthageCache {
+	m.On("IsRestored").Return(result, nil)
+	return m
+}
+
+func (m *MockCarthageCache) GivenReconcileVersionFilesSucceeds() *MockCarthageCache {
+	m.On("ReconcileVersionFiles", mock.Anything).Return(nil)
+	return m
+}
+
+func (m *MockCarthageCache) GivenSavedSizeSucceeds(size int64) *MockCarthageCache {
+	m.On("SavedSize").Return(size, nil)
+	return m
+}
+
+func (m *MockCarthageCache) GivenMakeBuildDirWritableSucceeds() *MockCarthageCache {
+	m.On("MakeBuildDirWritable").Return(nil)
+	return m
+}
+
+func (m *MockCarthageCache) GivenMissingPlatformsSucceeds(missing []string) *MockCarthageCache {
+	m.On("MissingPlatforms", mock.Anything).Return(missing, nil)
+	return m
+}
+
+func (m *MockCarthageCache) GivenMissReasonSucceeds(reason CacheMissReason) *MockCarthageCache {
+	m.On("MissReason").Return(reason, nil)
+	return m
+}
+
+func (m *MockCarthageCache) GivenCheckoutsRestoredSucceeds(result bool) *MockCarthageCache {
+	m.On("CheckoutsRestored").Return(result, nil)
+	return m
+}
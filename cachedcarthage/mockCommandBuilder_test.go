@@ -1,19 +1,56 @@
 package cachedcarthage
 
 import (
-	"github.com/bitrise-io/go-utils/env"
-	"github.com/stretchr/testify/mock"
+	"context"
 	"io"
+	"os"
+	"os/exec"
+	"strings"
 
 	"github.com/bitrise-io/go-steputils/stepconf"
 	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/env"
+	"github.com/stretchr/testify/mock"
 )
 
 type CommandBlueprint struct {
-	Command string
+	Command   string
 	Arguments []string
 }
 
+// contextCommand is a command.Command which is killed when its context is done.
+type contextCommand struct {
+	cmd *exec.Cmd
+}
+
+func newContextCommand(ctx context.Context, blueprint CommandBlueprint, stdout io.Writer, stderr io.Writer) contextCommand {
+	cmd := exec.CommandContext(ctx, blueprint.Command, blueprint.Arguments...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return contextCommand{cmd}
+}
+
+func (c contextCommand) PrintableCommandArgs() string { return strings.Join(c.cmd.Args, " ") }
+func (c contextCommand) Run() error                   { return c.cmd.Run() }
+func (c contextCommand) Start() error                 { return c.cmd.Start() }
+func (c contextCommand) Wait() error                  { return c.cmd.Wait() }
+func (c contextCommand) Process() *os.Process         { return c.cmd.Process }
+
+func (c contextCommand) RunAndReturnExitCode() (int, error) {
+	err := c.cmd.Run()
+	return c.cmd.ProcessState.ExitCode(), err
+}
+
+func (c contextCommand) RunAndReturnTrimmedOutput() (string, error) {
+	out, err := c.cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func (c contextCommand) RunAndReturnTrimmedCombinedOutput() (string, error) {
+	out, err := c.cmd.CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
 // MockCommandBuilder is an autogenerated mock type for the CommandBuilder type
 type MockCommandBuilder struct {
 	mock.Mock
@@ -31,15 +68,21 @@ func (m *MockCommandBuilder) AddXCConfigFile(path string) CommandBuilder {
 	return args.Get(0).(CommandBuilder)
 }
 
+// AddEnv provides a mock function with given fields: key, value
+func (m *MockCommandBuilder) AddEnv(key, value string) CommandBuilder {
+	args := m.Called(key, value)
+	return args.Get(0).(CommandBuilder)
+}
+
 // Append provides a mock function with given fields: args
 func (m *MockCommandBuilder) Append(args ...string) CommandBuilder {
 	ret := m.Called(args)
 	return ret.Get(0).(CommandBuilder)
 }
 
-// Command provides a mock function with given fields:
-func (m *MockCommandBuilder) Command(stdout io.Writer, stderr io.Writer) command.Command {
-	args := m.Called(stdout, stderr)
+// Command provides a mock function with given fields: ctx, stdout, stderr
+func (m *MockCommandBuilder) Command(ctx context.Context, stdout io.Writer, stderr io.Writer) command.Command {
+	args := m.Called(ctx, stdout, stderr)
 	return args.Get(0).(command.Command)
 }
 
@@ -53,6 +96,11 @@ func (m *MockCommandBuilder) GivenAddXCConfigFileSucceeds() *MockCommandBuilder
 	return m
 }
 
+func (m *MockCommandBuilder) GivenAddEnvSucceeds() *MockCommandBuilder {
+	m.On("AddEnv", mock.Anything, mock.Anything).Return(m)
+	return m
+}
+
 func (m *MockCommandBuilder) GivenAppendSucceeds() *MockCommandBuilder {
 	m.On("Append", mock.Anything).Return(m)
 	return m
@@ -61,20 +109,17 @@ func (m *MockCommandBuilder) GivenAppendSucceeds() *MockCommandBuilder {
 func (m *MockCommandBuilder) GivenCommandReturned(blueprint CommandBlueprint) *MockCommandBuilder {
 	command := command.NewFactory(env.NewRepository()).Create(blueprint.Command, blueprint.Arguments, nil)
 
-	m.On("Command", mock.Anything, mock.Anything).Return(command)
+	m.On("Command", mock.Anything, mock.Anything, mock.Anything).Return(command)
 	return m
 }
 
 func (m *MockCommandBuilder) GivenCommandsReturned(commandBlueprints []CommandBlueprint) *MockCommandBuilder {
 	index := 0
 
-	call := m.On("Command", mock.Anything, mock.Anything)
+	call := m.On("Command", mock.Anything, mock.Anything, mock.Anything)
 	call.RunFn = func(args mock.Arguments) {
 		blueprint := commandBlueprints[index]
-		command := command.NewFactory(env.NewRepository()).Create(blueprint.Command, blueprint.Arguments, &command.Opts{
-			Stdout: args[0].(io.Writer),
-			Stderr: args[1].(io.Writer),
-		})
+		command := newContextCommand(args[0].(context.Context), blueprint, args[1].(io.Writer), args[2].(io.Writer))
 		call.ReturnArguments = mock.Arguments{command, nil}
 
 		index++
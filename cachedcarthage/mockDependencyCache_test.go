@@ -0,0 +1,45 @@
+package cachedcarthage
+
+import mock "github.com/stretchr/testify/mock"
+
+// MockDependencyCache is an autogenerated mock type for the DependencyCache type
+type MockDependencyCache struct {
+	mock.Mock
+}
+
+// Restore provides a mock function with given fields:
+func (m *MockDependencyCache) Restore() ([]string, []string, error) {
+	ret := m.Called()
+
+	var r0, r1 []string
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]string)
+	}
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).([]string)
+	}
+
+	return r0, r1, ret.Error(2)
+}
+
+// Save provides a mock function with given fields:
+func (m *MockDependencyCache) Save() ([]string, error) {
+	ret := m.Called()
+
+	var r0 []string
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]string)
+	}
+
+	return r0, ret.Error(1)
+}
+
+func (m *MockDependencyCache) GivenRestoreSucceeds(restored, missing []string) *MockDependencyCache {
+	m.On("Restore").Return(restored, missing, nil)
+	return m
+}
+
+func (m *MockDependencyCache) GivenSaveSucceeds(saved []string) *MockDependencyCache {
+	m.On("Save").Return(saved, nil)
+	return m
+}
@@ -40,3 +40,19 @@ func (m *MockFileCache) GivenCommitSucceeds() *MockFileCache {
 	m.On("Commit").Return(nil)
 	return m
 }
+
+// Restore provides a mock function with given fields:
+func (m *MockFileCache) Restore() (bool, error) {
+	ret := m.Called()
+
+	if rf, ok := ret.Get(0).(func() (bool, error)); ok {
+		return rf()
+	}
+
+	return ret.Bool(0), ret.Error(1)
+}
+
+func (m *MockFileCache) GivenRestoreSucceeds(restored bool) *MockFileCache {
+	m.On("Restore").Return(restored, nil)
+	return m
+}
@@ -0,0 +1,36 @@
+package cachedcarthage
+
+import "github.com/bitrise-io/go-utils/log"
+
+const (
+	// openFilesFallbackLimit is the soft open files limit applied if the hard limit is rejected, OPEN_MAX on macOS.
+	openFilesFallbackLimit = 10240
+	// recommendedOpenFilesLimit is the open files limit below which large dependency graphs may fail with "too many open files".
+	recommendedOpenFilesLimit = 4096
+)
+
+// applyOpenFilesLimit raises the open files limit inherited by the Carthage command and returns a function restoring it.
+// Failures are only printed as warnings, the command is run with the original limit then.
+func (runner Runner) applyOpenFilesLimit() func() {
+	raise := runner.raiseOpenFilesLimit
+	if raise == nil {
+		raise = raiseOpenFilesLimit
+	}
+
+	limit, hardLimit, restore, err := raise()
+	if err != nil {
+		log.Warnf("Failed to raise the open files limit, error: %s", err)
+		return func() {}
+	}
+
+	log.Printf("Open files limit: %d", limit)
+	if hardLimit < recommendedOpenFilesLimit {
+		log.Warnf("The hard open files limit (%d) is lower than %d, Carthage may fail with \"too many open files\"", hardLimit, recommendedOpenFilesLimit)
+	}
+
+	return func() {
+		if err := restore(); err != nil {
+			log.Warnf("Failed to restore the open files limit, error: %s", err)
+		}
+	}
+}
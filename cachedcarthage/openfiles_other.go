@@ -0,0 +1,13 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package cachedcarthage
+
+import "fmt"
+
+// raiseOpenFilesLimit raises the soft open files limit (RLIMIT_NOFILE) of the process up to the hard limit,
+// so the commands started afterwards inherit it. It returns the applied limit, the hard limit and
+// a function restoring the original limit.
+func raiseOpenFilesLimit() (uint64, uint64, func() error, error) {
+	return 0, 0, nil, fmt.Errorf("raising the open files limit is not supported on this platform")
+}
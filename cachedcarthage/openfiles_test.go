@@ -0,0 +1,37 @@
+package cachedcarthage
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenLowHardOpenFilesLimit_WhenRunCalledWithRaiseOpenFilesLimit_ThenExpectWarning(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	restored := false
+	runner := givenRunnerWithMainAndCommandBuilderCommands("build", []CommandBlueprint{{Command: "true"}})
+	runner.opts = RunnerOpts{RaiseOpenFilesLimit: true}
+	runner.raiseOpenFilesLimit = func() (uint64, uint64, func() error, error) {
+		return 1024, 1024, func() error {
+			restored = true
+			return nil
+		}, nil
+	}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "Open files limit: 1024")
+	assert.Contains(t, logs.String(), "The hard open files limit (1024) is lower than 4096")
+	assert.True(t, restored)
+}
@@ -0,0 +1,40 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package cachedcarthage
+
+import (
+	"errors"
+	"syscall"
+)
+
+// raiseOpenFilesLimit raises the soft open files limit (RLIMIT_NOFILE) of the process up to the hard limit,
+// so the commands started afterwards inherit it. It returns the applied limit, the hard limit and
+// a function restoring the original limit.
+func raiseOpenFilesLimit() (uint64, uint64, func() error, error) {
+	var original syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &original); err != nil {
+		return 0, 0, nil, err
+	}
+	restore := func() error {
+		return syscall.Setrlimit(syscall.RLIMIT_NOFILE, &original)
+	}
+
+	raised := original
+	raised.Cur = original.Max
+	if raised.Cur <= original.Cur {
+		return original.Cur, original.Max, restore, nil
+	}
+
+	err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised)
+	if errors.Is(err, syscall.EINVAL) && raised.Cur > openFilesFallbackLimit {
+		// On macOS the soft limit can not exceed kern.maxfilesperproc, even if the hard limit is unlimited.
+		raised.Cur = openFilesFallbackLimit
+		err = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised)
+	}
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	return raised.Cur, original.Max, restore, nil
+}
@@ -0,0 +1,51 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package cachedcarthage
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenLoweredOpenFilesLimit_WhenRunCalledWithRaiseOpenFilesLimit_ThenExpectChildInheritsRaisedLimit(t *testing.T) {
+	// Given
+	var original syscall.Rlimit
+	require.NoError(t, syscall.Getrlimit(syscall.RLIMIT_NOFILE, &original))
+	defer func() {
+		require.NoError(t, syscall.Setrlimit(syscall.RLIMIT_NOFILE, &original))
+	}()
+	if original.Max <= 256 {
+		t.Skipf("hard open files limit is too low to lower the soft limit: %d", original.Max)
+	}
+	lowered := syscall.Rlimit{Cur: 256, Max: original.Max}
+	require.NoError(t, syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lowered))
+
+	var stdout bytes.Buffer
+	runner := givenRunnerWithMainAndCommandBuilderCommands("build", []CommandBlueprint{{Command: "sh", Arguments: []string{"-c", "ulimit -n"}}})
+	runner.opts = RunnerOpts{RaiseOpenFilesLimit: true}
+	runner.raiseOpenFilesLimit = raiseOpenFilesLimit
+	runner.stdout = &stdout
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.NoError(t, err)
+	childLimit, err := strconv.ParseUint(strings.TrimSpace(stdout.String()), 10, 64)
+	require.NoError(t, err)
+	assert.Greater(t, childLimit, uint64(256))
+	if original.Max < openFilesFallbackLimit {
+		assert.Equal(t, original.Max, childLimit)
+	}
+
+	var restored syscall.Rlimit
+	require.NoError(t, syscall.Getrlimit(syscall.RLIMIT_NOFILE, &restored))
+	assert.Equal(t, uint64(256), restored.Cur)
+}
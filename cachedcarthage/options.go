@@ -0,0 +1,86 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+var (
+	// buildFlags are accepted by every command building the dependencies.
+	buildFlags = []string{"--configuration", "--platform", "--toolchain", "--derived-data", "--cache-builds", "--use-xcframeworks", "--verbose", "--log-path", "--project-directory", "--color"}
+	// checkoutFlags are accepted by every command checking out the dependencies.
+	checkoutFlags = []string{"--use-ssh", "--use-submodules", "--use-netrc", "--new-resolver", "--no-use-binaries", "--project-directory", "--color", "--verbose"}
+)
+
+// knownCommandFlags maps the Carthage commands to the flags they accept,
+// commands missing from the table are not validated.
+var knownCommandFlags = map[string][]string{
+	bootstrapCommand: append(append([]string{"--no-build", "--no-checkout"}, buildFlags...), checkoutFlags...),
+	updateCommand:    append(append([]string{"--no-build", "--no-checkout"}, buildFlags...), checkoutFlags...),
+	buildCommand:     append([]string{"--no-skip-current", "--no-use-binaries"}, buildFlags...),
+	"checkout":       checkoutFlags,
+	outdatedCommand:  {"--use-ssh", "--use-netrc", "--xcode-warnings", "--project-directory", "--color", "--verbose"},
+}
+
+const useXCFrameworksArg = "--use-xcframeworks"
+
+// flagMinimumCarthageVersions maps the flags to the first Carthage version supporting them,
+// flags missing from the table are supported by every Carthage version the Step works with.
+var flagMinimumCarthageVersions = map[string]*version.Version{
+	"--cache-builds":   version.Must(version.NewVersion("0.20.0")),
+	"--use-netrc":      version.Must(version.NewVersion("0.36.0")),
+	useXCFrameworksArg: version.Must(version.NewVersion("0.37.0")),
+}
+
+// ValidateOptions fails if a flag of the arguments is unknown for the Carthage command,
+// or not supported by the given Carthage version yet.
+func ValidateOptions(carthageCommand string, args []string, carthageVersion *version.Version) error {
+	knownFlags, ok := knownCommandFlags[carthageCommand]
+	if !ok {
+		return nil
+	}
+
+	var unknown, unsupported []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+
+		flag := strings.SplitN(arg, "=", 2)[0]
+		if !contains(knownFlags, flag) {
+			unknown = append(unknown, flag)
+		} else if minimumVersion, ok := flagMinimumCarthageVersions[flag]; ok && carthageVersion.LessThan(minimumVersion) {
+			unsupported = append(unsupported, fmt.Sprintf("%s (requires %s)", flag, minimumVersion))
+		}
+	}
+
+	var problems []string
+	if len(unknown) > 0 {
+		problems = append(problems, fmt.Sprintf("unknown options for `carthage %s`: %s", carthageCommand, strings.Join(unknown, ", ")))
+	}
+	if len(unsupported) > 0 {
+		problems = append(problems, fmt.Sprintf("options not supported by Carthage %s: %s", carthageVersion, strings.Join(unsupported, ", ")))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// ValidateXCFrameworks fails if `--use-xcframeworks` is requested, but the given Carthage version does not support it yet.
+func ValidateXCFrameworks(args []string, carthageVersion *version.Version) error {
+	if !contains(args, useXCFrameworksArg) {
+		return nil
+	}
+
+	minimumVersion := flagMinimumCarthageVersions[useXCFrameworksArg]
+	if carthageVersion.LessThan(minimumVersion) {
+		return fmt.Errorf("%s requires Carthage %s or newer, installed version: %s, upgrade Carthage (for example with `brew upgrade carthage`) or remove the option",
+			useXCFrameworksArg, minimumVersion, carthageVersion)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package cachedcarthage
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GivenKnownFlags_WhenValidateOptionsCalled_ThenExpectNoError(t *testing.T) {
+	// Given
+	carthageVersion := version.Must(version.NewVersion("0.38.0"))
+
+	// When
+	err := ValidateOptions("bootstrap", []string{"--platform", "iOS", "--use-xcframeworks", "--cache-builds", "Alamofire"}, carthageVersion)
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func Test_GivenUnknownFlag_WhenValidateOptionsCalled_ThenExpectError(t *testing.T) {
+	// Given
+	carthageVersion := version.Must(version.NewVersion("0.38.0"))
+
+	// When
+	err := ValidateOptions("bootstrap", []string{"--platfrom", "iOS"}, carthageVersion)
+
+	// Then
+	assert.EqualError(t, err, "unknown options for `carthage bootstrap`: --platfrom")
+}
+
+func Test_GivenFlagOfOtherCommand_WhenValidateOptionsCalled_ThenExpectError(t *testing.T) {
+	// Given
+	carthageVersion := version.Must(version.NewVersion("0.38.0"))
+
+	// When
+	err := ValidateOptions("bootstrap", []string{"--no-skip-current"}, carthageVersion)
+
+	// Then
+	assert.EqualError(t, err, "unknown options for `carthage bootstrap`: --no-skip-current")
+}
+
+func Test_GivenFlagNewerThanCarthage_WhenValidateOptionsCalled_ThenExpectError(t *testing.T) {
+	// Given
+	carthageVersion := version.Must(version.NewVersion("0.36.1"))
+
+	// When
+	err := ValidateOptions("update", []string{"--use-netrc", "--use-xcframeworks"}, carthageVersion)
+
+	// Then
+	assert.EqualError(t, err, "options not supported by Carthage 0.36.1: --use-xcframeworks (requires 0.37.0)")
+}
+
+func Test_GivenNotValidatedCommand_WhenValidateOptionsCalled_ThenExpectNoError(t *testing.T) {
+	// Given
+	carthageVersion := version.Must(version.NewVersion("0.38.0"))
+
+	// When
+	err := ValidateOptions("version", []string{"--whatever"}, carthageVersion)
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func Test_GivenXCFrameworksAndSupportingCarthage_WhenValidateXCFrameworksCalled_ThenExpectNoError(t *testing.T) {
+	// Given
+	carthageVersion := version.Must(version.NewVersion("0.37.0"))
+
+	// When
+	err := ValidateXCFrameworks([]string{"--use-xcframeworks", "--platform", "iOS"}, carthageVersion)
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func Test_GivenXCFrameworksAndOldCarthage_WhenValidateXCFrameworksCalled_ThenExpectUpgradeError(t *testing.T) {
+	// Given
+	carthageVersion := version.Must(version.NewVersion("0.36.1"))
+
+	// When
+	err := ValidateXCFrameworks([]string{"--use-xcframeworks"}, carthageVersion)
+
+	// Then
+	assert.EqualError(t, err, "--use-xcframeworks requires Carthage 0.37.0 or newer, installed version: 0.36.1, upgrade Carthage (for example with `brew upgrade carthage`) or remove the option")
+}
+
+func Test_GivenNoXCFrameworksAndOldCarthage_WhenValidateXCFrameworksCalled_ThenExpectNoError(t *testing.T) {
+	// Given
+	carthageVersion := version.Must(version.NewVersion("0.36.1"))
+
+	// When
+	err := ValidateXCFrameworks([]string{"--platform", "iOS"}, carthageVersion)
+
+	// Then
+	assert.NoError(t, err)
+}
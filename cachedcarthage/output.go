@@ -0,0 +1,86 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// buildingSchemePattern matches Carthage's build progress lines, like:
+// *** Building scheme "Alamofire iOS" in Alamofire.xcworkspace
+var buildingSchemePattern = regexp.MustCompile(`(?m)^\*\*\* Building scheme "(.+)" in `)
+
+// parseBuiltDependencies returns the schemes Carthage reported building, in order of appearance.
+func parseBuiltDependencies(output string) []string {
+	var schemes []string
+	for _, match := range buildingSchemePattern.FindAllStringSubmatch(output, -1) {
+		schemes = append(schemes, match[1])
+	}
+	return schemes
+}
+
+// noSharedSchemesPattern matches the dependencies Carthage skipped building without failing, like:
+// Dependency "Alamofire" has no shared framework schemes for any of the platforms: iOS
+var noSharedSchemesPattern = regexp.MustCompile(`Dependency "([^"]+)" has no shared framework schemes`)
+
+// parseNoSharedSchemesDependencies returns the dependencies Carthage skipped building for having no shared framework schemes,
+// in order of appearance.
+func parseNoSharedSchemesDependencies(output string) []string {
+	var dependencies []string
+	for _, match := range noSharedSchemesPattern.FindAllStringSubmatch(output, -1) {
+		if !contains(dependencies, match[1]) {
+			dependencies = append(dependencies, match[1])
+		}
+	}
+	return dependencies
+}
+
+// outdatedDependencyPattern matches the `carthage outdated` lines, like:
+// Alamofire "5.2.0" -> "5.2.0" (Latest: "5.4.4")
+var outdatedDependencyPattern = regexp.MustCompile(`(?m)^(\S+) "([^"]+)" -> "([^"]+)"(?: \(Latest: "([^"]+)"\))?`)
+
+// OutdatedDependency is a dependency reported by `carthage outdated`.
+type OutdatedDependency struct {
+	Name    string `json:"name"`
+	Current string `json:"current"`
+	Latest  string `json:"latest"`
+}
+
+// parseOutdatedDependencies returns the dependencies reported by `carthage outdated`, in order of appearance.
+// The latest version is the one the Cartfile allows, if Carthage prints no latest version.
+func parseOutdatedDependencies(output string) []OutdatedDependency {
+	dependencies := []OutdatedDependency{}
+	for _, match := range outdatedDependencyPattern.FindAllStringSubmatch(output, -1) {
+		latest := match[4]
+		if latest == "" {
+			latest = match[3]
+		}
+		dependencies = append(dependencies, OutdatedDependency{Name: match[1], Current: match[2], Latest: latest})
+	}
+	return dependencies
+}
+
+// compilerErrorPattern matches compiler error lines, like:
+// /Users/vagrant/git/Carthage/Checkouts/Alamofire/Source/Session.swift:42:17: error: cannot find 'foo' in scope
+var compilerErrorPattern = regexp.MustCompile(`(?m)^\s*(\S[^:\n]*):(\d+)(?::(\d+))?: (?:fatal )?error: (.+?)\r?$`)
+
+// problemMatcherAnnotations returns the compiler errors of the output in the GitHub Actions `::error` annotation format.
+func problemMatcherAnnotations(output string) []string {
+	var annotations []string
+	for _, match := range compilerErrorPattern.FindAllStringSubmatch(output, -1) {
+		properties := fmt.Sprintf("file=%s,line=%s", escapeAnnotationProperty(match[1]), match[2])
+		if match[3] != "" {
+			properties += fmt.Sprintf(",col=%s", match[3])
+		}
+		annotations = append(annotations, fmt.Sprintf("::error %s::%s", properties, escapeAnnotationMessage(match[4])))
+	}
+	return annotations
+}
+
+func escapeAnnotationMessage(message string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(message)
+}
+
+func escapeAnnotationProperty(property string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(property)
+}
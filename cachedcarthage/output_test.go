@@ -0,0 +1,93 @@
+package cachedcarthage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WhenParseBuiltDependenciesCalled_ThenExpectBuiltSchemes(t *testing.T) {
+	// Given
+	output := `*** Fetching Alamofire
+*** Checking out Alamofire at "5.4.4"
+*** xcodebuild output can be found in /var/folders/carthage-xcodebuild.log
+*** Building scheme "Alamofire iOS" in Alamofire.xcworkspace
+*** Building scheme "Kingfisher" in Kingfisher.xcworkspace
+`
+
+	// When
+	actual := parseBuiltDependencies(output)
+
+	// Then
+	assert.Equal(t, []string{"Alamofire iOS", "Kingfisher"}, actual)
+}
+
+func Test_GivenNoBuildOutput_WhenParseBuiltDependenciesCalled_ThenExpectEmpty(t *testing.T) {
+	// When
+	actual := parseBuiltDependencies("*** Fetching Alamofire\n")
+
+	// Then
+	assert.Empty(t, actual)
+}
+
+func Test_GivenCompilerErrors_WhenProblemMatcherAnnotationsCalled_ThenExpectErrorAnnotations(t *testing.T) {
+	// Given
+	output := `*** Building scheme "Alamofire iOS" in Alamofire.xcworkspace
+/Users/vagrant/git/Carthage/Checkouts/Alamofire/Source/Session.swift:42:17: error: cannot find 'foo' in scope
+/Users/vagrant/git/Carthage/Checkouts/Alamofire/Source/Request.swift:7:1: warning: unused variable 'bar'
+/Users/vagrant/git/Carthage/Checkouts/Kingfisher/Sources/Image.m:12: fatal error: 'UIKit/UIKit.h' file not found
+Build Failed
+`
+
+	// When
+	actual := problemMatcherAnnotations(output)
+
+	// Then
+	assert.Equal(t, []string{
+		"::error file=/Users/vagrant/git/Carthage/Checkouts/Alamofire/Source/Session.swift,line=42,col=17::cannot find 'foo' in scope",
+		"::error file=/Users/vagrant/git/Carthage/Checkouts/Kingfisher/Sources/Image.m,line=12::'UIKit/UIKit.h' file not found",
+	}, actual)
+}
+
+func Test_GivenOutdatedOutput_WhenParseOutdatedDependenciesCalled_ThenExpectDependencies(t *testing.T) {
+	// Given
+	output := `*** Fetching Alamofire
+*** Fetching Result
+The following dependencies are outdated:
+Alamofire "5.2.0" -> "5.2.0" (Latest: "5.4.4")
+Result "4.0.0" -> "4.1.0"
+`
+
+	// When
+	actual := parseOutdatedDependencies(output)
+
+	// Then
+	assert.Equal(t, []OutdatedDependency{
+		{Name: "Alamofire", Current: "5.2.0", Latest: "5.4.4"},
+		{Name: "Result", Current: "4.0.0", Latest: "4.1.0"},
+	}, actual)
+}
+
+func Test_GivenUpToDateOutput_WhenParseOutdatedDependenciesCalled_ThenExpectEmpty(t *testing.T) {
+	// When
+	actual := parseOutdatedDependencies("*** Fetching Alamofire\nAll dependencies are up to date.\n")
+
+	// Then
+	assert.Empty(t, actual)
+}
+
+func Test_WhenParseNoSharedSchemesDependenciesCalled_ThenExpectSkippedDependencies(t *testing.T) {
+	// Given
+	output := `*** Building scheme "Alamofire iOS" in Alamofire.xcworkspace
+*** Skipped building Legacy due to the error:
+Dependency "Legacy" has no shared framework schemes for any of the platforms: iOS
+Dependency "Utils" has no shared framework schemes for any of the platforms: iOS, tvOS
+Dependency "Legacy" has no shared framework schemes for any of the platforms: tvOS
+`
+
+	// When
+	actual := parseNoSharedSchemesDependencies(output)
+
+	// Then
+	assert.Equal(t, []string{"Legacy", "Utils"}, actual)
+}
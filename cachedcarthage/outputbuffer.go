@@ -0,0 +1,84 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"sync"
+)
+
+// maxCapturedOutputSize is the amount of each Carthage command output stream kept in memory for the post-run analysis,
+// only the end of a longer output is kept.
+const maxCapturedOutputSize = 16 * 1024 * 1024
+
+// commandOutput is the captured output of a Carthage command.
+type commandOutput struct {
+	// stdout and stderr are the standard output and error of the command.
+	stdout string
+	stderr string
+	// combined is the interleaved standard output and error, empty if the streams are captured separately.
+	combined string
+	// schemeBuilds are the timed schemes of the standard output, only recorded for the JUnit report.
+	schemeBuilds []schemeBuild
+}
+
+// diagnostics returns the output scanned for errors: the combined output if captured, the standard error otherwise.
+func (output commandOutput) diagnostics() string {
+	if output.combined != "" {
+		return output.combined
+	}
+	return output.stderr
+}
+
+// outputBuffer is an io.Writer keeping the last limit bytes written to it.
+// It is safe for concurrent use, so the standard output and error of a command can write into the same buffer.
+type outputBuffer struct {
+	mu    sync.Mutex
+	limit int
+	data  []byte
+	// dropped is the number of bytes already removed from the beginning of data.
+	dropped int
+}
+
+func newOutputBuffer(limit int) *outputBuffer {
+	return &outputBuffer{limit: limit}
+}
+
+// Write ...
+func (buf *outputBuffer) Write(p []byte) (int, error) {
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+
+	buf.data = append(buf.data, p...)
+	// Compacting only after doubling the limit keeps the copying amortized constant per written byte.
+	if len(buf.data) > 2*buf.limit {
+		overflow := len(buf.data) - buf.limit
+		buf.data = append(buf.data[:0], buf.data[overflow:]...)
+		buf.dropped += overflow
+	}
+
+	return len(p), nil
+}
+
+// String returns the kept output, prefixed with a note if the beginning of the output was dropped.
+func (buf *outputBuffer) String() string {
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+
+	data, truncated := buf.data, buf.dropped
+	if overflow := len(data) - buf.limit; overflow > 0 {
+		data = data[overflow:]
+		truncated += overflow
+	}
+
+	if truncated == 0 {
+		return string(data)
+	}
+	return fmt.Sprintf("[%d bytes of earlier output truncated]\n%s", truncated, data)
+}
+
+// all returns the combined output if captured, the standard output followed by the standard error otherwise.
+func (output commandOutput) all() string {
+	if output.combined != "" {
+		return output.combined
+	}
+	return output.stdout + output.stderr
+}
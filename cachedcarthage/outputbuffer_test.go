@@ -0,0 +1,35 @@
+package cachedcarthage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GivenOutputWithinLimit_WhenStringCalled_ThenExpectWholeOutput(t *testing.T) {
+	// Given
+	buf := newOutputBuffer(16)
+	_, _ = buf.Write([]byte("Building A\n"))
+
+	// When
+	output := buf.String()
+
+	// Then
+	assert.Equal(t, "Building A\n", output)
+}
+
+func Test_GivenOutputOverLimit_WhenStringCalled_ThenExpectEndOfOutputWithTruncationNote(t *testing.T) {
+	// Given
+	buf := newOutputBuffer(8)
+	for i := 0; i < 10; i++ {
+		_, _ = buf.Write([]byte(strings.Repeat("a", 3)))
+	}
+	_, _ = buf.Write([]byte("error\n"))
+
+	// When
+	output := buf.String()
+
+	// Then
+	assert.Equal(t, "[28 bytes of earlier output truncated]\naaerror\n", output)
+}
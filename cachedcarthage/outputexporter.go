@@ -0,0 +1,12 @@
+package cachedcarthage
+
+import "github.com/bitrise-io/go-steputils/tools"
+
+// EnvmanOutputExporter exports step outputs with envman.
+type EnvmanOutputExporter struct {
+}
+
+// ExportOutput ...
+func (exporter EnvmanOutputExporter) ExportOutput(key, value string) error {
+	return tools.ExportEnvironmentWithEnvman(key, value)
+}
@@ -0,0 +1,85 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	sdkRootPattern            = regexp.MustCompile(`(?m)^\s*SDKROOT = "?([^";]*)"?;`)
+	supportedPlatformsPattern = regexp.MustCompile(`(?m)^\s*SUPPORTED_PLATFORMS = "?([^";]*)"?;`)
+)
+
+// sdkPlatforms maps the Xcode SDK and platform names of the build settings to the `--platform` values.
+var sdkPlatforms = map[string]string{
+	"iphoneos":         "iOS",
+	"iphonesimulator":  "iOS",
+	"macosx":           "macOS",
+	"appletvos":        "tvOS",
+	"appletvsimulator": "tvOS",
+	"watchos":          "watchOS",
+	"watchsimulator":   "watchOS",
+	"xros":             "visionOS",
+	"xrsimulator":      "visionOS",
+}
+
+// detectedPlatformOrder is the order of the detected platforms in the `--platform` value.
+var detectedPlatformOrder = []string{"iOS", "macOS", "tvOS", "watchOS", "visionOS"}
+
+// DetectPlatforms returns the platforms the Xcode projects of the project dir build for (like `iOS`),
+// based on the `SDKROOT` and `SUPPORTED_PLATFORMS` build settings.
+// It fails if the platforms can not be told for sure, for example if there is no Xcode project or a setting is unknown.
+func DetectPlatforms(projectDir string) ([]string, error) {
+	pbxprojPaths, err := filepath.Glob(filepath.Join(projectDir, "*.xcodeproj", "project.pbxproj"))
+	if err != nil {
+		return nil, err
+	}
+	if len(pbxprojPaths) == 0 {
+		return nil, fmt.Errorf("no Xcode project found in %s", projectDir)
+	}
+
+	found := map[string]bool{}
+	for _, pth := range pbxprojPaths {
+		content, err := os.ReadFile(pth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s, error: %s", pth, err)
+		}
+
+		var values []string
+		for _, match := range sdkRootPattern.FindAllStringSubmatch(string(content), -1) {
+			values = append(values, match[1])
+		}
+		for _, match := range supportedPlatformsPattern.FindAllStringSubmatch(string(content), -1) {
+			values = append(values, strings.Fields(match[1])...)
+		}
+
+		for _, value := range values {
+			value = strings.TrimSpace(value)
+			// `auto` is the SDKROOT of multiplatform targets, their platforms are listed in SUPPORTED_PLATFORMS.
+			if value == "" || value == "auto" {
+				continue
+			}
+
+			platform, ok := sdkPlatforms[strings.ToLower(value)]
+			if !ok {
+				return nil, fmt.Errorf("unknown SDK in %s: %s", pth, value)
+			}
+			found[platform] = true
+		}
+	}
+
+	var platforms []string
+	for _, platform := range detectedPlatformOrder {
+		if found[platform] {
+			platforms = append(platforms, platform)
+		}
+	}
+	if len(platforms) == 0 {
+		return nil, fmt.Errorf("no SDKROOT or SUPPORTED_PLATFORMS build setting found in the Xcode projects of %s", projectDir)
+	}
+
+	return platforms, nil
+}
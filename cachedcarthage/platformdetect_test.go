@@ -0,0 +1,104 @@
+package cachedcarthage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const iOSAppPbxproj = `// !$*UTF8*$!
+{
+	objects = {
+		A1 /* Debug */ = {
+			isa = XCBuildConfiguration;
+			buildSettings = {
+				IPHONEOS_DEPLOYMENT_TARGET = 14.0;
+				SDKROOT = iphoneos;
+			};
+			name = Debug;
+		};
+		A2 /* Debug */ = {
+			isa = XCBuildConfiguration;
+			buildSettings = {
+				PRODUCT_BUNDLE_IDENTIFIER = io.bitrise.App;
+				TARGETED_DEVICE_FAMILY = "1,2";
+			};
+			name = Debug;
+		};
+	};
+}
+`
+
+func Test_GivenProjectWithSingleIOSTarget_WhenDetectPlatformsCalled_ThenExpectIOS(t *testing.T) {
+	// Given
+	projectDir := givenXcodeProject(t, "App", iOSAppPbxproj)
+
+	// When
+	platforms, err := DetectPlatforms(projectDir)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []string{"iOS"}, platforms)
+}
+
+func Test_GivenMultiplatformTarget_WhenDetectPlatformsCalled_ThenExpectSupportedPlatforms(t *testing.T) {
+	// Given
+	projectDir := givenXcodeProject(t, "App", `
+				SDKROOT = auto;
+				SUPPORTED_PLATFORMS = "macosx iphonesimulator iphoneos";
+`)
+	givenXcodeProjectIn(t, projectDir, "Widget", "				SDKROOT = watchos;\n")
+
+	// When
+	platforms, err := DetectPlatforms(projectDir)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []string{"iOS", "macOS", "watchOS"}, platforms)
+}
+
+func Test_GivenAmbiguousProject_WhenDetectPlatformsCalled_ThenExpectError(t *testing.T) {
+	tests := []struct {
+		name    string
+		pbxproj string
+	}{
+		{name: "no platform setting", pbxproj: "				SDKROOT = auto;\n"},
+		{name: "unknown SDK", pbxproj: "				SDKROOT = \"$(CUSTOM_SDK)\";\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			projectDir := givenXcodeProject(t, "App", tt.pbxproj)
+
+			// When
+			platforms, err := DetectPlatforms(projectDir)
+
+			// Then
+			assert.Error(t, err)
+			assert.Nil(t, platforms)
+		})
+	}
+}
+
+func Test_GivenNoXcodeProject_WhenDetectPlatformsCalled_ThenExpectError(t *testing.T) {
+	// When
+	_, err := DetectPlatforms(t.TempDir())
+
+	// Then
+	assert.Error(t, err)
+}
+
+func givenXcodeProject(t *testing.T, name, pbxproj string) string {
+	projectDir := t.TempDir()
+	givenXcodeProjectIn(t, projectDir, name, pbxproj)
+	return projectDir
+}
+
+func givenXcodeProjectIn(t *testing.T, projectDir, name, pbxproj string) {
+	xcodeprojDir := filepath.Join(projectDir, name+".xcodeproj")
+	require.NoError(t, os.MkdirAll(xcodeprojDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(xcodeprojDir, "project.pbxproj"), []byte(pbxproj), 0644))
+}
@@ -0,0 +1,281 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/hashicorp/go-version"
+)
+
+const platformArg = "--platform"
+
+// platformBuildDirNames maps the lowercased `--platform` values to their build dir names.
+var platformBuildDirNames = map[string]string{
+	"ios":      "iOS",
+	"macos":    "Mac",
+	"mac":      "Mac",
+	"tvos":     "tvOS",
+	"watchos":  "watchOS",
+	"visionos": "visionOS",
+	"xros":     "visionOS",
+}
+
+// macCatalystPlatform is the lowercased `--platform` value of Mac Catalyst, which has no build dir:
+// it is only built as the `ios-*-maccatalyst` slice of the XCFrameworks (`--use-xcframeworks`).
+const macCatalystPlatform = "maccatalyst"
+
+// platformMinimumCarthageVersions maps the lowercased `--platform` values to the first Carthage version supporting them,
+// platforms missing from the table are supported by every Carthage version the Step works with.
+var platformMinimumCarthageVersions = map[string]*version.Version{
+	"visionos": version.Must(version.NewVersion("0.40.0")),
+}
+
+// ValidatePlatforms fails if a `--platform` value is not supported by the given Carthage version.
+func ValidatePlatforms(args []string, carthageVersion *version.Version) error {
+	for _, platform := range requestedPlatforms(args) {
+		minimumVersion, ok := platformMinimumCarthageVersions[strings.ToLower(platform)]
+		if ok && carthageVersion.LessThan(minimumVersion) {
+			return fmt.Errorf("platform %s requires Carthage %s or newer, installed version: %s", platform, minimumVersion, carthageVersion)
+		}
+	}
+
+	return nil
+}
+
+// platformBuildDirName returns the build dir name of the platform (like `Mac` for `macOS`),
+// unknown platforms are expected to be build dir names already.
+func platformBuildDirName(platform string) string {
+	if dirName, ok := platformBuildDirNames[strings.ToLower(platform)]; ok {
+		return dirName
+	}
+	return platform
+}
+
+// PlatformKey returns the platforms of the `--platform` argument as a cache key segment (like `ios_tvos`),
+// empty if every platform is built.
+func PlatformKey(args []string) string {
+	var names []string
+	for _, platform := range requestedPlatforms(args) {
+		name := strings.ToLower(platformBuildDirName(platform))
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return unsafeKeyCharsPattern.ReplaceAllString(strings.Join(names, "_"), "-")
+}
+
+// requestedPlatforms returns the platforms of the `--platform` argument, nil if every platform is built.
+func requestedPlatforms(args []string) []string {
+	for i, arg := range args {
+		if arg != platformArg || i+1 >= len(args) {
+			continue
+		}
+
+		platforms := strings.FieldsFunc(args[i+1], func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+		for _, platform := range platforms {
+			if strings.EqualFold(platform, "all") {
+				return nil
+			}
+		}
+		return platforms
+	}
+
+	return nil
+}
+
+// missingPlatforms returns the platforms that have no build dir in the project's build dir.
+// The platforms without a build dir (like Mac Catalyst) are not reported.
+// Nothing is reported for a build dir of XCFrameworks (`--use-xcframeworks`), as it has no platform subdirectories.
+func (project Project) missingPlatforms(platforms []string) ([]string, error) {
+	entries, err := os.ReadDir(project.buildDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read build dir (%s), error: %s", project.buildDir(), err)
+	}
+
+	present := map[string]bool{}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) == ".xcframework" {
+			return nil, nil
+		}
+		if entry.IsDir() {
+			present[entry.Name()] = true
+		}
+	}
+
+	var missing []string
+	for _, platform := range platforms {
+		if !hasBuildDir(platform) {
+			continue
+		}
+		if !present[platformBuildDirName(platform)] {
+			missing = append(missing, platform)
+		}
+	}
+
+	return missing, nil
+}
+
+// xcframeworkSlicePlatforms maps the build dir names to the platform of the XCFramework slice identifiers,
+// like `ios` in `ios-arm64_x86_64-simulator`.
+var xcframeworkSlicePlatforms = map[string]string{
+	"iOS":      "ios",
+	"Mac":      "macos",
+	"tvOS":     "tvos",
+	"watchOS":  "watchos",
+	"visionOS": "xros",
+}
+
+// xcframeworkSlicePlatform returns the platform (and variant) of the platform's XCFramework slice identifiers,
+// like `ios` for `iOS` or `ios-maccatalyst` for `macCatalyst`.
+func xcframeworkSlicePlatform(platform string) string {
+	if strings.EqualFold(platform, macCatalystPlatform) {
+		return "ios-maccatalyst"
+	}
+	return xcframeworkSlicePlatforms[platformBuildDirName(platform)]
+}
+
+// hasBuildDir returns false for the platforms only built into XCFrameworks, like Mac Catalyst.
+func hasBuildDir(platform string) bool {
+	return !strings.EqualFold(platform, macCatalystPlatform)
+}
+
+// emptyPlatforms returns the platforms no framework was built for: whose build dir has no framework,
+// or, for a build dir of XCFrameworks, which no XCFramework has a slice for.
+// The platforms without a build dir (like Mac Catalyst) are not reported for a build dir of platform dirs.
+func (project Project) emptyPlatforms(platforms []string) ([]string, error) {
+	xcframeworks, err := filepath.Glob(filepath.Join(project.buildDir(), "*.xcframework"))
+	if err != nil {
+		return nil, err
+	}
+
+	var empty []string
+	for _, platform := range platforms {
+		var frameworks []string
+		if len(xcframeworks) > 0 {
+			frameworks, err = xcframeworkSlices(xcframeworks, xcframeworkSlicePlatform(platform))
+		} else if hasBuildDir(platform) {
+			frameworks, err = filepath.Glob(filepath.Join(project.buildDir(), platformBuildDirName(platform), "*.framework"))
+		} else {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(frameworks) == 0 {
+			empty = append(empty, platform)
+		}
+	}
+
+	return empty, nil
+}
+
+// xcframeworkSlices returns the slices of the XCFrameworks for the slice platform (like `ios`) or platform and variant
+// (like `ios-maccatalyst`), nothing if the slice platform is empty.
+func xcframeworkSlices(xcframeworks []string, slicePlatform string) ([]string, error) {
+	if slicePlatform == "" {
+		return nil, nil
+	}
+	platform := strings.Split(slicePlatform, "-")[0]
+	variant := strings.TrimPrefix(strings.TrimPrefix(slicePlatform, platform), "-")
+
+	var slices []string
+	for _, xcframework := range xcframeworks {
+		entries, err := os.ReadDir(xcframework)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s, error: %s", xcframework, err)
+		}
+
+		for _, entry := range entries {
+			// A slice identifier is the platform, the architectures and an optional variant, like ios-arm64_x86_64-simulator.
+			parts := strings.Split(entry.Name(), "-")
+			if !entry.IsDir() || len(parts) < 2 || parts[0] != platform {
+				continue
+			}
+
+			sliceVariant := ""
+			if len(parts) > 2 {
+				sliceVariant = parts[2]
+			}
+			if sliceVariant == variant || (variant == "" && sliceVariant == "simulator") {
+				slices = append(slices, filepath.Join(xcframework, entry.Name()))
+			}
+		}
+	}
+	return slices, nil
+}
+
+// builtFrameworksOutputKeyPrefix is followed by the upper cased platform dir name, like `CARTHAGE_BUILT_FRAMEWORKS_IOS`.
+const builtFrameworksOutputKeyPrefix = "CARTHAGE_BUILT_FRAMEWORKS_"
+
+// builtFrameworksByPlatform returns the absolute paths of the frameworks in the build dir's platform dirs, by the platform dir name.
+// The platform dirs without a framework, the dirs not named after a platform (see platformBuildDirNames) and the XCFrameworks are left out.
+func builtFrameworksByPlatform(buildDir string) (map[string][]string, error) {
+	absBuildDir, err := filepath.Abs(buildDir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(absBuildDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read build dir (%s), error: %s", buildDir, err)
+	}
+
+	frameworks := map[string][]string{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !isPlatformBuildDirName(entry.Name()) {
+			continue
+		}
+
+		pths, err := filepath.Glob(filepath.Join(absBuildDir, entry.Name(), "*.framework"))
+		if err != nil {
+			return nil, err
+		}
+		if len(pths) > 0 {
+			frameworks[entry.Name()] = pths
+		}
+	}
+	return frameworks, nil
+}
+
+// isPlatformBuildDirName returns true if the name is the build dir name of a platform, like `iOS` or `visionOS`.
+func isPlatformBuildDirName(name string) bool {
+	for _, dirName := range platformBuildDirNames {
+		if name == dirName {
+			return true
+		}
+	}
+	return false
+}
+
+// exportBuiltFrameworks exports the `|` separated framework paths of each platform dir with frameworks,
+// like `CARTHAGE_BUILT_FRAMEWORKS_IOS`.
+func (runner Runner) exportBuiltFrameworks() {
+	frameworks, err := builtFrameworksByPlatform(runner.buildDir())
+	if err != nil {
+		log.Warnf("Failed to list the built frameworks, error: %s", err)
+		return
+	}
+
+	platforms := make([]string, 0, len(frameworks))
+	for platform := range frameworks {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	for _, platform := range platforms {
+		key := builtFrameworksOutputKeyPrefix + strings.ToUpper(platform)
+		if err := runner.outputExporter.ExportOutput(key, strings.Join(frameworks[platform], "|")); err != nil {
+			log.Warnf("Failed to export %s, error: %s", key, err)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package cachedcarthage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenPlatformArg_WhenRequestedPlatformsCalled_ThenExpectPlatforms(t *testing.T) {
+	// When
+	platforms := requestedPlatforms([]string{"--cache-builds", "--platform", "iOS,macOS"})
+
+	// Then
+	assert.Equal(t, []string{"iOS", "macOS"}, platforms)
+}
+
+func Test_GivenAllPlatformsOrNoPlatformArg_WhenRequestedPlatformsCalled_ThenExpectNil(t *testing.T) {
+	assert.Nil(t, requestedPlatforms([]string{"--platform", "all"}))
+	assert.Nil(t, requestedPlatforms([]string{"--cache-builds"}))
+}
+
+func Test_GivenPlatformArg_WhenPlatformKeyCalled_ThenExpectSortedNormalizedPlatforms(t *testing.T) {
+	assert.Equal(t, "ios_mac", PlatformKey([]string{"--platform", "macOS,iOS,Mac"}))
+	assert.Equal(t, "", PlatformKey([]string{"--platform", "all"}))
+	assert.Equal(t, "", PlatformKey([]string{"--cache-builds"}))
+}
+
+func Test_GivenMacCatalystAndVisionOSPlatforms_WhenPlatformKeyCalled_ThenExpectNormalizedPlatforms(t *testing.T) {
+	assert.Equal(t, "maccatalyst_visionos", PlatformKey([]string{"--platform", "visionOS,macCatalyst,xrOS,MACCATALYST"}))
+	assert.Equal(t, "mac_maccatalyst", PlatformKey([]string{"--platform", "macOS,maccatalyst"}))
+}
+
+func Test_GivenPlatforms_WhenPlatformBuildDirNameCalled_ThenExpectBuildDirNames(t *testing.T) {
+	for platform, dirName := range map[string]string{
+		"visionOS": "visionOS",
+		"xrOS":     "visionOS",
+		"macOS":    "Mac",
+		"Custom":   "Custom",
+	} {
+		assert.Equal(t, dirName, platformBuildDirName(platform), platform)
+	}
+}
+
+func Test_GivenBuildDirCoveringPlatforms_WhenMissingPlatformsCalled_ThenExpectNone(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "iOS", "A.framework", "A"), 16)
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "Mac", "A.framework", "A"), 16)
+
+	// When
+	missing, err := Project{projectDir: tempDir}.missingPlatforms([]string{"ios", "macOS"})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func Test_GivenBuildDirNotCoveringPlatforms_WhenMissingPlatformsCalled_ThenExpectMissingPlatforms(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "Mac", "A.framework", "A"), 16)
+
+	// When
+	missing, err := Project{projectDir: tempDir}.missingPlatforms([]string{"iOS", "macOS", "tvOS"})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"iOS", "tvOS"}, missing)
+}
+
+func Test_GivenMacCatalystPlatformAndVisionOSBuildDir_WhenMissingPlatformsCalled_ThenExpectOnlyMissingPlatformDirs(t *testing.T) {
+	// Given
+	tempDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "visionOS", "A.framework", "A"), 16)
+
+	// When
+	missing, err := Project{projectDir: tempDir}.missingPlatforms([]string{"macCatalyst", "visionOS", "macOS"})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"macOS"}, missing)
+}
+
+func Test_GivenXCFrameworksBuildDir_WhenMissingPlatformsCalled_ThenExpectNone(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "A.xcframework", "Info.plist"), 16)
+
+	// When
+	missing, err := Project{projectDir: tempDir}.missingPlatforms([]string{"iOS"})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func Test_GivenSupportedPlatform_WhenValidatePlatformsCalled_ThenExpectNoError(t *testing.T) {
+	// Given
+	carthageVersion := version.Must(version.NewVersion("0.39.1"))
+
+	// When
+	err := ValidatePlatforms([]string{"--platform", "iOS,tvOS"}, carthageVersion)
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func Test_GivenPlatformNewerThanCarthage_WhenValidatePlatformsCalled_ThenExpectError(t *testing.T) {
+	// Given
+	carthageVersion := version.Must(version.NewVersion("0.39.1"))
+
+	// When
+	err := ValidatePlatforms([]string{"--platform", "iOS,visionOS"}, carthageVersion)
+
+	// Then
+	assert.EqualError(t, err, "platform visionOS requires Carthage 0.40.0 or newer, installed version: 0.39.1")
+}
+
+func Test_GivenPlatformSupportedByCarthage_WhenValidatePlatformsCalled_ThenExpectNoError(t *testing.T) {
+	// Given
+	carthageVersion := version.Must(version.NewVersion("0.40.0"))
+
+	// When
+	err := ValidatePlatforms([]string{"--platform", "visionOS"}, carthageVersion)
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func Test_GivenPlatformDirsWithAndWithoutFrameworks_WhenEmptyPlatformsCalled_ThenExpectPlatformsWithoutFrameworks(t *testing.T) {
+	// Given
+	tempDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "iOS", "A.framework", "A"), 16)
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "Carthage", "Build", "tvOS"), 0755))
+
+	// When
+	empty, err := Project{projectDir: tempDir}.emptyPlatforms([]string{"iOS", "tvOS", "macOS"})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tvOS", "macOS"}, empty)
+}
+
+func Test_GivenMacCatalystPlatformAndPlatformDirs_WhenEmptyPlatformsCalled_ThenExpectMacCatalystNotReported(t *testing.T) {
+	// Given
+	tempDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(tempDir, "Carthage", "Build", "iOS", "A.framework", "A"), 16)
+
+	// When
+	empty, err := Project{projectDir: tempDir}.emptyPlatforms([]string{"iOS", "macCatalyst"})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+func Test_GivenXCFrameworksBuildDir_WhenEmptyPlatformsCalled_ThenExpectPlatformsWithoutSlices(t *testing.T) {
+	// Given
+	tempDir := t.TempDir()
+	xcframeworkDir := filepath.Join(tempDir, "Carthage", "Build", "A.xcframework")
+	givenFileWithSize(t, filepath.Join(xcframeworkDir, "ios-arm64", "A.framework", "A"), 16)
+	givenFileWithSize(t, filepath.Join(xcframeworkDir, "ios-arm64_x86_64-maccatalyst", "A.framework", "A"), 16)
+	givenFileWithSize(t, filepath.Join(xcframeworkDir, "Info.plist"), 16)
+
+	// When
+	empty, err := Project{projectDir: tempDir}.emptyPlatforms([]string{"iOS", "macCatalyst", "tvOS"})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tvOS"}, empty)
+}
+
+func Test_GivenRequestedPlatformWithoutFrameworks_WhenBuildRunCalledWithRequireFrameworks_ThenExpectValidationError(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Build", "iOS", "A.framework", "A"), 16)
+	runner := givenRunnerWithMainAndCommandBuilderCommands("build", []CommandBlueprint{{Command: "true"}})
+	runner.args = []string{"--platform", "iOS,tvOS"}
+	runner.opts = RunnerOpts{ProjectDir: projectDir, RequireFrameworks: true}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrValidation))
+	assert.Contains(t, err.Error(), "no frameworks were built for the requested platforms: tvOS")
+}
+
+func Test_GivenRequestedPlatformsWithFrameworks_WhenBuildRunCalledWithRequireFrameworks_ThenExpectNoError(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Build", "iOS", "A.framework", "A"), 16)
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Build", "tvOS", "A.framework", "A"), 16)
+	runner := givenRunnerWithMainAndCommandBuilderCommands("build", []CommandBlueprint{{Command: "true"}})
+	runner.args = []string{"--platform", "iOS,tvOS"}
+	runner.opts = RunnerOpts{ProjectDir: projectDir, RequireFrameworks: true}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func Test_GivenBuildTree_WhenBuiltFrameworksByPlatformCalled_ThenExpectFrameworksOfPlatformsWithOutput(t *testing.T) {
+	// Given
+	buildDir := givenBuildDirWithFrameworks(t, "iOS/Alamofire.framework", "iOS/Kingfisher.framework", "Mac/Alamofire.framework", "tvOS", "Moya.xcframework/ios-arm64/Moya.framework", "Custom/Moya.framework")
+
+	// When
+	frameworks, err := builtFrameworksByPlatform(buildDir)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"iOS": {filepath.Join(buildDir, "iOS", "Alamofire.framework"), filepath.Join(buildDir, "iOS", "Kingfisher.framework")},
+		"Mac": {filepath.Join(buildDir, "Mac", "Alamofire.framework")},
+	}, frameworks)
+}
+
+func Test_GivenBuildTree_WhenBuildRunCalled_ThenExpectPerPlatformFrameworkExports(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	buildDir := filepath.Join(projectDir, "Carthage", "Build")
+	givenFileWithSize(t, filepath.Join(buildDir, "iOS", "Alamofire.framework", "Alamofire"), 16)
+	givenFileWithSize(t, filepath.Join(buildDir, "iOS", "Kingfisher.framework", "Kingfisher"), 16)
+	givenFileWithSize(t, filepath.Join(buildDir, "tvOS", "Alamofire.framework", "Alamofire"), 16)
+	require.NoError(t, os.MkdirAll(filepath.Join(buildDir, "watchOS"), 0755))
+	mockOutputExporter := givenStubbedOutputExporter()
+	runner := givenRunnerWithMainAndCommandBuilderCommands("build", []CommandBlueprint{{Command: "true"}})
+	runner.outputExporter = mockOutputExporter
+	runner.opts = RunnerOpts{ProjectDir: projectDir}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+	mockOutputExporter.AssertCalled(t, "ExportOutput", "CARTHAGE_BUILT_FRAMEWORKS_IOS",
+		filepath.Join(buildDir, "iOS", "Alamofire.framework")+"|"+filepath.Join(buildDir, "iOS", "Kingfisher.framework"))
+	mockOutputExporter.AssertCalled(t, "ExportOutput", "CARTHAGE_BUILT_FRAMEWORKS_TVOS", filepath.Join(buildDir, "tvOS", "Alamofire.framework"))
+	mockOutputExporter.AssertNotCalled(t, "ExportOutput", "CARTHAGE_BUILT_FRAMEWORKS_WATCHOS", mock.Anything)
+}
+
+func Test_GivenFailingBuild_WhenBuildRunCalled_ThenExpectNoFrameworkExports(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Build", "iOS", "Alamofire.framework", "Alamofire"), 16)
+	mockOutputExporter := givenStubbedOutputExporter()
+	runner := givenRunnerWithMainAndCommandBuilderCommands("build", []CommandBlueprint{{Command: "false"}})
+	runner.outputExporter = mockOutputExporter
+	runner.opts = RunnerOpts{ProjectDir: projectDir}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.Error(t, err)
+	mockOutputExporter.AssertNotCalled(t, "ExportOutput", "CARTHAGE_BUILT_FRAMEWORKS_IOS", mock.Anything)
+}
@@ -0,0 +1,51 @@
+package cachedcarthage
+
+import (
+	"os"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	// MinCPUPriority is the lowest CPUPriority lowering the scheduling priority of the Carthage command.
+	MinCPUPriority = 1
+	// MaxCPUPriority is the highest nice level, PRIO_MAX on macOS.
+	MaxCPUPriority = 20
+)
+
+// processCommand is a command.Command exposing its started process, like the Carthage commands of the carthage package.
+type processCommand interface {
+	Process() *os.Process
+}
+
+// runWithCPUPriority starts the command, lowers its scheduling priority and waits for it.
+// The processes the command starts afterwards (like xcodebuild) inherit the priority.
+func (runner Runner) runWithCPUPriority(cmd command.Command) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	runner.applyCPUPriority(cmd)
+	return cmd.Wait()
+}
+
+// applyCPUPriority sets the nice level of the started command's process.
+// Failures are only printed as warnings, the command keeps running with the inherited priority then.
+func (runner Runner) applyCPUPriority(cmd command.Command) {
+	started, ok := cmd.(processCommand)
+	if !ok || started.Process() == nil {
+		log.Warnf("Failed to lower the CPU priority of the Carthage command: its process is not available")
+		return
+	}
+
+	set := runner.setPriority
+	if set == nil {
+		set = setProcessPriority
+	}
+
+	if err := set(started.Process().Pid, runner.opts.CPUPriority); err != nil {
+		log.Warnf("Failed to lower the CPU priority of the Carthage command, error: %s", err)
+		return
+	}
+	log.Printf("CPU priority (nice level) of the Carthage command: %d", runner.opts.CPUPriority)
+}
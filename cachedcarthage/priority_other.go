@@ -0,0 +1,11 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package cachedcarthage
+
+import "fmt"
+
+// setProcessPriority sets the nice level of the process with setpriority.
+func setProcessPriority(pid, priority int) error {
+	return fmt.Errorf("setting the process priority is not supported on this platform")
+}
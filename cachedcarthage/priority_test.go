@@ -0,0 +1,52 @@
+package cachedcarthage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenFailingSetPriority_WhenRunCalledWithCPUPriority_ThenExpectWarningAndCommandRun(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	var pids []int
+	runner := givenRunnerWithMainAndCommandBuilderCommands("build", []CommandBlueprint{{Command: "true"}})
+	runner.opts = RunnerOpts{CPUPriority: 5}
+	runner.setPriority = func(pid, priority int) error {
+		pids = append(pids, pid)
+		return errors.New("operation not permitted")
+	}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.NoError(t, err)
+	assert.Len(t, pids, 1)
+	assert.Contains(t, logs.String(), "Failed to lower the CPU priority of the Carthage command, error: operation not permitted")
+}
+
+func Test_GivenNoCPUPriority_WhenRunCalled_ThenExpectPriorityNotSet(t *testing.T) {
+	// Given
+	called := false
+	runner := givenRunnerWithMainAndCommandBuilderCommands("build", []CommandBlueprint{{Command: "true"}})
+	runner.setPriority = func(pid, priority int) error {
+		called = true
+		return nil
+	}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.NoError(t, err)
+	assert.False(t, called)
+}
@@ -0,0 +1,11 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package cachedcarthage
+
+import "syscall"
+
+// setProcessPriority sets the nice level of the process with setpriority.
+func setProcessPriority(pid, priority int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, priority)
+}
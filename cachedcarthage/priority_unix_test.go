@@ -0,0 +1,32 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package cachedcarthage
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenCPUPriority_WhenRunCalled_ThenExpectChildRunsWithNiceLevel(t *testing.T) {
+	// Given
+	var stdout bytes.Buffer
+	runner := givenRunnerWithMainAndCommandBuilderCommands("build", []CommandBlueprint{{Command: "sh", Arguments: []string{"-c", "sleep 0.2; ps -o nice= -p $$"}}})
+	runner.opts = RunnerOpts{CPUPriority: 10}
+	runner.setPriority = setProcessPriority
+	runner.stdout = &stdout
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.NoError(t, err)
+	childPriority, err := strconv.Atoi(strings.TrimSpace(stdout.String()))
+	require.NoError(t, err)
+	assert.Equal(t, 10, childPriority)
+}
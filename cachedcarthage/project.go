@@ -12,11 +12,20 @@ const (
 // Project represents a cached Carthage project.
 type Project struct {
 	projectDir string
+	// resolvedFile overrides the Cartfile.resolved path, if it's not in the project dir.
+	resolvedFile string
 }
 
 // NewProject ...
+// The project dir is used as a single path element, so it may contain spaces and other special characters.
 func NewProject(projectDir string) Project {
-	return Project{projectDir: projectDir}
+	return Project{projectDir: filepath.Clean(projectDir)}
+}
+
+// WithResolvedFilePath makes the project read its Cartfile.resolved from the given path, instead of the project dir.
+func (project Project) WithResolvedFilePath(pth string) Project {
+	project.resolvedFile = filepath.Clean(pth)
+	return project
 }
 
 func (project Project) carthageDir() string {
@@ -32,5 +41,8 @@ func (project Project) buildDir() string {
 }
 
 func (project Project) resolvedFilePath() string {
+	if project.resolvedFile != "" {
+		return project.resolvedFile
+	}
 	return filepath.Join(project.projectDir, resolvedFileName)
 }
@@ -9,7 +9,7 @@ import (
 func Test_WhenCarthageDirCalled_ThenExpectCorrectPath(t *testing.T) {
 	// Given
 	expectedPath := "/base/dir/Carthage"
-	project := Project{"/base/dir"}
+	project := Project{projectDir: "/base/dir"}
 
 	// When
 	actualPath := project.carthageDir()
@@ -21,7 +21,7 @@ func Test_WhenCarthageDirCalled_ThenExpectCorrectPath(t *testing.T) {
 func Test_WhenCacheFilePathCalled_ThenExpectCorrectPath(t *testing.T) {
 	// Given
 	expectedPath := "/base/dir/Carthage/Cachefile"
-	project := Project{"/base/dir"}
+	project := Project{projectDir: "/base/dir"}
 
 	// When
 	actualPath := project.cacheFilePath()
@@ -33,7 +33,7 @@ func Test_WhenCacheFilePathCalled_ThenExpectCorrectPath(t *testing.T) {
 func Test_WhenBuildDirCalled_ThenExpectCorrectPath(t *testing.T) {
 	// Given
 	expectedPath := "/base/dir/Carthage/Build"
-	project := Project{"/base/dir"}
+	project := Project{projectDir: "/base/dir"}
 
 	// When
 	actualPath := project.buildDir()
@@ -45,7 +45,7 @@ func Test_WhenBuildDirCalled_ThenExpectCorrectPath(t *testing.T) {
 func Test_WhenResolvedFilePathCalled_ThenExpectCorrectPath(t *testing.T) {
 	// Given
 	expectedPath := "/base/dir/Cartfile.resolved"
-	project := Project{"/base/dir"}
+	project := Project{projectDir: "/base/dir"}
 
 	// When
 	actualPath := project.resolvedFilePath()
@@ -53,3 +53,27 @@ func Test_WhenResolvedFilePathCalled_ThenExpectCorrectPath(t *testing.T) {
 	// Then
 	assert.Equal(t, expectedPath, actualPath)
 }
+
+func Test_GivenProjectDirWithSpacesAndUnicode_WhenPathsCalled_ThenExpectPathsUnderProjectDir(t *testing.T) {
+	// Given
+	projectDir := "/Users/vagrant/My App/Árvíztűrő ώ/"
+	project := NewProject(projectDir)
+
+	// Then
+	assert.Equal(t, "/Users/vagrant/My App/Árvíztűrő ώ/Carthage", project.carthageDir())
+	assert.Equal(t, "/Users/vagrant/My App/Árvíztűrő ώ/Carthage/Build", project.buildDir())
+	assert.Equal(t, "/Users/vagrant/My App/Árvíztűrő ώ/Carthage/Cachefile", project.cacheFilePath())
+	assert.Equal(t, "/Users/vagrant/My App/Árvíztűrő ώ/Cartfile.resolved", project.resolvedFilePath())
+}
+
+func Test_GivenResolvedFilePathOverride_WhenResolvedFilePathCalled_ThenExpectOverride(t *testing.T) {
+	// Given
+	project := NewProject("/base/dir").WithResolvedFilePath("/base/dir/build/generated/Cartfile.resolved")
+
+	// When
+	actualPath := project.resolvedFilePath()
+
+	// Then
+	assert.Equal(t, "/base/dir/build/generated/Cartfile.resolved", actualPath)
+	assert.Equal(t, "/base/dir/Carthage/Build", project.buildDir())
+}
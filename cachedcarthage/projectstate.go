@@ -9,6 +9,7 @@ type ProjectState struct {
 
 	resolvedFileExists  bool
 	resolvedFileContent string
+	resolvedFileHash    string
 
 	carthageDirExists bool
 }
@@ -0,0 +1,168 @@
+package cachedcarthage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// commitSHAPattern matches an abbreviated or full git commit SHA.
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// ResolvedOrigin is the origin of a Cartfile.resolved entry.
+type ResolvedOrigin string
+
+// ResolvedOrigins ...
+const (
+	ResolvedOriginGitHub ResolvedOrigin = "github"
+	ResolvedOriginGit    ResolvedOrigin = "git"
+	ResolvedOriginBinary ResolvedOrigin = "binary"
+)
+
+// ResolvedEntry is a dependency of the Cartfile.resolved.
+type ResolvedEntry struct {
+	Origin ResolvedOrigin
+	// Identifier is the GitHub repository (`owner/name` or a GitHub Enterprise URL),
+	// the git repository URL or the binary specification URL.
+	Identifier string
+	// Version is the resolved version, or the commit-ish revision for git dependencies.
+	Version string
+}
+
+// Name returns the dependency name used by Carthage for the checkout and version file names.
+// The query and fragment of a binary specification URL are not part of the name.
+func (entry ResolvedEntry) Name() string {
+	identifier := entry.Identifier
+	if entry.Origin == ResolvedOriginBinary {
+		if u, err := url.Parse(identifier); err == nil && u.Path != "" {
+			identifier = u.Path
+		}
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(path.Base(identifier), ".git"), ".json")
+}
+
+// HasCheckout returns if Carthage checks the dependency out into `Carthage/Checkouts`,
+// binary dependencies are downloaded straight into `Carthage/Build` instead.
+func (entry ResolvedEntry) HasCheckout() bool {
+	return entry.Origin != ResolvedOriginBinary
+}
+
+// IsPinned returns if the entry is resolved to a version tag or a commit SHA, instead of a floating ref like a branch.
+// Binary dependencies are always resolved to a version.
+func (entry ResolvedEntry) IsPinned() bool {
+	if entry.Origin == ResolvedOriginBinary || commitSHAPattern.MatchString(entry.Version) {
+		return true
+	}
+
+	_, err := version.NewVersion(entry.Version)
+	return err == nil
+}
+
+// UnpinnedEntries returns the entries not resolved to a version tag or a commit SHA.
+func UnpinnedEntries(entries []ResolvedEntry) []ResolvedEntry {
+	var unpinned []ResolvedEntry
+	for _, entry := range entries {
+		if !entry.IsPinned() {
+			unpinned = append(unpinned, entry)
+		}
+	}
+	return unpinned
+}
+
+// ParseResolved parses the Cartfile.resolved entries, skipping empty lines and `#` comments.
+func ParseResolved(r io.Reader) ([]ResolvedEntry, error) {
+	var entries []ResolvedEntry
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		entry, ok, err := parseResolvedLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s line %d: %s", resolvedFileName, lineNumber, err)
+		}
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s, error: %s", resolvedFileName, err)
+	}
+
+	return entries, nil
+}
+
+// parseResolvedLine returns false if the line has no entry (empty or comment only).
+func parseResolvedLine(line string) (ResolvedEntry, bool, error) {
+	fields, err := splitResolvedLine(line)
+	if err != nil {
+		return ResolvedEntry{}, false, err
+	}
+	if len(fields) == 0 {
+		return ResolvedEntry{}, false, nil
+	}
+	if len(fields) != 3 {
+		return ResolvedEntry{}, false, fmt.Errorf("expected 3 fields (origin, identifier and version), got %d", len(fields))
+	}
+
+	origin := ResolvedOrigin(fields[0])
+	switch origin {
+	case ResolvedOriginGitHub, ResolvedOriginGit, ResolvedOriginBinary:
+	default:
+		return ResolvedEntry{}, false, fmt.Errorf("unknown origin: %s", fields[0])
+	}
+
+	return ResolvedEntry{Origin: origin, Identifier: fields[1], Version: fields[2]}, true, nil
+}
+
+// splitResolvedLine splits the line into its bare or double quoted fields, until a `#` comment outside of quotes.
+func splitResolvedLine(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField, inQuotes, escaped := false, false, false
+
+	for _, r := range strings.TrimSuffix(line, "\r") {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case inQuotes && r == '\\':
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+			inField = true
+		case inQuotes:
+			field.WriteRune(r)
+		case r == '#':
+			return appendField(fields, &field, inField), nil
+		case r == ' ' || r == '\t':
+			fields = appendField(fields, &field, inField)
+			inField = false
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+
+	return appendField(fields, &field, inField), nil
+}
+
+func appendField(fields []string, field *strings.Builder, inField bool) []string {
+	if !inField {
+		return fields
+	}
+	fields = append(fields, field.String())
+	field.Reset()
+	return fields
+}
@@ -0,0 +1,166 @@
+package cachedcarthage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WhenParseResolvedCalled_ThenExpectEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []ResolvedEntry
+	}{
+		{
+			name:    "github",
+			content: `github "Alamofire/Alamofire" "5.4.4"`,
+			want:    []ResolvedEntry{{Origin: ResolvedOriginGitHub, Identifier: "Alamofire/Alamofire", Version: "5.4.4"}},
+		},
+		{
+			name:    "github enterprise",
+			content: `github "https://enterprise.local/ghe/desktop/git-error-translations" "3.0.0"`,
+			want:    []ResolvedEntry{{Origin: ResolvedOriginGitHub, Identifier: "https://enterprise.local/ghe/desktop/git-error-translations", Version: "3.0.0"}},
+		},
+		{
+			name:    "git with revision",
+			content: `git "https://github.com/socketio/socket.io-client-swift.git" "a6a4a5e4b8e7a6d0b8f0c6c4cbb2c1a5f9b1d2e3"`,
+			want:    []ResolvedEntry{{Origin: ResolvedOriginGit, Identifier: "https://github.com/socketio/socket.io-client-swift.git", Version: "a6a4a5e4b8e7a6d0b8f0c6c4cbb2c1a5f9b1d2e3"}},
+		},
+		{
+			name:    "binary",
+			content: `binary "https://dl.google.com/dl/firebase/ios/carthage/FirebaseAnalyticsBinary.json" "8.8.0"`,
+			want:    []ResolvedEntry{{Origin: ResolvedOriginBinary, Identifier: "https://dl.google.com/dl/firebase/ios/carthage/FirebaseAnalyticsBinary.json", Version: "8.8.0"}},
+		},
+		{
+			name:    "local git path with spaces",
+			content: `git "file:///Users/vagrant/My Libs/Lib" "1.0.0"`,
+			want:    []ResolvedEntry{{Origin: ResolvedOriginGit, Identifier: "file:///Users/vagrant/My Libs/Lib", Version: "1.0.0"}},
+		},
+		{
+			name:    "escaped quote",
+			content: `git "https://example.com/a\"b.git" "1.0.0"`,
+			want:    []ResolvedEntry{{Origin: ResolvedOriginGit, Identifier: `https://example.com/a"b.git`, Version: "1.0.0"}},
+		},
+		{
+			name: "comments, empty lines and CRLF",
+			content: "# generated\r\n" +
+				"\r\n" +
+				"github \"Alamofire/Alamofire\" \"5.4.4\" # pinned\r\n" +
+				"github \"onevcat/Kingfisher\"   \"6.3.0\"\r\n",
+			want: []ResolvedEntry{
+				{Origin: ResolvedOriginGitHub, Identifier: "Alamofire/Alamofire", Version: "5.4.4"},
+				{Origin: ResolvedOriginGitHub, Identifier: "onevcat/Kingfisher", Version: "6.3.0"},
+			},
+		},
+		{
+			name:    "hash inside quotes",
+			content: `git "https://example.com/repo#fragment.git" "1.0.0"`,
+			want:    []ResolvedEntry{{Origin: ResolvedOriginGit, Identifier: "https://example.com/repo#fragment.git", Version: "1.0.0"}},
+		},
+		{
+			name:    "empty",
+			content: "",
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// When
+			entries, err := ParseResolved(strings.NewReader(tt.content))
+
+			// Then
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, entries)
+		})
+	}
+}
+
+func Test_GivenInvalidLine_WhenParseResolvedCalled_ThenExpectError(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "unknown origin",
+			content: "github \"Alamofire/Alamofire\" \"5.4.4\"\nsvn \"https://example.com/repo\" \"1.0.0\"",
+			wantErr: "invalid Cartfile.resolved line 2: unknown origin: svn",
+		},
+		{
+			name:    "missing version",
+			content: `github "Alamofire/Alamofire"`,
+			wantErr: "invalid Cartfile.resolved line 1: expected 3 fields (origin, identifier and version), got 2",
+		},
+		{
+			name:    "unterminated quote",
+			content: `github "Alamofire/Alamofire" "5.4.4`,
+			wantErr: "invalid Cartfile.resolved line 1: unterminated quote",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// When
+			entries, err := ParseResolved(strings.NewReader(tt.content))
+
+			// Then
+			assert.EqualError(t, err, tt.wantErr)
+			assert.Nil(t, entries)
+		})
+	}
+}
+
+func Test_WhenResolvedEntryNameCalled_ThenExpectCarthageName(t *testing.T) {
+	assert.Equal(t, "Alamofire", ResolvedEntry{Identifier: "Alamofire/Alamofire"}.Name())
+	assert.Equal(t, "socket.io-client-swift", ResolvedEntry{Identifier: "https://github.com/socketio/socket.io-client-swift.git"}.Name())
+	assert.Equal(t, "FirebaseAnalyticsBinary", ResolvedEntry{Identifier: "https://dl.google.com/dl/firebase/ios/carthage/FirebaseAnalyticsBinary.json"}.Name())
+	assert.Equal(t, "FirebaseAnalyticsBinary", ResolvedEntry{Origin: ResolvedOriginBinary, Identifier: "https://dl.google.com/dl/firebase/ios/carthage/FirebaseAnalyticsBinary.json?alt=media#latest"}.Name())
+	assert.Equal(t, "Lib", ResolvedEntry{Origin: ResolvedOriginBinary, Identifier: "file:///Users/vagrant/My Libs/Lib.json"}.Name())
+}
+
+func Test_GivenBinaryOnlyResolved_WhenParseResolvedCalled_ThenExpectEntriesWithoutCheckout(t *testing.T) {
+	// Given
+	content := `binary "https://dl.google.com/dl/firebase/ios/carthage/FirebaseAnalyticsBinary.json" "8.8.0"
+binary "https://example.com/specs/Lib.json?token=abc" "1.2.0"
+`
+
+	// When
+	entries, err := ParseResolved(strings.NewReader(content))
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		assert.Equal(t, ResolvedOriginBinary, entry.Origin)
+		assert.False(t, entry.HasCheckout())
+		assert.True(t, entry.IsPinned())
+	}
+	assert.Equal(t, "FirebaseAnalyticsBinary", entries[0].Name())
+	assert.Equal(t, "Lib", entries[1].Name())
+	assert.True(t, ResolvedEntry{Origin: ResolvedOriginGitHub, Identifier: "Alamofire/Alamofire", Version: "5.4.4"}.HasCheckout())
+}
+
+func Test_GivenResolvedWithPinnedAndFloatingRefs_WhenUnpinnedEntriesCalled_ThenExpectFloatingRefs(t *testing.T) {
+	// Given
+	content := `github "Alamofire/Alamofire" "5.4.4"
+github "ReactiveX/RxSwift" "v6.2.0"
+git "https://github.com/socketio/socket.io-client-swift.git" "a6a4a5e4b8e7a6d0b8f0c6c4cbb2c1a5f9b1d2e3"
+github "SnapKit/SnapKit" "d458564"
+github "onevcat/Kingfisher" "master"
+git "https://example.com/lib.git" "feature/new-api"
+binary "https://dl.google.com/dl/firebase/ios/carthage/FirebaseAnalyticsBinary.json" "8.8.0"
+`
+	entries, err := ParseResolved(strings.NewReader(content))
+	require.NoError(t, err)
+
+	// When
+	unpinned := UnpinnedEntries(entries)
+
+	// Then
+	assert.Equal(t, []ResolvedEntry{
+		{Origin: ResolvedOriginGitHub, Identifier: "onevcat/Kingfisher", Version: "master"},
+		{Origin: ResolvedOriginGit, Identifier: "https://example.com/lib.git", Version: "feature/new-api"},
+	}, unpinned)
+}
@@ -1,36 +1,238 @@
 package cachedcarthage
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bitrise-io/go-steputils/stepconf"
 	"github.com/bitrise-io/go-utils/command"
 	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
 	"github.com/bitrise-io/go-utils/retry"
 )
 
 const (
 	bootstrapCommand = "bootstrap"
+	buildCommand     = "build"
 	updateCommand    = "update"
+	outdatedCommand  = "outdated"
+)
+
+const verboseArg = "--verbose"
+
+const defaultLocale = "en_US.UTF-8"
+
+const (
+	cacheHitOutputKey        = "CARTHAGE_CACHE_HIT"
+	cacheMissReasonOutputKey = "CARTHAGE_CACHE_MISS_REASON"
+	outdatedOutputKey        = "CARTHAGE_OUTDATED"
+	buildChangedOutputKey    = "CARTHAGE_BUILD_CHANGED"
+	cacheSizeOutputKey       = "CARTHAGE_CACHE_SIZE_BYTES"
 )
 
 // CarthageCache ...
 type CarthageCache interface {
+	CheckoutsRestored() (bool, error)
 	Commit() error
 	CreateIndicator() error
+	Invalidate() error
 	IsAvailable() (bool, error)
+	IsRestored() (bool, error)
+	SavedSize() (int64, error)
+	MakeBuildDirWritable() error
+	MissingPlatforms(platforms []string) ([]string, error)
+	MissReason() (CacheMissReason, error)
+	ReconcileVersionFiles(mode VersionFileReconcileMode) error
+}
+
+// DependencyCache restores and saves the build output of the dependencies one by one.
+type DependencyCache interface {
+	Restore() (restored []string, missing []string, err error)
+	Save() ([]string, error)
 }
 
 // CommandBuilder ...
 type CommandBuilder interface {
 	AddGitHubToken(githubToken stepconf.Secret) CommandBuilder
 	AddXCConfigFile(path string) CommandBuilder
+	AddEnv(key, value string) CommandBuilder
 	Append(args ...string) CommandBuilder
-	Command(stdout io.Writer, stderr io.Writer) command.Command
+	Command(ctx context.Context, stdout io.Writer, stderr io.Writer) command.Command
+}
+
+// OutputExporter ...
+type OutputExporter interface {
+	ExportOutput(key, value string) error
+}
+
+// RunnerOpts contains the optional settings of a Runner.
+type RunnerOpts struct {
+	// SummaryPath is the path of the human readable run summary, no summary is written if empty.
+	SummaryPath string
+
+	// JUnitReportPath is where a JUnit XML report is written with a test case per dependency, no report is written if empty.
+	JUnitReportPath string
+
+	// MetricsPath is where the run's metrics are written in the Prometheus text exposition format, no metrics are written if empty.
+	MetricsPath string
+
+	// DisableStatusLine skips printing the `CARTHAGE_RESULT` key=value line at the end of the run.
+	DisableStatusLine bool
+
+	// ProjectDir is the Carthage project's directory.
+	ProjectDir string
+
+	// Locale is set as `LANG` and `LC_ALL` for the Carthage command, defaults to en_US.UTF-8.
+	Locale string
+
+	// TempDir is set as `TMPDIR` for the Carthage command, it is created if it does not exist.
+	TempDir string
+
+	// HTTPProxy, HTTPSProxy and NoProxy are set as the lower and upper case proxy envs (like `http_proxy` and `HTTP_PROXY`)
+	// for the Carthage command, the envs are not touched if empty.
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+
+	// GitCredentialHelper is set as the `credential.helper` git config of the Carthage command's git operations
+	// via the `GIT_CONFIG_*` envs, next to the already configured helpers. The envs are not touched if empty.
+	GitCredentialHelper string
+
+	// MinFreeDiskMB is the free disk space expected on the project's volume before building, the check is skipped if 0.
+	// FailOnLowDiskSpace makes the run fail instead of warning, if less space is available.
+	MinFreeDiskMB      uint64
+	FailOnLowDiskSpace bool
+
+	// VersionFileReconcileMode defines how the `--cache-builds` version files of a restored cache are handled.
+	VersionFileReconcileMode VersionFileReconcileMode
+
+	// StaleBuildDirMode defines how a non-empty build dir is handled, if no cache was restored before the bootstrap command,
+	// the build dir is not checked if StaleBuildDirNone or empty.
+	StaleBuildDirMode StaleBuildDirMode
+
+	// MakeRestoredWritable adds the owner write permission to a restored build dir's content before building.
+	MakeRestoredWritable bool
+
+	// RemoveDSYMs removes the dSYM bundles and StripBitcode strips the bitcode of the built frameworks
+	// before the bootstrap command's build dir is cached, to shrink the cache.
+	RemoveDSYMs  bool
+	StripBitcode bool
+
+	// DisableCacheSave skips committing the cache paths of the bootstrap command, a restored cache is still used.
+	DisableCacheSave bool
+
+	// RequireCacheHit fails the run after building, if the bootstrap command could not use the cache.
+	RequireCacheHit bool
+
+	// NoSharedSchemesMode defines how the dependencies Carthage skipped for having no shared framework schemes are handled,
+	// they are only printed as a warning if empty.
+	NoSharedSchemesMode NoSharedSchemesMode
+
+	// RequireFrameworks fails the run after building, if no framework was built for a platform of the `--platform` option.
+	RequireFrameworks bool
+
+	// DuplicateFrameworksMode defines how the framework names built by more than one dependency are handled after building,
+	// they are not checked if DuplicateFrameworksNone or empty.
+	DuplicateFrameworksMode DuplicateFrameworksMode
+
+	// ExpectedArchs are the architectures (like `arm64` or `arm64-simulator`) every built framework is expected to have,
+	// the run fails after building, if one is missing. Nothing is verified if empty.
+	ExpectedArchs []string
+
+	// ExpectedCodeSignature is the code signature every built framework is expected to have: UnsignedCodeSignature or a team ID.
+	// The run fails after building, if a framework has a different one. Nothing is verified if empty.
+	ExpectedCodeSignature string
+
+	// RaiseOpenFilesLimit raises the soft open files limit (RLIMIT_NOFILE) up to the hard limit for the Carthage command.
+	RaiseOpenFilesLimit bool
+
+	// CPUPriority is the nice level (MinCPUPriority to MaxCPUPriority) lowering the scheduling priority of the Carthage command,
+	// so it does not starve the other jobs of a shared machine. The priority is inherited if 0.
+	CPUPriority int
+
+	// RequireResolvedFile fails the update command, if it did not leave a Cartfile.resolved in the project dir.
+	RequireResolvedFile bool
+
+	// ChangedDependencies are built alone for the bootstrap command, if a cache of the other dependencies is restored.
+	ChangedDependencies []string
+
+	// DependencyCache restores the dependencies one by one for the bootstrap command, if the project's cache is not restored.
+	// Only the missing dependencies are built, the command is skipped if every dependency is restored,
+	// and the newly built dependencies are saved after building.
+	DependencyCache DependencyCache
+
+	// DependencyRetry is the number of times a dependency whose xcodebuild invocation failed is re-built on its own,
+	// before re-running the whole command.
+	DependencyRetry uint
+
+	// ProblemMatcher prints the compiler errors of the Carthage output as GitHub Actions `::error` annotations.
+	ProblemMatcher bool
+
+	// BuildLogPath is passed as `--log-path` to the commands running xcodebuild, unless the option is set already.
+	// BuildLogTailLines is the number of the xcodebuild log's last lines printed if the command fails, nothing is printed if 0.
+	BuildLogPath      string
+	BuildLogTailLines uint
+
+	// FailureLogDir is where the captured Carthage output is written, if the run fails.
+	FailureLogDir string
+
+	// LogStreamURL is where the Carthage output is POSTed line by line while running,
+	// with the GitHub access token and the LogStreamSecrets redacted.
+	// LogStreamClient sends the requests, http.DefaultClient if not set. Failed deliveries never fail the run.
+	LogStreamURL     string
+	LogStreamClient  *http.Client
+	LogStreamSecrets []string
+
+	// SeparateOutputStreams makes the output analysis (the problem matcher and the known failure detection,
+	// like the rate limit or the failed dependency) use the standard error alone, instead of the interleaved standard output and error.
+	SeparateOutputStreams bool
+
+	// CarthageVersion and SwiftVersion are the detected tool versions, reported in the summary.
+	CarthageVersion string
+	SwiftVersion    string
+}
+
+// NoSharedSchemesMode defines how the dependencies without shared framework schemes are handled.
+type NoSharedSchemesMode string
+
+// No shared schemes modes.
+const (
+	// NoSharedSchemesWarn prints the skipped dependencies as a warning.
+	NoSharedSchemesWarn NoSharedSchemesMode = "warn"
+	// NoSharedSchemesFail fails the run, before the incomplete build is cached.
+	NoSharedSchemesFail NoSharedSchemesMode = "fail"
+)
+
+// RunResult describes the outcome of a Runner run.
+type RunResult struct {
+	Command           string
+	CacheHit          bool
+	CacheMissReason   CacheMissReason
+	Duration          time.Duration
+	BuiltDependencies []string
+
+	// CacheSize is the size of the saved cache in bytes, 0 if the cache was not saved.
+	CacheSize int64
+
+	// BuildChanged is only set for the bootstrap command: whether the run changed the Carthage/Build directory.
+	BuildChanged bool
+
+	// OutdatedDependencies is only set for the outdated command.
+	OutdatedDependencies []OutdatedDependency
+
+	// Warnings are the problems of the build output reported without failing the run,
+	// like the dependencies skipped for having no shared framework schemes.
+	Warnings []string
+
+	output commandOutput
 }
 
 // Runner can be used to execute Carthage command and cache the results.
@@ -41,6 +243,23 @@ type Runner struct {
 	xcconfigPath      string
 	cache             CarthageCache
 	commandBuilder    CommandBuilder
+	outputExporter    OutputExporter
+	opts              RunnerOpts
+
+	freeDiskSpace func(pth string) (uint64, error)
+	// raiseOpenFilesLimit raises the process' open files limit, the setrlimit syscall is used if not set.
+	raiseOpenFilesLimit func() (uint64, uint64, func() error, error)
+	// setPriority sets the nice level of a process, the setpriority syscall is used if not set.
+	setPriority func(pid, priority int) error
+	// lipoInfo returns the `lipo -info` output of a binary, the lipo command is used if not set.
+	lipoInfo func(pth string) (string, error)
+	// codesignInfo returns the `codesign -dv` output of a bundle, the codesign command is used if not set.
+	codesignInfo func(pth string) (string, error)
+	// bitcodeStrip strips the bitcode of a binary in place, the bitcode_strip command is used if not set.
+	bitcodeStrip func(pth string) error
+	// stdout and stderr receive the live output of the Carthage command, os.Stdout and os.Stderr if not set.
+	stdout io.Writer
+	stderr io.Writer
 }
 
 // NewRunner ...
@@ -51,59 +270,488 @@ func NewRunner(
 	xcconfigPath string,
 	cache CarthageCache,
 	commandBuilder CommandBuilder,
+	outputExporter OutputExporter,
+	opts RunnerOpts,
 ) Runner {
 	return Runner{
-		carthageCommand:   carthageCommand,
-		args:              args,
-		githubAccessToken: githubAccessToken,
-		xcconfigPath:      xcconfigPath,
-		cache:             cache,
-		commandBuilder:    commandBuilder,
+		carthageCommand:     carthageCommand,
+		args:                args,
+		githubAccessToken:   githubAccessToken,
+		xcconfigPath:        xcconfigPath,
+		cache:               cache,
+		commandBuilder:      commandBuilder,
+		outputExporter:      outputExporter,
+		opts:                opts,
+		freeDiskSpace:       freeDiskSpace,
+		lipoInfo:            lipoInfo,
+		bitcodeStrip:        bitcodeStrip,
+		codesignInfo:        codesignInfo,
+		raiseOpenFilesLimit: raiseOpenFilesLimit,
+		setPriority:         setProcessPriority,
+		stdout:              os.Stdout,
+		stderr:              os.Stderr,
 	}
 }
 
 // Run ...
 func (runner Runner) Run() error {
+	_, err := runner.RunContext(context.Background())
+	return err
+}
+
+// RunContext executes the Carthage command and caches the results,
+// the command is killed and the cache is left untouched if the context is done before the run completes.
+func (runner Runner) RunContext(ctx context.Context) (RunResult, error) {
+	startTime := time.Now()
+
+	result, err := runner.run(ctx)
+	result.Duration = time.Since(startTime)
+
+	if err == nil && runner.opts.RequireCacheHit && runner.carthageCommand == bootstrapCommand && !result.CacheHit {
+		err = withKind(ErrCache, fmt.Errorf("cache hit was required, but the cache was not available"))
+	}
+
+	runner.exportOutputs(result)
+	if err == nil && contains(archVerifiedCommands, runner.carthageCommand) {
+		runner.exportBuiltFrameworks()
+	}
+
+	if err != nil && runner.opts.FailureLogDir != "" {
+		if pth, logErr := writeFailureLog(runner.opts.FailureLogDir, result.output, err); logErr != nil {
+			log.Warnf("Failed to write the Carthage log, error: %s", logErr)
+		} else {
+			log.Donef("Carthage log deployed to: %s", pth)
+		}
+	}
+
+	if runner.opts.SummaryPath != "" {
+		if err := writeSummary(runner.opts.SummaryPath, runner.summary(result, err)); err != nil {
+			log.Warnf("Failed to write summary, error: %s", err)
+		} else {
+			log.Donef("Summary written to: %s", runner.opts.SummaryPath)
+		}
+	}
+
+	if runner.opts.JUnitReportPath != "" {
+		if err := writeJUnitReport(runner.opts.JUnitReportPath, junitReport(result, err, runner.restoredDependencies(result))); err != nil {
+			log.Warnf("Failed to write JUnit report, error: %s", err)
+		} else {
+			log.Donef("JUnit report written to: %s", runner.opts.JUnitReportPath)
+		}
+	}
+
+	if runner.opts.MetricsPath != "" {
+		if err := writeMetrics(runner.opts.MetricsPath, metrics(result)); err != nil {
+			log.Warnf("Failed to write metrics, error: %s", err)
+		} else {
+			log.Donef("Metrics written to: %s", runner.opts.MetricsPath)
+		}
+	}
+
+	if !runner.opts.DisableStatusLine {
+		log.Printf("%s", statusLine(result, err))
+	}
+
+	return result, err
+}
+
+func (runner Runner) exportOutputs(result RunResult) {
+	if err := runner.outputExporter.ExportOutput(cacheHitOutputKey, strconv.FormatBool(result.CacheHit)); err != nil {
+		log.Warnf("Failed to export %s, error: %s", cacheHitOutputKey, err)
+	}
+
+	if runner.carthageCommand == bootstrapCommand {
+		if err := runner.outputExporter.ExportOutput(cacheMissReasonOutputKey, string(result.CacheMissReason)); err != nil {
+			log.Warnf("Failed to export %s, error: %s", cacheMissReasonOutputKey, err)
+		}
+
+		if err := runner.outputExporter.ExportOutput(cacheSizeOutputKey, strconv.FormatInt(result.CacheSize, 10)); err != nil {
+			log.Warnf("Failed to export %s, error: %s", cacheSizeOutputKey, err)
+		}
+
+		if err := runner.outputExporter.ExportOutput(buildChangedOutputKey, strconv.FormatBool(result.BuildChanged)); err != nil {
+			log.Warnf("Failed to export %s, error: %s", buildChangedOutputKey, err)
+		}
+	}
+
+	if result.OutdatedDependencies != nil {
+		outdated, err := json.Marshal(result.OutdatedDependencies)
+		if err != nil {
+			log.Warnf("Failed to encode outdated dependencies, error: %s", err)
+		} else if err := runner.outputExporter.ExportOutput(outdatedOutputKey, string(outdated)); err != nil {
+			log.Warnf("Failed to export %s, error: %s", outdatedOutputKey, err)
+		}
+	}
+}
+
+func (runner Runner) run(ctx context.Context) (RunResult, error) {
+	result := RunResult{Command: runner.carthageCommand}
+	cacheRestored := false
+
+	if err := runner.checkFreeDiskSpace(); err != nil {
+		return result, withKind(ErrValidation, err)
+	}
+
+	if err := runner.prepareTempDir(); err != nil {
+		return result, withKind(ErrValidation, err)
+	}
 
 	if runner.carthageCommand == bootstrapCommand {
-		if runner.isCacheAvailable() {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		cacheAvailable := runner.isCacheAvailable()
+		if cacheAvailable && runner.isCacheCoveringPlatforms() {
 			log.Donef("Cache available")
 
+			if runner.opts.DisableCacheSave {
+				log.Donef("Using cached dependencies for bootstrap command, cache saving is disabled.")
+				result.CacheHit = true
+				return result, nil
+			}
+
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+
 			log.Infof("Committing Cachefile...")
 			err := runner.cache.Commit()
 			if err == nil {
 				log.Donef("Using cached dependencies for bootstrap command. If you would like to force update your dependencies, select `update` as CarthageCommand and re-run your build.")
-				return nil
+				result.CacheHit = true
+				result.CacheSize = runner.savedCacheSize()
+				return result, nil
 			}
 
 			log.Warnf("Cache collection skipped: %s", err)
-		} else {
+		} else if !cacheAvailable {
 			log.Warnf("Cache not available")
 		}
+
+		result.CacheMissReason = CacheMissForced
+		if !cacheAvailable {
+			result.CacheMissReason = runner.cacheMissReason()
+		}
+
+		cacheRestored = runner.isCacheRestored()
+		if !cacheRestored && runner.opts.StaleBuildDirMode != StaleBuildDirNone && runner.opts.StaleBuildDirMode != "" {
+			if err := runner.checkStaleBuildDir(runner.opts.StaleBuildDirMode); err != nil {
+				return result, err
+			}
+		}
+		if cacheRestored && runner.opts.VersionFileReconcileMode != VersionFileReconcileNone && runner.opts.VersionFileReconcileMode != "" {
+			log.Infof("Reconciling version files (%s)", runner.opts.VersionFileReconcileMode)
+			if err := runner.cache.ReconcileVersionFiles(runner.opts.VersionFileReconcileMode); err != nil {
+				log.Warnf("Failed to reconcile version files: %s", err)
+			}
+		}
+
+		if cacheRestored && runner.opts.MakeRestoredWritable {
+			if err := runner.cache.MakeBuildDirWritable(); err != nil {
+				log.Warnf("Failed to make the restored build dir writable: %s", err)
+			}
+		}
+
+		if !cacheRestored && !contains(runner.args, noCheckoutArg) && runner.isCheckoutsRestored() {
+			log.Donef("Restored checkouts match the %s, building them without checking out again", resolvedFileName)
+			runner.args = append(append([]string{}, runner.args...), noCheckoutArg)
+		}
 	}
 
-	if err := runner.perform(); err != nil {
+	var allDependenciesRestored bool
+	var missingDependencies []string
+	if runner.carthageCommand == bootstrapCommand && !cacheRestored && runner.opts.DependencyCache != nil {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		allDependenciesRestored, missingDependencies = runner.restoreDependencies()
+	}
+
+	buildLogPath := ""
+	if contains(getLogPathCommands(), runner.carthageCommand) {
+		runner.args, buildLogPath = withBuildLogPath(runner.args, runner.opts.BuildLogPath)
+	}
+
+	var buildDigest string
+	var buildDigestErr error
+	if runner.carthageCommand == bootstrapCommand {
+		if buildDigest, buildDigestErr = buildDirDigest(runner.buildDir()); buildDigestErr != nil {
+			log.Warnf("%s", buildDigestErr)
+		}
+	}
+
+	fullArgs := runner.args
+	if cacheRestored && len(runner.opts.ChangedDependencies) > 0 {
+		log.Infof("Building only the changed dependencies: %s", strings.Join(runner.opts.ChangedDependencies, ", "))
+		runner.args = append(append([]string{}, runner.args...), runner.opts.ChangedDependencies...)
+	}
+
+	if len(missingDependencies) > 0 {
+		runner.args = append(append([]string{}, runner.args...), missingDependencies...)
+	}
+
+	var output commandOutput
+	var err error
+	if allDependenciesRestored {
+		log.Donef("Every dependency is restored from the dependency cache, skipping the Carthage command")
+	} else {
+		output, err = runner.perform(ctx)
+	}
+	if err != nil && cacheRestored && hasIncompatibleSwiftVersionFailure(err) {
+		log.Warnf("Restored dependencies were built with an incompatible Swift version, discarding them and rebuilding from scratch...")
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if err := runner.cache.Invalidate(); err != nil {
+			return result, withKind(ErrCache, err)
+		}
+
+		runner.args = fullArgs
+		output, err = runner.perform(ctx)
+	}
+	if err != nil && runner.opts.DependencyRetry > 0 {
+		output, err = runner.retryFailedDependency(ctx, output, err)
+	}
+	result.output = output
+	result.BuiltDependencies = parseBuiltDependencies(output.stdout)
+	if runner.carthageCommand == outdatedCommand && err == nil {
+		result.OutdatedDependencies = parseOutdatedDependencies(output.stdout)
+	}
+	if runner.opts.ProblemMatcher {
+		runner.printAnnotations(output.diagnostics())
+	}
+
+	if err != nil {
+		if buildLogPath != "" && runner.opts.BuildLogTailLines > 0 {
+			printBuildLogTail(buildLogPath, runner.opts.BuildLogTailLines)
+		}
+
 		if runnerErr, ok := err.(*RunnerError); ok {
 			runnerErr.Err = fmt.Errorf("Carthage command failed, error: %s", runnerErr.Err)
+
+			if limited, resetTime := parseRateLimitFailure(runnerErr.Output); limited {
+				runnerErr.Err = fmt.Errorf("%s\n%s", runnerErr.Err, runner.rateLimitAdvice(resetTime))
+			}
 		}
 
-		return err
+		return result, err
+	}
+
+	if runner.carthageCommand == updateCommand && runner.opts.RequireResolvedFile {
+		if err := runner.checkResolvedFileCreated(); err != nil {
+			return result, withKind(ErrValidation, err)
+		}
+	}
+
+	warning, err := runner.checkNoSharedSchemes(output)
+	if err != nil {
+		return result, withKind(ErrValidation, err)
+	}
+	if warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
+
+	if runner.opts.RequireFrameworks && contains(archVerifiedCommands, runner.carthageCommand) {
+		if err := runner.checkPlatformFrameworks(); err != nil {
+			return result, withKind(ErrValidation, err)
+		}
+	}
+
+	if runner.opts.DuplicateFrameworksMode != DuplicateFrameworksNone && runner.opts.DuplicateFrameworksMode != "" && contains(archVerifiedCommands, runner.carthageCommand) {
+		warning, err := runner.checkDuplicateFrameworks()
+		if err != nil {
+			return result, withKind(ErrValidation, err)
+		}
+		if warning != "" {
+			result.Warnings = append(result.Warnings, warning)
+		}
+	}
+
+	if len(runner.opts.ExpectedArchs) > 0 && contains(archVerifiedCommands, runner.carthageCommand) {
+		if err := runner.verifyArchs(); err != nil {
+			return result, withKind(ErrValidation, err)
+		}
+	}
+
+	if runner.opts.ExpectedCodeSignature != "" && contains(archVerifiedCommands, runner.carthageCommand) {
+		if err := runner.verifyCodeSignatures(); err != nil {
+			return result, withKind(ErrValidation, err)
+		}
 	}
 
 	if runner.carthageCommand == bootstrapCommand {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		if !runner.opts.DisableCacheSave {
+			runner.shrinkBuildDir()
+
+			if runner.opts.DependencyCache != nil {
+				runner.saveDependencies()
+			}
+		}
+
+		// Shrinking and saving the dependencies may take long, the run may be aborted meanwhile.
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
 		log.Infof("Creating cache indicator")
 		if err := runner.cache.CreateIndicator(); err != nil {
-			return err
+			return result, withKind(ErrCache, err)
 		}
 
-		if err := runner.cache.Commit(); err != nil {
+		if runner.opts.DisableCacheSave {
+			log.Printf("Cache saving is disabled, skipping cache commit")
+		} else if err := runner.cache.Commit(); err != nil {
 			log.Warnf("Cache committing skipped: %s", err)
+		} else {
+			result.CacheSize = runner.savedCacheSize()
+		}
+
+		if buildDigestErr == nil {
+			if digest, err := buildDirDigest(runner.buildDir()); err != nil {
+				log.Warnf("%s", err)
+			} else {
+				result.BuildChanged = digest != buildDigest
+			}
 		}
 	}
 
+	return result, nil
+}
+
+func (runner Runner) savedCacheSize() int64 {
+	size, err := runner.cache.SavedSize()
+	if err != nil {
+		log.Warnf("Failed to determine the saved cache size: %s", err)
+		return 0
+	}
+
+	log.Printf("Saved cache size: %s", formatSize(size))
+	return size
+}
+
+func (runner Runner) buildDir() string {
+	return filepath.Join(runner.opts.ProjectDir, carthageDirName, buildDirName)
+}
+
+func (runner Runner) printAnnotations(output string) {
+	for _, annotation := range problemMatcherAnnotations(output) {
+		log.Printf("%s", annotation)
+	}
+}
+
+func (runner Runner) checkResolvedFileCreated() error {
+	pth := filepath.Join(runner.opts.ProjectDir, resolvedFileName)
+	if exists, err := pathutil.IsPathExists(pth); err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("the update command did not create %s at: %s", resolvedFileName, pth)
+	}
+
+	log.Donef("%s created: %s", resolvedFileName, pth)
 	return nil
 }
 
+// checkNoSharedSchemes returns the warning printed about the dependencies Carthage skipped for having no shared
+// framework schemes, or an error instead in NoSharedSchemesFail mode.
+func (runner Runner) checkNoSharedSchemes(output commandOutput) (string, error) {
+	skipped := parseNoSharedSchemesDependencies(output.all())
+	if len(skipped) == 0 {
+		return "", nil
+	}
+
+	message := fmt.Sprintf("Carthage skipped building dependencies without shared framework schemes, their frameworks are missing: %s", strings.Join(skipped, ", "))
+	if runner.opts.NoSharedSchemesMode == NoSharedSchemesFail {
+		return "", fmt.Errorf("%s", message)
+	}
+
+	log.Warnf("%s", message)
+	return message, nil
+}
+
+func (runner Runner) verifyArchs() error {
+	info := runner.lipoInfo
+	if info == nil {
+		info = lipoInfo
+	}
+
+	log.Infof("Verifying the architectures of the built frameworks: %s", strings.Join(runner.opts.ExpectedArchs, ", "))
+	if err := verifyArchs(runner.buildDir(), runner.opts.ExpectedArchs, info); err != nil {
+		return err
+	}
+	log.Donef("Every built framework has the expected architectures")
+	return nil
+}
+
+func (runner Runner) checkFreeDiskSpace() error {
+	if runner.opts.MinFreeDiskMB == 0 {
+		return nil
+	}
+
+	freeBytes, err := runner.freeDiskSpace(runner.opts.ProjectDir)
+	if err != nil {
+		log.Warnf("Failed to check free disk space, error: %s", err)
+		return nil
+	}
+
+	freeMB := freeBytes / (1024 * 1024)
+	if freeMB >= runner.opts.MinFreeDiskMB {
+		log.Printf("Free disk space: %d MB", freeMB)
+		return nil
+	}
+
+	message := fmt.Sprintf("only %d MB free disk space available, at least %d MB expected", freeMB, runner.opts.MinFreeDiskMB)
+	if runner.opts.FailOnLowDiskSpace {
+		return fmt.Errorf("%s", message)
+	}
+
+	log.Warnf("Low disk space: %s", message)
+	return nil
+}
+
+func (runner Runner) prepareTempDir() error {
+	if runner.opts.TempDir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(runner.opts.TempDir, 0755); err != nil {
+		return fmt.Errorf("failed to create temp dir (%s), error: %s", runner.opts.TempDir, err)
+	}
+
+	file, err := os.CreateTemp(runner.opts.TempDir, ".write-check")
+	if err != nil {
+		return fmt.Errorf("temp dir (%s) is not writable, error: %s", runner.opts.TempDir, err)
+	}
+	if err := file.Close(); err != nil {
+		log.Warnf("Failed to close %s, error: %s", file.Name(), err)
+	}
+	if err := os.Remove(file.Name()); err != nil {
+		log.Warnf("Failed to remove %s, error: %s", file.Name(), err)
+	}
+
+	log.Printf("Using temp dir: %s", runner.opts.TempDir)
+	return nil
+}
+
+func (runner Runner) rateLimitAdvice(resetTime *time.Time) string {
+	advice := "GitHub API rate limit exceeded."
+	if runner.githubAccessToken == "" {
+		advice += " Set the `github_access_token` input to raise the rate limit."
+	}
+
+	if resetTime != nil {
+		advice += fmt.Sprintf(" The rate limit resets at %s, re-run the build after that.", resetTime.UTC().Format(time.RFC3339))
+	} else {
+		advice += " Wait for the rate limit to reset and re-run the build."
+	}
+
+	return advice
+}
+
 func (runner Runner) isCacheAvailable() bool {
 	log.Infof("Check if cache is available")
 
@@ -115,47 +763,248 @@ func (runner Runner) isCacheAvailable() bool {
 	return cacheAvailable
 }
 
-func (runner Runner) perform() error {
-	var function = runner.executeCommand
+// checkPlatformFrameworks fails if no framework was built for a platform of the `--platform` argument.
+func (runner Runner) checkPlatformFrameworks() error {
+	platforms := requestedPlatforms(runner.args)
+	if len(platforms) == 0 {
+		return nil
+	}
+
+	empty, err := Project{projectDir: runner.opts.ProjectDir}.emptyPlatforms(platforms)
+	if err != nil {
+		return fmt.Errorf("failed to check the built frameworks of the platforms, error: %s", err)
+	}
+	if len(empty) > 0 {
+		return fmt.Errorf("no frameworks were built for the requested platforms: %s", strings.Join(empty, ", "))
+	}
+
+	log.Donef("Frameworks were built for every requested platform: %s", strings.Join(platforms, ", "))
+	return nil
+}
+
+// isCacheCoveringPlatforms returns if the cached build dir contains every platform of the `--platform` argument.
+func (runner Runner) isCacheCoveringPlatforms() bool {
+	platforms := requestedPlatforms(runner.args)
+	if len(platforms) == 0 {
+		return true
+	}
+
+	missing, err := runner.cache.MissingPlatforms(platforms)
+	if err != nil {
+		log.Warnf("Failed to check the cached platforms, error: %s", err)
+		return true
+	}
+
+	if len(missing) > 0 {
+		log.Warnf("The cache does not contain the requested platforms: %s, rebuilding the dependencies", strings.Join(missing, ", "))
+		return false
+	}
+
+	return true
+}
+
+func (runner Runner) cacheMissReason() CacheMissReason {
+	reason, err := runner.cache.MissReason()
+	if err != nil {
+		log.Warnf("Failed to determine why the cache is not available, error: %s", err)
+		return ""
+	}
+
+	log.Printf("Cache miss reason: %s", reason)
+	return reason
+}
+
+func (runner Runner) isCacheRestored() bool {
+	restored, err := runner.cache.IsRestored()
+	if err != nil {
+		log.Warnf("Failed to check if cache is restored, error: %s", err)
+	}
+
+	return restored
+}
+
+func (runner Runner) isCheckoutsRestored() bool {
+	restored, err := runner.cache.CheckoutsRestored()
+	if err != nil {
+		log.Warnf("Failed to check restored checkouts, error: %s", err)
+	}
+
+	return restored
+}
+
+func (runner Runner) perform(ctx context.Context) (commandOutput, error) {
+	var function = func() (commandOutput, error) {
+		return runner.executeCommand(ctx, runner.args)
+	}
 
 	if contains(getRetryableCommands(), runner.carthageCommand) {
-		function = func() error {
-			return retry.Times(1).Wait(3 * time.Second).TryWithAbort(func(attempt uint) (error, bool) {
+		function = func() (commandOutput, error) {
+			var output commandOutput
+			err := retry.Times(1).Wait(3 * time.Second).TryWithAbort(func(attempt uint) (error, bool) {
+				args := runner.args
 				if attempt > 0 {
 					log.Warnf("Carthage %s (possible) network failure, retrying ...", runner.carthageCommand)
+					args = withVerboseArg(args)
 				}
 
-				err := runner.executeCommand()
+				var err error
+				output, err = runner.executeCommand(ctx, args)
 
-				return err, !hasRetryableFailure(err)
+				return err, ctx.Err() != nil || !hasRetryableFailure(err)
 			})
+			return output, err
 		}
 	}
 
 	return function()
 }
 
-func (runner Runner) executeCommand() error {
+// retryFailedDependency re-builds the dependency failed to build on its own, then re-runs the whole command,
+// up to DependencyRetry times.
+func (runner Runner) retryFailedDependency(ctx context.Context, output commandOutput, err error) (commandOutput, error) {
+	for attempt := uint(1); attempt <= runner.opts.DependencyRetry; attempt++ {
+		dependency, ok := parseFailedDependency(err)
+		if !ok || ctx.Err() != nil {
+			break
+		}
+
+		log.Warnf("Building %s failed, retrying only this dependency (%d/%d) ...", dependency, attempt, runner.opts.DependencyRetry)
+		args := append(append([]string{}, runner.args...), dependency)
+		if _, err = runner.executeCommand(ctx, args); err != nil {
+			continue
+		}
+
+		log.Donef("%s built, re-running the Carthage command", dependency)
+		output, err = runner.executeCommand(ctx, runner.args)
+		if err == nil {
+			break
+		}
+	}
+
+	return output, err
+}
+
+// executeCommand runs the Carthage command with the given arguments, streaming its output to the console,
+// and returns the captured output for the post-run analysis.
+func (runner Runner) executeCommand(ctx context.Context, args []string) (commandOutput, error) {
 	log.Infof("Running Carthage command")
 
 	builder := runner.commandBuilder.
 		AddGitHubToken(runner.githubAccessToken).
 		AddXCConfigFile(runner.xcconfigPath).
 		Append(runner.carthageCommand).
-		Append(runner.args...)
-	var stderrBuf bytes.Buffer
+		Append(args...)
+	locale := runner.opts.Locale
+	if locale == "" {
+		locale = defaultLocale
+	}
+	builder = builder.AddEnv("LANG", locale).AddEnv("LC_ALL", locale)
+	if runner.opts.TempDir != "" {
+		builder = builder.AddEnv("TMPDIR", runner.opts.TempDir)
+	}
+	for _, proxy := range []struct{ key, value string }{
+		{"http_proxy", runner.opts.HTTPProxy},
+		{"https_proxy", runner.opts.HTTPSProxy},
+		{"no_proxy", runner.opts.NoProxy},
+	} {
+		if proxy.value != "" {
+			builder = builder.AddEnv(proxy.key, proxy.value).AddEnv(strings.ToUpper(proxy.key), proxy.value)
+		}
+	}
+	if runner.opts.GitCredentialHelper != "" {
+		for key, value := range gitConfigEnvs(os.Getenv("GIT_CONFIG_COUNT"), "credential.helper", runner.opts.GitCredentialHelper) {
+			builder = builder.AddEnv(key, value)
+		}
+	}
+	stdout, stderr := runner.consoleWriters()
+	stdoutBuf, stderrBuf := newOutputBuffer(maxCapturedOutputSize), newOutputBuffer(maxCapturedOutputSize)
+	stdoutWriters, stderrWriters := []io.Writer{stdout, stdoutBuf}, []io.Writer{stderr, stderrBuf}
+	var combinedBuf *outputBuffer
+	if !runner.opts.SeparateOutputStreams {
+		combinedBuf = newOutputBuffer(maxCapturedOutputSize)
+		stdoutWriters, stderrWriters = append(stdoutWriters, combinedBuf), append(stderrWriters, combinedBuf)
+	}
+	var progressTimer *buildProgressTimer
+	if runner.opts.JUnitReportPath != "" {
+		progressTimer = newBuildProgressTimer()
+		stdoutWriters = append(stdoutWriters, progressTimer)
+	}
+	if runner.opts.LogStreamURL != "" {
+		stream := newLogStream(runner.opts.LogStreamURL, runner.opts.LogStreamClient, append([]string{string(runner.githubAccessToken)}, runner.opts.LogStreamSecrets...))
+		defer func() {
+			if err := stream.Close(); err != nil {
+				log.Warnf("Failed to close the log stream, error: %s", err)
+			}
+		}()
+		stdoutWriters, stderrWriters = append(stdoutWriters, stream), append(stderrWriters, stream)
+	}
 
-	cmd := builder.Command(os.Stdout, io.MultiWriter(os.Stderr, &stderrBuf))
+	cmd := builder.Command(ctx, io.MultiWriter(stdoutWriters...), io.MultiWriter(stderrWriters...))
+
+	if runner.opts.RaiseOpenFilesLimit {
+		defer runner.applyOpenFilesLimit()()
+	}
 
 	log.Donef("$ %s", cmd.PrintableCommandArgs())
 
-	err := cmd.Run()
+	var err error
+	if runner.opts.CPUPriority > 0 {
+		err = runner.runWithCPUPriority(cmd)
+	} else {
+		err = cmd.Run()
+	}
+	output := commandOutput{stdout: stdoutBuf.String(), stderr: stderrBuf.String()}
+	if combinedBuf != nil {
+		output.combined = combinedBuf.String()
+	}
+	if progressTimer != nil {
+		output.schemeBuilds = progressTimer.builds()
+	}
 
 	if err == nil {
-		return nil
+		return output, nil
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return output, fmt.Errorf("Carthage command aborted: %w", ctxErr)
+	}
+
+	return output, &RunnerError{output.diagnostics(), err}
+}
+
+// gitConfigEnvs returns the `GIT_CONFIG_*` envs adding the config entry after the ones already passed in the envs.
+func gitConfigEnvs(existingCount, key, value string) map[string]string {
+	index, err := strconv.Atoi(existingCount)
+	if err != nil || index < 0 {
+		index = 0
+	}
+
+	return map[string]string{
+		"GIT_CONFIG_COUNT":                        strconv.Itoa(index + 1),
+		fmt.Sprintf("GIT_CONFIG_KEY_%d", index):   key,
+		fmt.Sprintf("GIT_CONFIG_VALUE_%d", index): value,
+	}
+}
+
+func (runner Runner) consoleWriters() (io.Writer, io.Writer) {
+	stdout, stderr := runner.stdout, runner.stderr
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	return stdout, stderr
+}
+
+// withVerboseArg returns the arguments extended with `--verbose`, so a retried attempt's logs are more diagnostic.
+func withVerboseArg(args []string) []string {
+	if contains(args, verboseArg) {
+		return args
 	}
 
-	return &RunnerError{stderrBuf.String(), err}
+	log.Printf("Enabling verbose Carthage output for the retry")
+	return append(append([]string{}, args...), verboseArg)
 }
 
 func contains(slice []string, value string) bool {
@@ -2,13 +2,27 @@ package cachedcarthage
 
 import (
 	"errors"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// RunnerError ...
+// The kinds of Runner failures, the returned errors can be matched against them with errors.Is.
+var (
+	// ErrValidation means the run's preconditions (like the free disk space or the temp dir) are not met,
+	// or the build is incomplete (like a built framework missing an expected architecture).
+	ErrValidation = errors.New("validation failed")
+	// ErrCarthageFailed means the Carthage command exited with an error.
+	ErrCarthageFailed = errors.New("carthage command failed")
+	// ErrCache means the cache could not be restored, created or was required but not available.
+	ErrCache = errors.New("cache failed")
+)
+
+// RunnerError is a failed Carthage command, its Output is the output scanned for the known failures.
 type RunnerError struct {
 	Output string
-	Err error
+	Err    error
 }
 
 // Error ...
@@ -16,6 +30,39 @@ func (e *RunnerError) Error() string {
 	return e.Err.Error()
 }
 
+// Is reports the RunnerError as an ErrCarthageFailed.
+func (e *RunnerError) Is(target error) bool {
+	return target == ErrCarthageFailed
+}
+
+// kindError attaches one of the Runner failure kinds to an error, keeping its message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func withKind(kind error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// Error ...
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap ...
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+// Is ...
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
 func getRetryableCommands() []string {
 	return []string{bootstrapCommand, updateCommand}
 }
@@ -24,13 +71,82 @@ func getErrorSlices() []string {
 	return []string{"failed to connect to", "timed out"}
 }
 
+var rateLimitResetPattern = regexp.MustCompile(`(?i)x-ratelimit-reset:?\s*(\d+)`)
+
+// incompatibleSwiftVersionPattern matches the failures of a cached framework built with an other Swift compiler:
+// Carthage's own check, and xcodebuild rejecting the framework's Swift module.
+var incompatibleSwiftVersionPattern = regexp.MustCompile(`(?i)incompatible swift version|module compiled with swift \S+ cannot be imported by the swift \S+ compiler|compiled module was created by a (different|newer|older) version of the compiler`)
+
+func getRateLimitSlices() []string {
+	return []string{"rate limit exceeded", "403 forbidden", "http 403"}
+}
+
+// parseRateLimitFailure returns if the output indicates a GitHub rate limit failure and the time the limit resets, if printed.
+func parseRateLimitFailure(output string) (bool, *time.Time) {
+	lowerOutput := strings.ToLower(output)
+
+	limited := false
+	for _, slice := range getRateLimitSlices() {
+		if strings.Contains(lowerOutput, slice) {
+			limited = true
+			break
+		}
+	}
+	if !limited {
+		return false, nil
+	}
+
+	match := rateLimitResetPattern.FindStringSubmatch(output)
+	if match == nil {
+		return true, nil
+	}
+
+	timestamp, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return true, nil
+	}
+
+	resetTime := time.Unix(timestamp, 0)
+	return true, &resetTime
+}
+
+// xcodebuildFailurePattern matches the failed xcodebuild invocation Carthage prints, like:
+// /usr/bin/xcrun xcodebuild -workspace /Users/vagrant/git/Carthage/Checkouts/Alamofire/Alamofire.xcworkspace -scheme "Alamofire iOS" ...
+var xcodebuildFailurePattern = regexp.MustCompile(`xcodebuild .*?Carthage/Checkouts/([^/\s"]+)/`)
+
+// parseFailedDependency returns the dependency whose xcodebuild invocation failed.
+func parseFailedDependency(err error) (string, bool) {
+	var runnerError *RunnerError
+
+	if !errors.As(err, &runnerError) {
+		return "", false
+	}
+
+	match := xcodebuildFailurePattern.FindStringSubmatch(runnerError.Output)
+	if match == nil {
+		return "", false
+	}
+
+	return match[1], true
+}
+
+func hasIncompatibleSwiftVersionFailure(err error) bool {
+	var runnerError *RunnerError
+
+	if errors.As(err, &runnerError) {
+		return incompatibleSwiftVersionPattern.MatchString(runnerError.Output)
+	}
+
+	return false
+}
+
 func hasRetryableFailure(err error) bool {
 	var runnerError *RunnerError
 
 	if errors.As(err, &runnerError) {
 		output := strings.ToLower(runnerError.Output)
 
-		for _, string := range getErrorSlices(){
+		for _, string := range getErrorSlices() {
 			if strings.Contains(output, string) {
 				return true
 			}
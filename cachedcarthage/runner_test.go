@@ -1,17 +1,29 @@
 package cachedcarthage
 
 import (
+	"bytes"
+	"context"
 	"errors"
-	"github.com/stretchr/testify/mock"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // The first part writes the given string to stderr and the second part provides the exit code 1.
-const(
-	failingCommandWithTimeoutStderr = "echo timed out 1>&2 && false"
+const (
+	failingCommandWithTimeoutStderr           = "echo timed out 1>&2 && false"
 	failingCommandWithFailedToConnectToStderr = "echo failed to connect to 1>&2 && false"
+	failingCommandWithRateLimitStderr         = "echo GitHub API request failed: API rate limit exceeded for 1.2.3.4. X-RateLimit-Reset: 1700000000 1>&2 && false"
+	failingCommandWithIncompatibleSwiftStderr = "echo Incompatible Swift version - framework was built with 5.1 and the local version is 5.2 1>&2 && false"
+	failingCommandWithXcodebuildFailureStderr = "echo Task failed with exit code 65: /usr/bin/xcrun xcodebuild -workspace /tmp/Carthage/Checkouts/Alamofire/Alamofire.xcworkspace -scheme Alamofire 1>&2 && false"
 )
 
 // Run
@@ -23,6 +35,7 @@ func Test_GivenNotBootstrapCommand_WhenRunCalled_ThenExpectNoErrorAndCacheNotCre
 		carthageCommand: "version",
 		cache:           mockCarthageCache,
 		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
 	}
 
 	// When
@@ -40,11 +53,15 @@ func Test_GivenBootstrapCommandAndCacheNotAvailableAndCacheCreateFails_WhenRunCa
 	expectedError := errors.New("sad error")
 	mockCarthageCache := givenMockCarthageCache().
 		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false).
 		GivenCreateIndicatorFails(expectedError)
 	runner := Runner{
 		carthageCommand: "bootstrap",
 		cache:           mockCarthageCache,
 		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  givenStubbedOutputExporter(),
 	}
 
 	// When
@@ -52,18 +69,24 @@ func Test_GivenBootstrapCommandAndCacheNotAvailableAndCacheCreateFails_WhenRunCa
 
 	// Then
 	assert.EqualError(t, expectedError, error.Error())
+	assert.ErrorIs(t, error, ErrCache)
 }
 
 func Test_GivenBootstrapCommandAndCacheNotAvailableAndCacheCreateSucceeds_WhenRunCalled_ThenExpectNoError(t *testing.T) {
 	// Given
 	mockCarthageCache := givenMockCarthageCache().
 		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false).
 		GivenCreateIndicatorSucceeds().
-		GivenCommitSucceeds()
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
 	runner := Runner{
 		carthageCommand: "bootstrap",
 		cache:           mockCarthageCache,
 		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  givenStubbedOutputExporter(),
 	}
 
 	// When
@@ -79,6 +102,7 @@ func Test_GivenBootstrapCommandAndCacheAvailableAndCollectFails_WhenRunCalled_Th
 	// Given
 	mockCarthageCache := givenMockCarthageCache().
 		GivenIsAvailableSucceeds(true).
+		GivenIsRestoredSucceeds(true).
 		GivenCommitFails(errors.New("sad error")).
 		GivenCreateIndicatorSucceeds()
 
@@ -88,6 +112,7 @@ func Test_GivenBootstrapCommandAndCacheAvailableAndCollectFails_WhenRunCalled_Th
 		carthageCommand: "bootstrap",
 		cache:           mockCarthageCache,
 		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
 	}
 
 	// When
@@ -103,13 +128,15 @@ func Test_GivenBootstrapCommandAndCacheAvailableAndCollectSucceeds_WhenRunCalled
 	// Given
 	mockCarthageCache := givenMockCarthageCache().
 		GivenIsAvailableSucceeds(true).
-		GivenCommitSucceeds()
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
 
 	mockCommandBuilder := givenStubbedCommandBuilderReturnFailingCommand()
 	runner := Runner{
 		carthageCommand: "bootstrap",
 		cache:           mockCarthageCache,
 		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
 	}
 
 	// When
@@ -161,7 +188,8 @@ func Test_GivenBootstrapCommandAndPermanentNetworkFailure_WhenRunCalled_ThenExpe
 	error := runner.Run()
 
 	// Then
-	assert.Error(t, error)
+	assert.ErrorIs(t, error, ErrCarthageFailed)
+	assert.NotErrorIs(t, error, ErrCache)
 }
 
 func Test_GivenUpdateCommandAndSingleNetworkFailure_WhenRunCalled_ThenExpectCommandToBeRetriedAndSucceed(t *testing.T) {
@@ -206,112 +234,1817 @@ func Test_GivenUpdateCommandAndPermanentNetworkFailure_WhenRunCalled_ThenExpectC
 	assert.Error(t, error)
 }
 
-// isCacheAvailable
-func Test_GivenCarthageCacheAvailableFails_WhenIsCacheAvailableCalled_ThenExpectFalse(t *testing.T) {
+func Test_GivenBootstrapCommandAndSingleNetworkFailure_WhenRunCalled_ThenExpectOnlyRetryToBeVerbose(t *testing.T) {
 	// Given
-	mockCarthageCache := givenMockCarthageCache().
-		GivenIsAvailableFails(errors.New("whatever"))
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "bash",
+			Arguments: []string{"-c", failingCommandWithTimeoutStderr},
+		},
+		{
+			Command:   "echo",
+			Arguments: []string{"hello"},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", blueprints)
+	runner.args = []string{"--platform", "iOS"}
+	mockCommandBuilder := runner.commandBuilder.(*MockCommandBuilder)
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	assert.Equal(t, [][]string{
+		{"bootstrap"},
+		{"--platform", "iOS"},
+		{"bootstrap"},
+		{"--platform", "iOS", "--verbose"},
+	}, appendedArgs(mockCommandBuilder))
+	assert.Equal(t, []string{"--platform", "iOS"}, runner.args)
+}
+
+func Test_GivenVerboseArgAlreadySet_WhenWithVerboseArgCalled_ThenExpectArgsUnchanged(t *testing.T) {
+	// Given
+	args := []string{"--verbose", "--platform", "iOS"}
+
+	// When
+	actual := withVerboseArg(args)
+
+	// Then
+	assert.Equal(t, args, actual)
+}
+
+// Rate limit
+func Test_GivenRateLimitFailureAndNoToken_WhenRunCalled_ThenExpectTokenAndResetTimeAdvice(t *testing.T) {
+	// Given
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "bash",
+			Arguments: []string{"-c", failingCommandWithRateLimitStderr},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("update", blueprints)
+
+	// When
+	error := runner.Run()
+
+	// Then
+	require.Error(t, error)
+	assert.Contains(t, error.Error(), "GitHub API rate limit exceeded.")
+	assert.Contains(t, error.Error(), "Set the `github_access_token` input to raise the rate limit.")
+	assert.Contains(t, error.Error(), "The rate limit resets at 2023-11-14T22:13:20Z, re-run the build after that.")
+}
+
+func Test_GivenRateLimitFailureAndToken_WhenRunCalled_ThenExpectOnlyWaitAdvice(t *testing.T) {
+	// Given
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "bash",
+			Arguments: []string{"-c", "echo HTTP 403 rate limit 1>&2 && false"},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("update", blueprints)
+	runner.githubAccessToken = "token"
+
+	// When
+	error := runner.Run()
+
+	// Then
+	require.Error(t, error)
+	assert.Contains(t, error.Error(), "GitHub API rate limit exceeded. Wait for the rate limit to reset and re-run the build.")
+	assert.NotContains(t, error.Error(), "github_access_token")
+}
+
+// Rebuild on incompatible Swift version
+func Test_GivenXcodebuildSwiftModuleFailure_WhenHasIncompatibleSwiftVersionFailureCalled_ThenExpectTrue(t *testing.T) {
+	for _, output := range []string{
+		"/Users/vagrant/git/App/ViewController.swift:2:8: error: module compiled with Swift 5.1.3 cannot be imported by the Swift 5.3 compiler: /Users/vagrant/git/Carthage/Build/iOS/Alamofire.framework/Modules/Alamofire.swiftmodule/arm64-apple-ios.swiftmodule",
+		"/Users/vagrant/git/App/ViewController.swift:2:8: error: compiled module was created by a newer version of the compiler: /Users/vagrant/git/Carthage/Build/iOS/Alamofire.framework/Modules/Alamofire.swiftmodule/arm64.swiftmodule",
+		"Incompatible Swift version - framework was built with 5.1 and the local version is 5.2",
+	} {
+		// Given
+		err := &RunnerError{Output: "** BUILD FAILED **\n" + output + "\n", Err: errors.New("exit status 1")}
+
+		// When
+		incompatible := hasIncompatibleSwiftVersionFailure(err)
+
+		// Then
+		assert.True(t, incompatible, output)
+	}
+}
+
+func Test_GivenOtherBuildFailure_WhenHasIncompatibleSwiftVersionFailureCalled_ThenExpectFalse(t *testing.T) {
+	// Given
+	err := &RunnerError{Output: "error: no such module 'Alamofire'\n** BUILD FAILED **\n", Err: errors.New("exit status 1")}
+
+	// When
+	incompatible := hasIncompatibleSwiftVersionFailure(err)
+
+	// Then
+	assert.False(t, incompatible)
+}
 
+func Test_GivenBootstrapCommandAndRestoredCacheWithIncompatibleSwiftVersion_WhenRunCalled_ThenExpectCleanRebuild(t *testing.T) {
+	// Given
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "bash",
+			Arguments: []string{"-c", failingCommandWithIncompatibleSwiftStderr},
+		},
+		{
+			Command:   "echo",
+			Arguments: []string{"hello"},
+		},
+	}
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(true).
+		GivenInvalidateSucceeds().
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	mockCommandBuilder := givenStubbedCommandBuilderReturnsCommands(blueprints)
 	runner := Runner{
-		cache: mockCarthageCache,
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
 	}
 
 	// When
-	available := runner.isCacheAvailable()
+	error := runner.Run()
 
 	// Then
-	assert.False(t, available)
+	assert.NoError(t, error)
+	mockCarthageCache.AssertCalled(t, "Invalidate")
+	mockCommandBuilder.AssertNumberOfCalls(t, "Command", 2)
 }
 
-func Test_GivenCarthageCacheAvailableSucceeds_WhenIsCacheAvailableCalled_ThenExpectResult(t *testing.T) {
+func Test_GivenBootstrapCommandAndNoRestoredCacheWithIncompatibleSwiftVersion_WhenRunCalled_ThenExpectError(t *testing.T) {
 	// Given
-	expectedAvailable := true
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "bash",
+			Arguments: []string{"-c", failingCommandWithIncompatibleSwiftStderr},
+		},
+	}
 	mockCarthageCache := givenMockCarthageCache().
-		GivenIsAvailableSucceeds(expectedAvailable)
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false)
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands(blueprints),
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.Error(t, error)
+	mockCarthageCache.AssertNotCalled(t, "Invalidate")
+}
 
+// Version files
+func Test_GivenRestoredCacheAndVersionFileReconcileMode_WhenRunCalled_ThenExpectVersionFilesReconciled(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(true).
+		GivenReconcileVersionFilesSucceeds().
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
 	runner := Runner{
-		cache: mockCarthageCache,
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{VersionFileReconcileMode: VersionFileReconcileValidate},
 	}
 
 	// When
-	available := runner.isCacheAvailable()
+	error := runner.Run()
 
 	// Then
-	assert.Equal(t, expectedAvailable, available)
+	assert.NoError(t, error)
+	mockCarthageCache.AssertCalled(t, "ReconcileVersionFiles", VersionFileReconcileValidate)
 }
 
-// ecxecuteCommand
-func Test_GivenCommadSucceeds_WhenExecuteCommandCalled_ThenExpectNoError(t *testing.T) {
+// Writable restored build dir
+func Test_GivenRestoredCacheAndMakeRestoredWritable_WhenRunCalled_ThenExpectBuildDirMadeWritable(t *testing.T) {
 	// Given
-	mockCommandBuilder := givenStubbedCommandBuilder()
-	command := "version"
-	args := []string{"arg1"}
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(true).
+		GivenMakeBuildDirWritableSucceeds().
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
 	runner := Runner{
-		carthageCommand: command,
-		args:            args,
-		commandBuilder:  mockCommandBuilder,
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{MakeRestoredWritable: true},
 	}
 
 	// When
-	error := runner.executeCommand()
+	error := runner.Run()
 
 	// Then
 	assert.NoError(t, error)
-	mockCommandBuilder.AssertCalled(t, "AddGitHubToken", mock.Anything)
-	mockCommandBuilder.AssertCalled(t, "AddXCConfigFile", mock.Anything)
-	mockCommandBuilder.AssertCalled(t, "Append", []string{command})
-	mockCommandBuilder.AssertCalled(t, "Append", args)
+	mockCarthageCache.AssertCalled(t, "MakeBuildDirWritable")
 }
 
-// helpers
-func givenMockCarthageCache() *MockCarthageCache {
-	return new(MockCarthageCache)
+func Test_GivenRestoredCacheWithoutMakeRestoredWritable_WhenRunCalled_ThenExpectBuildDirUntouched(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(true).
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	mockCarthageCache.AssertNotCalled(t, "MakeBuildDirWritable")
 }
 
-func givenStubbedCommandBuilder() *MockCommandBuilder {
-	blueprint := CommandBlueprint{
-		Command:   "echo",
-		Arguments: []string{"hello"},
+// Changed dependencies
+func Test_GivenRestoredCacheAndChangedDependencies_WhenRunCalled_ThenExpectOnlyChangedDependenciesBuilt(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissResolvedChanged).
+		GivenIsRestoredSucceeds(true).
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		args:            []string{"--platform", "iOS"},
+		cache:           mockCarthageCache,
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{ChangedDependencies: []string{"Alamofire", "Firebase"}},
 	}
-	mockCommandBuilder := new(MockCommandBuilder).
-		GivenAddGitHubTokenSucceeds().
-		GivenAddXCConfigFileSucceeds().
-		GivenAppendSucceeds().
-		GivenCommandReturned(blueprint)
-	return mockCommandBuilder
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	assert.Equal(t, [][]string{
+		{"bootstrap"},
+		{"--platform", "iOS", "Alamofire", "Firebase"},
+	}, appendedArgs(mockCommandBuilder))
+	mockCarthageCache.AssertCalled(t, "CreateIndicator")
 }
 
-func givenStubbedCommandBuilderReturnFailingCommand() *MockCommandBuilder {
-	blueprint := CommandBlueprint{
-		Command:   "fail",
-		Arguments: nil,
+func Test_GivenNoRestoredCacheAndChangedDependencies_WhenRunCalled_ThenExpectEveryDependencyBuilt(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false).
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		args:            []string{"--platform", "iOS"},
+		cache:           mockCarthageCache,
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{ChangedDependencies: []string{"Alamofire"}},
 	}
-	mockCommandBuilder := new(MockCommandBuilder).
-		GivenAddGitHubTokenSucceeds().
-		GivenAddXCConfigFileSucceeds().
-		GivenAppendSucceeds().
-		GivenCommandReturned(blueprint)
-	return mockCommandBuilder
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	assert.Equal(t, [][]string{
+		{"bootstrap"},
+		{"--platform", "iOS"},
+	}, appendedArgs(mockCommandBuilder))
 }
 
-func givenRunnerWithMainAndCommandBuilderCommands(mainCommand string, commandBlueprints []CommandBlueprint) Runner {
+// Restored checkouts
+func Test_GivenRestoredCheckoutsMatchingResolved_WhenRunCalled_ThenExpectNoCheckoutArg(t *testing.T) {
+	// Given
 	mockCarthageCache := givenMockCarthageCache().
 		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(true).
 		GivenCreateIndicatorSucceeds().
-		GivenCommitSucceeds()
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		args:            []string{"--platform", "iOS"},
+		cache:           mockCarthageCache,
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+	}
 
-	return Runner{
-		carthageCommand: mainCommand,
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	assert.Equal(t, [][]string{
+		{"bootstrap"},
+		{"--platform", "iOS", "--no-checkout"},
+	}, appendedArgs(mockCommandBuilder))
+}
+
+func Test_GivenRestoredCheckoutsNotMatchingResolved_WhenRunCalled_ThenExpectCheckout(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false).
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		args:            []string{"--platform", "iOS"},
 		cache:           mockCarthageCache,
-		commandBuilder:  givenStubbedCommandBuilderReturnsCommands(commandBlueprints),
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
 	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	assert.Equal(t, [][]string{
+		{"bootstrap"},
+		{"--platform", "iOS"},
+	}, appendedArgs(mockCommandBuilder))
 }
 
-func givenStubbedCommandBuilderReturnsCommands(commandBlueprints []CommandBlueprint) *MockCommandBuilder {
-	mockCommandBuilder := new(MockCommandBuilder).
-		GivenAddGitHubTokenSucceeds().
-		GivenAddXCConfigFileSucceeds().
-		GivenAppendSucceeds().
-		GivenCommandsReturned(commandBlueprints)
-	return mockCommandBuilder
-}
\ No newline at end of file
+// Dependency retry
+func Test_GivenDependencyFailingOnce_WhenRunCalled_ThenExpectDependencyRetriedAndCommandRerun(t *testing.T) {
+	// Given
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "bash",
+			Arguments: []string{"-c", failingCommandWithXcodebuildFailureStderr},
+		},
+		{
+			Command:   "echo",
+			Arguments: []string{"*** Building scheme \"Alamofire iOS\" in Alamofire.xcworkspace"},
+		},
+		{
+			Command:   "echo",
+			Arguments: []string{"hello"},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("build", blueprints)
+	runner.args = []string{"--platform", "iOS"}
+	runner.opts.DependencyRetry = 2
+	mockCommandBuilder := runner.commandBuilder.(*MockCommandBuilder)
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	assert.Equal(t, [][]string{
+		{"build"},
+		{"--platform", "iOS"},
+		{"build"},
+		{"--platform", "iOS", "Alamofire"},
+		{"build"},
+		{"--platform", "iOS"},
+	}, appendedArgs(mockCommandBuilder))
+}
+
+func Test_GivenDependencyFailingAndNoDependencyRetry_WhenRunCalled_ThenExpectCommandToFail(t *testing.T) {
+	// Given
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "bash",
+			Arguments: []string{"-c", failingCommandWithXcodebuildFailureStderr},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("build", blueprints)
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.Error(t, error)
+	runner.commandBuilder.(*MockCommandBuilder).AssertNumberOfCalls(t, "Command", 1)
+}
+
+// Locale
+func Test_GivenLocale_WhenRunCalled_ThenExpectLocaleEnvsSet(t *testing.T) {
+	// Given
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{Locale: "hu_HU.UTF-8"},
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "LANG", "hu_HU.UTF-8")
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "LC_ALL", "hu_HU.UTF-8")
+}
+
+func Test_GivenNoLocale_WhenRunCalled_ThenExpectDefaultLocaleEnvsSet(t *testing.T) {
+	// Given
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "LANG", "en_US.UTF-8")
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "LC_ALL", "en_US.UTF-8")
+}
+
+// Temp dir
+func Test_GivenTempDir_WhenRunCalled_ThenExpectTempDirCreatedAndSetAsTMPDIR(t *testing.T) {
+	// Given
+	tempDir := filepath.Join(givenTempDir(t), "carthage-tmp")
+	defer func() {
+		require.NoError(t, os.RemoveAll(filepath.Dir(tempDir)))
+	}()
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{TempDir: tempDir},
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	assert.DirExists(t, tempDir)
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "TMPDIR", tempDir)
+}
+
+func Test_GivenNoTempDir_WhenRunCalled_ThenExpectTMPDIRNotSet(t *testing.T) {
+	// Given
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	mockCommandBuilder.AssertNotCalled(t, "AddEnv", "TMPDIR", mock.Anything)
+}
+
+// Proxy
+func Test_GivenProxies_WhenRunCalled_ThenExpectProxyEnvsSet(t *testing.T) {
+	// Given
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+		opts: RunnerOpts{
+			HTTPProxy:  "http://proxy:3128",
+			HTTPSProxy: "http://secure-proxy:3128",
+			NoProxy:    "localhost,.example.com",
+		},
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "http_proxy", "http://proxy:3128")
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "HTTP_PROXY", "http://proxy:3128")
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "https_proxy", "http://secure-proxy:3128")
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "HTTPS_PROXY", "http://secure-proxy:3128")
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "no_proxy", "localhost,.example.com")
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "NO_PROXY", "localhost,.example.com")
+}
+
+func Test_GivenNoProxies_WhenRunCalled_ThenExpectProxyEnvsNotSet(t *testing.T) {
+	// Given
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	for _, key := range []string{"http_proxy", "HTTP_PROXY", "https_proxy", "HTTPS_PROXY", "no_proxy", "NO_PROXY"} {
+		mockCommandBuilder.AssertNotCalled(t, "AddEnv", key, mock.Anything)
+	}
+}
+
+// Git credential helper
+func Test_GivenGitCredentialHelper_WhenRunCalled_ThenExpectGitConfigEnvsSet(t *testing.T) {
+	// Given
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{GitCredentialHelper: "store --file=/tmp/git-credentials"},
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "GIT_CONFIG_KEY_0", "credential.helper")
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "GIT_CONFIG_VALUE_0", "store --file=/tmp/git-credentials")
+	mockCommandBuilder.AssertCalled(t, "AddEnv", "GIT_CONFIG_COUNT", "1")
+}
+
+func Test_GivenNoGitCredentialHelper_WhenRunCalled_ThenExpectGitConfigEnvsNotSet(t *testing.T) {
+	// Given
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	mockCommandBuilder.AssertNotCalled(t, "AddEnv", "GIT_CONFIG_COUNT", mock.Anything)
+}
+
+func Test_GivenExistingGitConfigCount_WhenGitConfigEnvsCalled_ThenExpectEntryAppended(t *testing.T) {
+	// When
+	envs := gitConfigEnvs("2", "credential.helper", "osxkeychain")
+
+	// Then
+	assert.Equal(t, map[string]string{
+		"GIT_CONFIG_COUNT":   "3",
+		"GIT_CONFIG_KEY_2":   "credential.helper",
+		"GIT_CONFIG_VALUE_2": "osxkeychain",
+	}, envs)
+}
+
+// Outdated
+func Test_GivenOutdatedCommand_WhenRunCalled_ThenExpectOutdatedDependenciesExportedAndCacheUntouched(t *testing.T) {
+	// Given
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "printf",
+			Arguments: []string{`The following dependencies are outdated:\nAlamofire "5.2.0" -> "5.2.0" (Latest: "5.4.4")\n`},
+		},
+	}
+	mockCarthageCache := givenMockCarthageCache()
+	mockOutputExporter := givenStubbedOutputExporter()
+	runner := Runner{
+		carthageCommand: "outdated",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands(blueprints),
+		outputExporter:  mockOutputExporter,
+	}
+
+	// When
+	result, error := runner.RunContext(context.Background())
+
+	// Then
+	assert.NoError(t, error)
+	assert.Equal(t, []OutdatedDependency{{Name: "Alamofire", Current: "5.2.0", Latest: "5.4.4"}}, result.OutdatedDependencies)
+	mockOutputExporter.AssertCalled(t, "ExportOutput", "CARTHAGE_OUTDATED", `[{"name":"Alamofire","current":"5.2.0","latest":"5.4.4"}]`)
+	mockCarthageCache.AssertNotCalled(t, "IsAvailable")
+	mockCarthageCache.AssertNotCalled(t, "Commit")
+}
+
+// Problem matcher
+func Test_GivenProblemMatcherAndCompilerErrors_WhenRunCalled_ThenExpectAnnotationsPrintedAndFailureKept(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "sh",
+			Arguments: []string{"-c", "echo '/tmp/Checkouts/A/A.swift:3:5: error: cannot find type B in scope' >&2; exit 1"},
+		},
+	}
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands(blueprints),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{ProblemMatcher: true},
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.Error(t, error)
+	assert.Contains(t, logs.String(), "::error file=/tmp/Checkouts/A/A.swift,line=3,col=5::cannot find type B in scope")
+}
+
+// Build log
+func Test_GivenBuildLogAndCommandFails_WhenRunCalled_ThenExpectLogTailPrinted(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	buildLogPath := filepath.Join(t.TempDir(), "xcodebuild.log")
+	require.NoError(t, os.WriteFile(buildLogPath, []byte("CompileSwift A.swift\nA.swift:3:5: error: cannot find type B in scope\n** BUILD FAILED **\n"), 0600))
+	mockCommandBuilder := givenStubbedCommandBuilderReturnsCommands([]CommandBlueprint{{Command: "false"}})
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{BuildLogPath: buildLogPath, BuildLogTailLines: 2},
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.Error(t, error)
+	assert.Equal(t, [][]string{{"build"}, {"--log-path", buildLogPath}}, appendedArgs(mockCommandBuilder))
+	assert.Contains(t, logs.String(), "Last 2 lines of the xcodebuild log")
+	assert.Contains(t, logs.String(), "A.swift:3:5: error: cannot find type B in scope\n")
+	assert.NotContains(t, logs.String(), "CompileSwift A.swift")
+}
+
+func Test_GivenBuildLogAndCommandSucceeds_WhenRunCalled_ThenExpectLogTailNotPrinted(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	buildLogPath := filepath.Join(t.TempDir(), "xcodebuild.log")
+	require.NoError(t, os.WriteFile(buildLogPath, []byte("** BUILD SUCCEEDED **\n"), 0600))
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands([]CommandBlueprint{{Command: "true"}}),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{BuildLogPath: buildLogPath, BuildLogTailLines: 2},
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	assert.NotContains(t, logs.String(), "xcodebuild log")
+}
+
+func Test_GivenExplicitLogPathArg_WhenWithBuildLogPathCalled_ThenExpectArgsKept(t *testing.T) {
+	// When
+	args, logPath := withBuildLogPath([]string{"--log-path", "/tmp/custom.log"}, "/tmp/default.log")
+
+	// Then
+	assert.Equal(t, []string{"--log-path", "/tmp/custom.log"}, args)
+	assert.Equal(t, "/tmp/custom.log", logPath)
+}
+
+// Cancellation
+func Test_GivenContextCancelledDuringCommand_WhenRunContextCalled_ThenExpectCommandStoppedAndCacheNotSaved(t *testing.T) {
+	// Given
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "sleep",
+			Arguments: []string{"10"},
+		},
+	}
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false)
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands(blueprints),
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	startTime := time.Now()
+
+	// When
+	_, error := runner.RunContext(ctx)
+
+	// Then
+	assert.True(t, errors.Is(error, context.Canceled))
+	assert.Less(t, int64(time.Since(startTime)), int64(5*time.Second))
+	mockCarthageCache.AssertNotCalled(t, "CreateIndicator")
+	mockCarthageCache.AssertNotCalled(t, "Commit")
+}
+
+func Test_GivenCancelledContext_WhenBootstrapRunContextCalled_ThenExpectNoCacheOperation(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// When
+	_, error := runner.RunContext(ctx)
+
+	// Then
+	assert.True(t, errors.Is(error, context.Canceled))
+	mockCarthageCache.AssertNotCalled(t, "IsAvailable")
+	mockCarthageCache.AssertNotCalled(t, "Commit")
+}
+
+func Test_GivenContextCancelledWhileSavingDependencies_WhenBootstrapRunContextCalled_ThenExpectCacheNotCommitted(t *testing.T) {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockDependencyCache := new(MockDependencyCache).GivenRestoreSucceeds(nil, nil)
+	mockDependencyCache.On("Save").Run(func(mock.Arguments) { cancel() }).Return(nil, nil)
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", []CommandBlueprint{{Command: "true"}})
+	runner.opts = RunnerOpts{ProjectDir: t.TempDir(), DependencyCache: mockDependencyCache}
+
+	// When
+	_, error := runner.RunContext(ctx)
+
+	// Then
+	assert.True(t, errors.Is(error, context.Canceled))
+	mockDependencyCache.AssertCalled(t, "Save")
+	runner.cache.(*MockCarthageCache).AssertNotCalled(t, "CreateIndicator")
+	runner.cache.(*MockCarthageCache).AssertNotCalled(t, "Commit")
+}
+
+func Test_GivenCacheAvailable_WhenRunContextCalled_ThenExpectCacheHitResult(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(true).
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+
+	// When
+	result, error := runner.RunContext(context.Background())
+
+	// Then
+	assert.NoError(t, error)
+	assert.Equal(t, "bootstrap", result.Command)
+	assert.True(t, result.CacheHit)
+}
+
+// Cache miss reason
+func Test_GivenCacheNotAvailable_WhenRunCalled_ThenExpectMissReasonExported(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissSwiftChanged).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false).
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	mockOutputExporter := givenStubbedOutputExporter()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  mockOutputExporter,
+	}
+
+	// When
+	result, error := runner.RunContext(context.Background())
+
+	// Then
+	assert.NoError(t, error)
+	assert.Equal(t, CacheMissSwiftChanged, result.CacheMissReason)
+	mockOutputExporter.AssertCalled(t, "ExportOutput", "CARTHAGE_CACHE_MISS_REASON", "swift_changed")
+}
+
+func Test_GivenCacheHit_WhenRunCalled_ThenExpectEmptyMissReasonExported(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(true).
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	mockOutputExporter := givenStubbedOutputExporter()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  mockOutputExporter,
+	}
+
+	// When
+	_, error := runner.RunContext(context.Background())
+
+	// Then
+	assert.NoError(t, error)
+	mockOutputExporter.AssertCalled(t, "ExportOutput", "CARTHAGE_CACHE_MISS_REASON", "")
+	mockCarthageCache.AssertNotCalled(t, "MissReason")
+}
+
+// Platform coverage
+func Test_GivenCacheCoveringRequestedPlatforms_WhenRunCalled_ThenExpectCacheUsed(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(true).
+		GivenMissingPlatformsSucceeds(nil).
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		args:            []string{"--platform", "iOS"},
+		cache:           mockCarthageCache,
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+
+	// When
+	result, error := runner.RunContext(context.Background())
+
+	// Then
+	assert.NoError(t, error)
+	assert.True(t, result.CacheHit)
+	mockCarthageCache.AssertCalled(t, "MissingPlatforms", []string{"iOS"})
+	mockCommandBuilder.AssertNotCalled(t, "Command", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func Test_GivenCacheNotCoveringRequestedPlatforms_WhenRunCalled_ThenExpectRebuild(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(true).
+		GivenMissingPlatformsSucceeds([]string{"iOS"}).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false).
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		args:            []string{"--platform", "iOS"},
+		cache:           mockCarthageCache,
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+
+	// When
+	result, error := runner.RunContext(context.Background())
+
+	// Then
+	assert.NoError(t, error)
+	assert.False(t, result.CacheHit)
+	assert.Equal(t, CacheMissForced, result.CacheMissReason)
+	assert.Contains(t, logs.String(), "The cache does not contain the requested platforms: iOS")
+	mockCommandBuilder.AssertCalled(t, "Command", mock.Anything, mock.Anything, mock.Anything)
+	mockCarthageCache.AssertCalled(t, "CreateIndicator")
+}
+
+// Build changed
+func Test_GivenBootstrapCommandAndCacheHit_WhenRunCalled_ThenExpectBuildChangedFalseExported(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(true).
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	mockOutputExporter := givenStubbedOutputExporter()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  mockOutputExporter,
+		opts:            RunnerOpts{ProjectDir: projectDir},
+	}
+
+	// When
+	result, err := runner.RunContext(context.Background())
+
+	// Then
+	assert.NoError(t, err)
+	assert.False(t, result.BuildChanged)
+	mockOutputExporter.AssertCalled(t, "ExportOutput", "CARTHAGE_BUILD_CHANGED", "false")
+}
+
+func Test_GivenBootstrapCommandChangingBuildDir_WhenRunCalled_ThenExpectBuildChangedTrueExported(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	frameworkPath := filepath.Join(projectDir, "Carthage", "Build", "iOS", "Alamofire.framework", "Alamofire")
+	require.NoError(t, os.MkdirAll(filepath.Dir(frameworkPath), 0755))
+	require.NoError(t, os.WriteFile(frameworkPath, []byte("restored"), 0644))
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "bash",
+			Arguments: []string{"-c", "echo rebuilt > " + frameworkPath},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", blueprints)
+	runner.opts.ProjectDir = projectDir
+	mockOutputExporter := givenStubbedOutputExporter()
+	runner.outputExporter = mockOutputExporter
+
+	// When
+	result, err := runner.RunContext(context.Background())
+
+	// Then
+	assert.NoError(t, err)
+	assert.True(t, result.BuildChanged)
+	mockOutputExporter.AssertCalled(t, "ExportOutput", "CARTHAGE_BUILD_CHANGED", "true")
+}
+
+func Test_GivenBootstrapCommandNotChangingBuildDir_WhenRunCalled_ThenExpectBuildChangedFalseExported(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	frameworkPath := filepath.Join(projectDir, "Carthage", "Build", "iOS", "Alamofire.framework", "Alamofire")
+	require.NoError(t, os.MkdirAll(filepath.Dir(frameworkPath), 0755))
+	require.NoError(t, os.WriteFile(frameworkPath, []byte("restored"), 0644))
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "echo",
+			Arguments: []string{"hello"},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", blueprints)
+	runner.opts.ProjectDir = projectDir
+	mockOutputExporter := givenStubbedOutputExporter()
+	runner.outputExporter = mockOutputExporter
+
+	// When
+	result, err := runner.RunContext(context.Background())
+
+	// Then
+	assert.NoError(t, err)
+	assert.False(t, result.BuildChanged)
+	mockOutputExporter.AssertCalled(t, "ExportOutput", "CARTHAGE_BUILD_CHANGED", "false")
+}
+
+// Cache saving
+func Test_GivenBootstrapCommandAndCacheSaveDisabled_WhenRunCalled_ThenExpectBuildWithoutCacheCommit(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(true).
+		GivenCreateIndicatorSucceeds()
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	mockOutputExporter := givenStubbedOutputExporter()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  mockOutputExporter,
+		opts:            RunnerOpts{DisableCacheSave: true},
+	}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+	mockCommandBuilder.AssertCalled(t, "Command", mock.Anything, mock.Anything, mock.Anything)
+	mockCarthageCache.AssertNotCalled(t, "Commit")
+	mockOutputExporter.AssertCalled(t, "ExportOutput", "CARTHAGE_CACHE_SIZE_BYTES", "0")
+}
+
+func Test_GivenCacheAvailableAndCacheSaveDisabled_WhenRunCalled_ThenExpectCacheHitWithoutCacheCommit(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(true)
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{DisableCacheSave: true},
+	}
+
+	// When
+	result, err := runner.RunContext(context.Background())
+
+	// Then
+	assert.NoError(t, err)
+	assert.True(t, result.CacheHit)
+	mockCommandBuilder.AssertNotCalled(t, "Command", mock.Anything, mock.Anything, mock.Anything)
+	mockCarthageCache.AssertNotCalled(t, "Commit")
+}
+
+func Test_GivenBootstrapCommandAndCacheSaveEnabled_WhenRunCalled_ThenExpectCacheCommitted(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false).
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+	mockCarthageCache.AssertCalled(t, "Commit")
+}
+
+// Cache size
+func Test_GivenBootstrapCommandAndCacheSaved_WhenRunCalled_ThenExpectCacheSizeExported(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false).
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(4321)
+	mockOutputExporter := givenStubbedOutputExporter()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  mockOutputExporter,
+	}
+
+	// When
+	result, err := runner.RunContext(context.Background())
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4321), result.CacheSize)
+	mockOutputExporter.AssertCalled(t, "ExportOutput", "CARTHAGE_CACHE_SIZE_BYTES", "4321")
+}
+
+func Test_GivenBootstrapCommandAndCacheNotSaved_WhenRunCalled_ThenExpectZeroCacheSizeExported(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false).
+		GivenCreateIndicatorSucceeds().
+		GivenCommitFails(errors.New("no build output"))
+	mockOutputExporter := givenStubbedOutputExporter()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  mockOutputExporter,
+	}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+	mockCarthageCache.AssertNotCalled(t, "SavedSize")
+	mockOutputExporter.AssertCalled(t, "ExportOutput", "CARTHAGE_CACHE_SIZE_BYTES", "0")
+}
+
+// Require cache hit
+func Test_GivenBootstrapCommandAndRequireCacheHitAndCacheAvailable_WhenRunCalled_ThenExpectNoErrorAndCacheHitExported(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(true).
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	mockOutputExporter := givenStubbedOutputExporter()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilder(),
+		outputExporter:  mockOutputExporter,
+		opts:            RunnerOpts{RequireCacheHit: true},
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	mockOutputExporter.AssertCalled(t, "ExportOutput", "CARTHAGE_CACHE_HIT", "true")
+}
+
+func Test_GivenBootstrapCommandAndRequireCacheHitAndCacheNotAvailable_WhenRunCalled_ThenExpectBuildAndError(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false).
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	mockOutputExporter := givenStubbedOutputExporter()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  mockOutputExporter,
+		opts:            RunnerOpts{RequireCacheHit: true},
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.EqualError(t, error, "cache hit was required, but the cache was not available")
+	assert.ErrorIs(t, error, ErrCache)
+	mockCommandBuilder.AssertCalled(t, "Command", mock.Anything, mock.Anything, mock.Anything)
+	mockCarthageCache.AssertCalled(t, "CreateIndicator")
+	mockOutputExporter.AssertCalled(t, "ExportOutput", "CARTHAGE_CACHE_HIT", "false")
+}
+
+// Free disk space
+func Test_GivenLowDiskSpaceAndFailOnLowDiskSpace_WhenRunCalled_ThenExpectErrorAndCommandNotExecuted(t *testing.T) {
+	// Given
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "update",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+		opts: RunnerOpts{
+			ProjectDir:         "/project",
+			MinFreeDiskMB:      1024,
+			FailOnLowDiskSpace: true,
+		},
+		freeDiskSpace: givenFreeDiskSpace(100 * 1024 * 1024),
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.EqualError(t, error, "only 100 MB free disk space available, at least 1024 MB expected")
+	assert.ErrorIs(t, error, ErrValidation)
+	mockCommandBuilder.AssertNotCalled(t, "Command", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func Test_GivenLowDiskSpace_WhenRunCalled_ThenExpectWarningAndCommandExecuted(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "update",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+		opts: RunnerOpts{
+			ProjectDir:    "/project",
+			MinFreeDiskMB: 1024,
+		},
+		freeDiskSpace: givenFreeDiskSpace(100 * 1024 * 1024),
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	assert.Contains(t, logs.String(), "Low disk space: only 100 MB free disk space available, at least 1024 MB expected")
+	mockCommandBuilder.AssertCalled(t, "Command", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func Test_GivenEnoughDiskSpace_WhenRunCalled_ThenExpectCommandExecuted(t *testing.T) {
+	// Given
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	runner := Runner{
+		carthageCommand: "update",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+		opts: RunnerOpts{
+			ProjectDir:         "/project",
+			MinFreeDiskMB:      1024,
+			FailOnLowDiskSpace: true,
+		},
+		freeDiskSpace: givenFreeDiskSpace(2048 * 1024 * 1024),
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	mockCommandBuilder.AssertCalled(t, "Command", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// Summary
+func Test_GivenSummaryPath_WhenRunCalled_ThenExpectSummaryWritten(t *testing.T) {
+	// Given
+	tempDir := givenTempDir(t)
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		require.NoError(t, err)
+	}()
+	summaryPath := filepath.Join(tempDir, "deploy", "summary.txt")
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "echo",
+			Arguments: []string{`*** Building scheme "Alamofire iOS" in Alamofire.xcworkspace`},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", blueprints)
+	runner.opts = RunnerOpts{
+		SummaryPath:     summaryPath,
+		CarthageVersion: "0.38.0",
+		SwiftVersion:    "Apple Swift version 5.5",
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	content, err := fileutil.ReadStringFromFile(summaryPath)
+	require.NoError(t, err)
+	assert.Contains(t, content, "Command: bootstrap")
+	assert.Contains(t, content, "Status: success")
+	assert.Contains(t, content, "Carthage version: 0.38.0")
+	assert.Contains(t, content, "Swift version: Apple Swift version 5.5")
+	assert.Contains(t, content, "Cache hit: no")
+	assert.Contains(t, content, "Duration: ")
+	assert.Contains(t, content, "Built dependencies: Alamofire iOS")
+}
+
+// Require resolved file
+func Test_GivenUpdateWithNoPriorResolvedFile_WhenRunCalledAndResolvedCreated_ThenExpectNoError(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	resolvedPath := filepath.Join(projectDir, "Cartfile.resolved")
+	runner := Runner{
+		carthageCommand: "update",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands([]CommandBlueprint{{Command: "sh", Arguments: []string{"-c", `echo 'github "Alamofire/Alamofire" "5.4.4"' > "` + resolvedPath + `"`}}}),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{ProjectDir: projectDir, RequireResolvedFile: true},
+	}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+	assert.FileExists(t, resolvedPath)
+}
+
+func Test_GivenUpdateNotProducingResolvedFile_WhenRunCalled_ThenExpectValidationError(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	runner := Runner{
+		carthageCommand: "update",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands([]CommandBlueprint{{Command: "true"}}),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{ProjectDir: projectDir, RequireResolvedFile: true},
+	}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrValidation))
+	assert.EqualError(t, err, "the update command did not create Cartfile.resolved at: "+filepath.Join(projectDir, "Cartfile.resolved"))
+}
+
+// No shared schemes
+func Test_GivenNoSharedSchemesMessageAndFailMode_WhenBootstrapRunCalled_ThenExpectErrorAndNoCacheCommit(t *testing.T) {
+	// Given
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "sh",
+			Arguments: []string{"-c", `echo '*** Building scheme "Alamofire iOS" in Alamofire.xcworkspace'; echo 'Dependency "Legacy" has no shared framework schemes for any of the platforms: iOS'`},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", blueprints)
+	runner.opts = RunnerOpts{NoSharedSchemesMode: NoSharedSchemesFail}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrValidation))
+	assert.Contains(t, err.Error(), "their frameworks are missing: Legacy")
+	runner.cache.(*MockCarthageCache).AssertNotCalled(t, "CreateIndicator")
+	runner.cache.(*MockCarthageCache).AssertNotCalled(t, "Commit")
+}
+
+func Test_GivenNoSharedSchemesMessageAndWarnMode_WhenBootstrapRunCalled_ThenExpectWarningAndCacheCommit(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "sh",
+			Arguments: []string{"-c", `echo 'Dependency "Legacy" has no shared framework schemes for any of the platforms: iOS' >&2`},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", blueprints)
+	runner.opts = RunnerOpts{NoSharedSchemesMode: NoSharedSchemesWarn}
+
+	// When
+	result, err := runner.RunContext(context.Background())
+
+	// Then
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), "Carthage skipped building dependencies without shared framework schemes, their frameworks are missing: Legacy")
+	assert.Equal(t, []string{"Carthage skipped building dependencies without shared framework schemes, their frameworks are missing: Legacy"}, result.Warnings)
+	runner.cache.(*MockCarthageCache).AssertCalled(t, "Commit")
+}
+
+// Metrics
+func Test_GivenMetricsPath_WhenRunCalled_ThenExpectPrometheusMetricsWritten(t *testing.T) {
+	// Given
+	metricsPath := filepath.Join(t.TempDir(), "metrics", "carthage.prom")
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "echo",
+			Arguments: []string{`*** Building scheme "Alamofire iOS" in Alamofire.xcworkspace`},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", blueprints)
+	runner.opts = RunnerOpts{MetricsPath: metricsPath}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	content, err := fileutil.ReadStringFromFile(metricsPath)
+	require.NoError(t, err)
+	assert.Regexp(t, `(?m)^carthage_step_build_duration_seconds\{command="bootstrap"\} \d+\.\d{3}$`, content)
+	assert.Contains(t, content, "# TYPE carthage_step_cache_hit gauge\ncarthage_step_cache_hit{command=\"bootstrap\"} 0\n")
+	assert.Contains(t, content, "carthage_step_rebuilt_dependencies{command=\"bootstrap\"} 1\n")
+	assert.Contains(t, content, "carthage_step_cache_size_bytes{command=\"bootstrap\"} 0\n")
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		assert.Regexp(t, `^(# (HELP|TYPE) carthage_step_\w+ .+|carthage_step_\w+\{command="bootstrap"\} [0-9.]+)$`, line)
+	}
+}
+
+func Test_GivenCacheHitResult_WhenMetricsCalled_ThenExpectValues(t *testing.T) {
+	// Given
+	result := RunResult{Command: "bootstrap", CacheHit: true, Duration: 1500 * time.Millisecond, CacheSize: 2048}
+
+	// When
+	content := metrics(result)
+
+	// Then
+	assert.Contains(t, content, "carthage_step_build_duration_seconds{command=\"bootstrap\"} 1.500\n")
+	assert.Contains(t, content, "carthage_step_cache_hit{command=\"bootstrap\"} 1\n")
+	assert.Contains(t, content, "carthage_step_rebuilt_dependencies{command=\"bootstrap\"} 0\n")
+	assert.Contains(t, content, "carthage_step_cache_size_bytes{command=\"bootstrap\"} 2048\n")
+}
+
+// Status line
+func Test_GivenBootstrapCommand_WhenRunCalled_ThenExpectStatusLinePrintedLast(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "echo",
+			Arguments: []string{`*** Building scheme "Alamofire iOS" in Alamofire.xcworkspace`},
+		},
+	}
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", blueprints)
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	assert.Regexp(t, `^CARTHAGE_RESULT command=bootstrap cache=miss rebuilt=1 duration=\d+s status=success$`, lines[len(lines)-1])
+}
+
+func Test_GivenCacheHitAndFailure_WhenStatusLineCalled_ThenExpectFieldsFormatted(t *testing.T) {
+	// Given
+	result := RunResult{Command: "bootstrap", CacheHit: true, Duration: 11600 * time.Millisecond}
+
+	// When
+	line := statusLine(result, errors.New("exit status 1"))
+
+	// Then
+	assert.Equal(t, "CARTHAGE_RESULT command=bootstrap cache=hit rebuilt=0 duration=12s status=failed", line)
+}
+
+func Test_GivenDisabledStatusLine_WhenRunCalled_ThenExpectStatusLineNotPrinted(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands([]CommandBlueprint{{Command: "true"}}),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{DisableStatusLine: true},
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	assert.NotContains(t, logs.String(), "CARTHAGE_RESULT")
+}
+
+// Failure log
+func Test_GivenFailureLogDirAndCommandFails_WhenRunCalled_ThenExpectLogWritten(t *testing.T) {
+	// Given
+	deployDir := filepath.Join(t.TempDir(), "deploy")
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "sh",
+			Arguments: []string{"-c", "echo '*** Fetching Alamofire'; echo 'A.swift:3:5: error: cannot find type B in scope' >&2; exit 1"},
+		},
+	}
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands(blueprints),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{FailureLogDir: deployDir},
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.Error(t, error)
+	content, err := fileutil.ReadStringFromFile(filepath.Join(deployDir, "carthage-failure.log"))
+	require.NoError(t, err)
+	assert.Contains(t, content, "*** Fetching Alamofire\n")
+	assert.Contains(t, content, "A.swift:3:5: error: cannot find type B in scope\n")
+	assert.Contains(t, content, "Error: Carthage command failed, error: exit status 1")
+}
+
+func Test_GivenFailureLogDirAndCommandSucceeds_WhenRunCalled_ThenExpectNoLogWritten(t *testing.T) {
+	// Given
+	deployDir := filepath.Join(t.TempDir(), "deploy")
+	runner := Runner{
+		carthageCommand: "build",
+		cache:           givenMockCarthageCache(),
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands([]CommandBlueprint{{Command: "echo", Arguments: []string{"*** Fetching Alamofire"}}}),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{FailureLogDir: deployDir},
+	}
+
+	// When
+	error := runner.Run()
+
+	// Then
+	assert.NoError(t, error)
+	assert.NoFileExists(t, filepath.Join(deployDir, "carthage-failure.log"))
+}
+
+// isCacheAvailable
+func Test_GivenCarthageCacheAvailableFails_WhenIsCacheAvailableCalled_ThenExpectFalse(t *testing.T) {
+	// Given
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableFails(errors.New("whatever"))
+
+	runner := Runner{
+		cache: mockCarthageCache,
+	}
+
+	// When
+	available := runner.isCacheAvailable()
+
+	// Then
+	assert.False(t, available)
+}
+
+func Test_GivenCarthageCacheAvailableSucceeds_WhenIsCacheAvailableCalled_ThenExpectResult(t *testing.T) {
+	// Given
+	expectedAvailable := true
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(expectedAvailable)
+
+	runner := Runner{
+		cache: mockCarthageCache,
+	}
+
+	// When
+	available := runner.isCacheAvailable()
+
+	// Then
+	assert.Equal(t, expectedAvailable, available)
+}
+
+// ecxecuteCommand
+func Test_GivenCommadSucceeds_WhenExecuteCommandCalled_ThenExpectNoError(t *testing.T) {
+	// Given
+	mockCommandBuilder := givenStubbedCommandBuilder()
+	command := "version"
+	args := []string{"arg1"}
+	runner := Runner{
+		carthageCommand: command,
+		args:            args,
+		commandBuilder:  mockCommandBuilder,
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+
+	// When
+	_, error := runner.executeCommand(context.Background(), args)
+
+	// Then
+	assert.NoError(t, error)
+	mockCommandBuilder.AssertCalled(t, "AddGitHubToken", mock.Anything)
+	mockCommandBuilder.AssertCalled(t, "AddXCConfigFile", mock.Anything)
+	mockCommandBuilder.AssertCalled(t, "Append", []string{command})
+	mockCommandBuilder.AssertCalled(t, "Append", args)
+}
+
+func Test_GivenCommandWritingStdoutAndStderr_WhenExecuteCommandCalled_ThenExpectOutputStreamedAndCaptured(t *testing.T) {
+	// Given
+	var stdout, stderr bytes.Buffer
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "sh",
+			Arguments: []string{"-c", "echo '*** Building scheme \"A\" in A.xcodeproj'; echo 'warning: deprecated' >&2"},
+		},
+	}
+	runner := Runner{
+		carthageCommand: "build",
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands(blueprints),
+		outputExporter:  givenStubbedOutputExporter(),
+		stdout:          &stdout,
+		stderr:          &stderr,
+	}
+
+	// When
+	output, err := runner.executeCommand(context.Background(), nil)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "*** Building scheme \"A\" in A.xcodeproj\n", stdout.String())
+	assert.Equal(t, "warning: deprecated\n", stderr.String())
+	assert.Equal(t, stdout.String(), output.stdout)
+	assert.Contains(t, output.combined, "*** Building scheme \"A\" in A.xcodeproj\n")
+	assert.Contains(t, output.combined, "warning: deprecated\n")
+}
+
+func Test_GivenFailureOnStdout_WhenExecuteCommandFails_ThenExpectFailureDetected(t *testing.T) {
+	// Given
+	var stdout, stderr bytes.Buffer
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "sh",
+			Arguments: []string{"-c", "echo 'Module compiled with an incompatible Swift version'; echo 'Build Failed' >&2; exit 1"},
+		},
+	}
+	runner := Runner{
+		carthageCommand: "build",
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands(blueprints),
+		outputExporter:  givenStubbedOutputExporter(),
+		stdout:          &stdout,
+		stderr:          &stderr,
+	}
+
+	// When
+	_, err := runner.executeCommand(context.Background(), nil)
+
+	// Then
+	require.Error(t, err)
+	assert.True(t, hasIncompatibleSwiftVersionFailure(err))
+}
+
+func Test_GivenSeparateOutputStreamsAndFailureOnStdout_WhenExecuteCommandFails_ThenExpectOnlyStderrAnalyzed(t *testing.T) {
+	// Given
+	var stdout, stderr bytes.Buffer
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "sh",
+			Arguments: []string{"-c", "echo 'Module compiled with an incompatible Swift version'; echo 'Build Failed' >&2; exit 1"},
+		},
+	}
+	runner := Runner{
+		carthageCommand: "build",
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands(blueprints),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{SeparateOutputStreams: true},
+		stdout:          &stdout,
+		stderr:          &stderr,
+	}
+
+	// When
+	_, err := runner.executeCommand(context.Background(), nil)
+
+	// Then
+	var runnerErr *RunnerError
+	require.True(t, errors.As(err, &runnerErr))
+	assert.Equal(t, "Build Failed\n", runnerErr.Output)
+	assert.False(t, hasIncompatibleSwiftVersionFailure(err))
+}
+
+func Test_GivenSeparateOutputStreams_WhenExecuteCommandCalled_ThenExpectStreamsCapturedSeparately(t *testing.T) {
+	// Given
+	var stdout, stderr bytes.Buffer
+	blueprints := []CommandBlueprint{
+		{
+			Command:   "sh",
+			Arguments: []string{"-c", "echo 'Fetching A'; echo 'error: A failed' >&2; echo 'Fetching B'"},
+		},
+	}
+	runner := Runner{
+		carthageCommand: "build",
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands(blueprints),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{SeparateOutputStreams: true},
+		stdout:          &stdout,
+		stderr:          &stderr,
+	}
+
+	// When
+	output, err := runner.executeCommand(context.Background(), nil)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "Fetching A\nFetching B\n", stdout.String())
+	assert.Equal(t, "error: A failed\n", stderr.String())
+	assert.Equal(t, "Fetching A\nFetching B\n", output.stdout)
+	assert.Equal(t, "error: A failed\n", output.stderr)
+	assert.Empty(t, output.combined)
+	assert.Equal(t, "error: A failed\n", output.diagnostics())
+}
+
+// helpers
+func givenMockCarthageCache() *MockCarthageCache {
+	return new(MockCarthageCache)
+}
+
+func appendedArgs(mockCommandBuilder *MockCommandBuilder) [][]string {
+	var args [][]string
+	for _, call := range mockCommandBuilder.Calls {
+		if call.Method == "Append" {
+			args = append(args, call.Arguments.Get(0).([]string))
+		}
+	}
+	return args
+}
+
+func givenFreeDiskSpace(bytes uint64) func(string) (uint64, error) {
+	return func(string) (uint64, error) {
+		return bytes, nil
+	}
+}
+
+func givenStubbedOutputExporter() *MockOutputExporter {
+	return new(MockOutputExporter).GivenExportOutputSucceeds()
+}
+
+func givenStubbedCommandBuilder() *MockCommandBuilder {
+	blueprint := CommandBlueprint{
+		Command:   "echo",
+		Arguments: []string{"hello"},
+	}
+	mockCommandBuilder := new(MockCommandBuilder).
+		GivenAddGitHubTokenSucceeds().
+		GivenAddXCConfigFileSucceeds().
+		GivenAddEnvSucceeds().
+		GivenAppendSucceeds().
+		GivenCommandReturned(blueprint)
+	return mockCommandBuilder
+}
+
+func givenStubbedCommandBuilderReturnFailingCommand() *MockCommandBuilder {
+	blueprint := CommandBlueprint{
+		Command:   "fail",
+		Arguments: nil,
+	}
+	mockCommandBuilder := new(MockCommandBuilder).
+		GivenAddGitHubTokenSucceeds().
+		GivenAddXCConfigFileSucceeds().
+		GivenAddEnvSucceeds().
+		GivenAppendSucceeds().
+		GivenCommandReturned(blueprint)
+	return mockCommandBuilder
+}
+
+func givenRunnerWithMainAndCommandBuilderCommands(mainCommand string, commandBlueprints []CommandBlueprint) Runner {
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false).
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(0)
+
+	return Runner{
+		carthageCommand: mainCommand,
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands(commandBlueprints),
+		outputExporter:  givenStubbedOutputExporter(),
+	}
+}
+
+func givenStubbedCommandBuilderReturnsCommands(commandBlueprints []CommandBlueprint) *MockCommandBuilder {
+	mockCommandBuilder := new(MockCommandBuilder).
+		GivenAddGitHubTokenSucceeds().
+		GivenAddXCConfigFileSucceeds().
+		GivenAddEnvSucceeds().
+		GivenAppendSucceeds().
+		GivenCommandsReturned(commandBlueprints)
+	return mockCommandBuilder
+}
@@ -0,0 +1,87 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// SelfTestKey is the cache key the cache self-test saves its sentinel directory with.
+const SelfTestKey = "carthage-cache-selftest"
+
+const selfTestDirName = "carthage-cache-selftest"
+
+// RestorableFileCache is a FileCache, which can restore the committed paths within the same run, like the LocalFileCache.
+type RestorableFileCache interface {
+	FileCache
+	Restore() (bool, error)
+}
+
+// RunCacheSelfTest checks that the cache round-trips a directory: it creates a sentinel directory in rootDir,
+// saves it with the cache, removes it, restores it and compares the restored content to the original one.
+func RunCacheSelfTest(cache RestorableFileCache, rootDir string) error {
+	sentinelDir := filepath.Join(rootDir, selfTestDirName)
+	if err := writeSentinelDir(sentinelDir); err != nil {
+		return fmt.Errorf("failed to create the sentinel directory, error: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(sentinelDir)
+	}()
+
+	expected, err := buildDirDigest(sentinelDir)
+	if err != nil {
+		return err
+	}
+
+	cache.IncludePath(sentinelDir)
+	if err := cache.Commit(); err != nil {
+		return fmt.Errorf("failed to save the sentinel directory, error: %s", err)
+	}
+
+	if err := os.RemoveAll(sentinelDir); err != nil {
+		return fmt.Errorf("failed to clear the sentinel directory, error: %s", err)
+	}
+
+	restored, err := cache.Restore()
+	if err != nil {
+		return fmt.Errorf("failed to restore the sentinel directory, error: %s", err)
+	}
+	if !restored {
+		return fmt.Errorf("the saved sentinel directory was not found in the cache")
+	}
+
+	actual, err := buildDirDigest(sentinelDir)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("the restored sentinel directory does not match the saved one")
+	}
+
+	return nil
+}
+
+// writeSentinelDir creates a directory with a nested file, an empty file and a symlink,
+// the unique content makes sure a stale archive of a previous run does not pass the test.
+func writeSentinelDir(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	nestedDir := filepath.Join(dir, "nested")
+	if err := os.MkdirAll(nestedDir, 0755); err != nil {
+		return err
+	}
+
+	content := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := os.WriteFile(filepath.Join(nestedDir, "sentinel.txt"), []byte(content), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "empty"), nil, 0644); err != nil {
+		return err
+	}
+
+	return os.Symlink(filepath.Join("nested", "sentinel.txt"), filepath.Join(dir, "sentinel.txt"))
+}
@@ -0,0 +1,57 @@
+package cachedcarthage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenLocalFileCache_WhenRunCacheSelfTestCalled_ThenExpectRoundTripSucceeds(t *testing.T) {
+	// Given
+	rootDir := t.TempDir()
+	cacheDir := t.TempDir()
+	cache := NewLocalFileCache(cacheDir, SelfTestKey, rootDir)
+
+	// When
+	err := RunCacheSelfTest(cache, rootDir)
+
+	// Then
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(cacheDir, SelfTestKey+".tar.gz"))
+	assert.NoDirExists(t, filepath.Join(rootDir, selfTestDirName))
+}
+
+func Test_GivenCacheNotRestoring_WhenRunCacheSelfTestCalled_ThenExpectError(t *testing.T) {
+	// Given
+	mockFileCache := new(MockFileCache).
+		GivenIncludeSucceeds().
+		GivenCommitSucceeds().
+		GivenRestoreSucceeds(false)
+
+	// When
+	err := RunCacheSelfTest(mockFileCache, t.TempDir())
+
+	// Then
+	assert.EqualError(t, err, "the saved sentinel directory was not found in the cache")
+	mockFileCache.AssertCalled(t, "Commit")
+}
+
+func Test_GivenStaleCacheArchive_WhenRunCacheSelfTestCalled_ThenExpectMismatchError(t *testing.T) {
+	// Given
+	rootDir := t.TempDir()
+	cacheDir := t.TempDir()
+	require.NoError(t, RunCacheSelfTest(NewLocalFileCache(cacheDir, SelfTestKey, rootDir), rootDir))
+	mockFileCache := new(MockFileCache).
+		GivenIncludeSucceeds().
+		GivenCommitSucceeds()
+	mockFileCache.On("Restore").Return(NewLocalFileCache(cacheDir, SelfTestKey, rootDir).Restore, nil)
+
+	// When
+	err := RunCacheSelfTest(mockFileCache, rootDir)
+
+	// Then
+	assert.EqualError(t, err, "the restored sentinel directory does not match the saved one")
+	assert.NoDirExists(t, filepath.Join(rootDir, selfTestDirName))
+}
@@ -0,0 +1,29 @@
+package cachedcarthage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WhenFormatSizeCalled_ThenExpectHumanReadableValue(t *testing.T) {
+	testScenarios := []struct {
+		size     int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{5 * 1024 * 1024, "5.0 MB"},
+		{3 * 1024 * 1024 * 1024, "3.0 GB"},
+	}
+
+	for _, scenario := range testScenarios {
+		// When
+		actual := formatSize(scenario.size)
+
+		// Then
+		assert.Equal(t, scenario.expected, actual)
+	}
+}
@@ -0,0 +1,45 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// StaleBuildDirMode defines how a non-empty build dir is handled, if no cache was restored before the bootstrap command.
+type StaleBuildDirMode string
+
+// Stale build dir modes.
+const (
+	// StaleBuildDirNone skips the check.
+	StaleBuildDirNone StaleBuildDirMode = "none"
+	// StaleBuildDirWarn prints a warning and builds on top of the existing build dir.
+	StaleBuildDirWarn StaleBuildDirMode = "warn"
+	// StaleBuildDirClean removes the existing build dir before building.
+	StaleBuildDirClean StaleBuildDirMode = "clean"
+)
+
+// checkStaleBuildDir handles the build dir left by a prior run in the given mode, if it is not empty.
+// Such a build dir may be half-written, and mixing it with the new build output gives unpredictable results.
+func (runner Runner) checkStaleBuildDir(mode StaleBuildDirMode) error {
+	buildDir := runner.buildDir()
+	entries, err := os.ReadDir(buildDir)
+	if os.IsNotExist(err) || (err == nil && len(entries) == 0) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read build dir (%s), error: %s", buildDir, err)
+	}
+
+	if mode == StaleBuildDirClean {
+		log.Warnf("No cache was restored, but the build dir is not empty (%d entries), removing it: %s", len(entries), buildDir)
+		if err := os.RemoveAll(buildDir); err != nil {
+			return fmt.Errorf("failed to remove the build dir (%s), error: %s", buildDir, err)
+		}
+		return nil
+	}
+
+	log.Warnf("No cache was restored, but the build dir is not empty (%d entries): %s", len(entries), buildDir)
+	log.Warnf("It may be left by a prior run, the new build output is mixed with its content")
+	return nil
+}
@@ -0,0 +1,68 @@
+package cachedcarthage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenStaleBuildDirAndCleanMode_WhenBootstrapRunCalled_ThenExpectBuildDirRemovedBeforeBuilding(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	staleFramework := filepath.Join(projectDir, "Carthage", "Build", "iOS", "Stale.framework", "Stale")
+	givenFileWithSize(t, staleFramework, 16)
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", []CommandBlueprint{{Command: "true"}})
+	runner.opts = RunnerOpts{ProjectDir: projectDir, StaleBuildDirMode: StaleBuildDirClean}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.NoError(t, err)
+	assert.NoFileExists(t, staleFramework)
+}
+
+func Test_GivenStaleBuildDirAndWarnMode_WhenBootstrapRunCalled_ThenExpectWarningAndBuildDirKept(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	projectDir := t.TempDir()
+	staleFramework := filepath.Join(projectDir, "Carthage", "Build", "iOS", "Stale.framework", "Stale")
+	givenFileWithSize(t, staleFramework, 16)
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", []CommandBlueprint{{Command: "true"}})
+	runner.opts = RunnerOpts{ProjectDir: projectDir, StaleBuildDirMode: StaleBuildDirWarn}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.NoError(t, err)
+	assert.FileExists(t, staleFramework)
+	assert.Contains(t, logs.String(), "No cache was restored, but the build dir is not empty (1 entries)")
+}
+
+func Test_GivenEmptyBuildDir_WhenBootstrapRunCalledWithStaleBuildDirMode_ThenExpectNoWarning(t *testing.T) {
+	// Given
+	var logs bytes.Buffer
+	log.SetOutWriter(&logs)
+	defer log.SetOutWriter(os.Stdout)
+
+	projectDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(projectDir, "Carthage", "Build"), 0755))
+	runner := givenRunnerWithMainAndCommandBuilderCommands("bootstrap", []CommandBlueprint{{Command: "true"}})
+	runner.opts = RunnerOpts{ProjectDir: projectDir, StaleBuildDirMode: StaleBuildDirWarn}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	require.NoError(t, err)
+	assert.NotContains(t, logs.String(), "build dir is not empty")
+}
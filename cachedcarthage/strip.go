@@ -0,0 +1,178 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/env"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	dSYMExtension        = ".dSYM"
+	bcsymbolmapExtension = ".bcsymbolmap"
+	// xcframeworkDSYMsDirName is the `DebugSymbolsPath` of the XCFramework slices, relative to the slice dir.
+	xcframeworkDSYMsDirName = "dSYMs"
+)
+
+// bitcodeStrip removes the bitcode of the binary in place.
+func bitcodeStrip(pth string) error {
+	cmd := command.NewFactory(env.NewRepository()).Create("xcrun", []string{"bitcode_strip", "-r", pth, "-o", pth}, nil)
+	if out, err := cmd.RunAndReturnTrimmedCombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed, output: %s, error: %s", cmd.PrintableCommandArgs(), out, err)
+	}
+	return nil
+}
+
+// buildDirFramework is a framework bundle of the build dir, in a platform dir or in an XCFramework slice.
+type buildDirFramework struct {
+	path string
+	// debugSymbolsDir is where the framework's dSYM bundle is: the platform dir or the slice's dSYMs dir.
+	debugSymbolsDir string
+}
+
+func (framework buildDirFramework) binaryPath() string {
+	return filepath.Join(framework.path, strings.TrimSuffix(filepath.Base(framework.path), ".framework"))
+}
+
+// buildDirFrameworks returns the frameworks of the build dir's platform dirs and XCFramework slices,
+// the version files and other loose files are skipped.
+func buildDirFrameworks(buildDir string) ([]buildDirFramework, error) {
+	entries, err := os.ReadDir(buildDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read build dir (%s), error: %s", buildDir, err)
+	}
+
+	var frameworks []buildDirFramework
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		pth := filepath.Join(buildDir, entry.Name())
+		if filepath.Ext(entry.Name()) != ".xcframework" {
+			pths, err := filepath.Glob(filepath.Join(pth, "*.framework"))
+			if err != nil {
+				return nil, err
+			}
+			for _, framework := range pths {
+				frameworks = append(frameworks, buildDirFramework{path: framework, debugSymbolsDir: pth})
+			}
+			continue
+		}
+
+		pths, err := filepath.Glob(filepath.Join(pth, "*", "*.framework"))
+		if err != nil {
+			return nil, err
+		}
+		for _, framework := range pths {
+			frameworks = append(frameworks, buildDirFramework{path: framework, debugSymbolsDir: filepath.Join(filepath.Dir(framework), xcframeworkDSYMsDirName)})
+		}
+	}
+	return frameworks, nil
+}
+
+// removeDSYMs removes the dSYM bundles of the build dir's platform dirs and XCFramework slices.
+// The dSYMs dirs of the slices are kept (empty), as the XCFrameworks' Info.plist may still point to them.
+func removeDSYMs(buildDir string) (int, error) {
+	frameworks, err := buildDirFrameworks(buildDir)
+	if err != nil {
+		return 0, err
+	}
+
+	dirs := map[string]bool{}
+	removed := 0
+	for _, framework := range frameworks {
+		if dirs[framework.debugSymbolsDir] {
+			continue
+		}
+		dirs[framework.debugSymbolsDir] = true
+
+		pths, err := filepath.Glob(filepath.Join(framework.debugSymbolsDir, "*"+dSYMExtension))
+		if err != nil {
+			return removed, err
+		}
+		for _, pth := range pths {
+			if err := os.RemoveAll(pth); err != nil {
+				return removed, fmt.Errorf("failed to remove dSYM (%s), error: %s", pth, err)
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// stripBitcode strips the bitcode of the build dir's framework binaries with the given strip function
+// and removes the BCSymbolMaps of the platform dirs and XCFramework slices, which are only used to symbolicate bitcode builds.
+func stripBitcode(buildDir string, strip func(pth string) error) (int, error) {
+	frameworks, err := buildDirFrameworks(buildDir)
+	if err != nil {
+		return 0, err
+	}
+
+	stripped := 0
+	dirs := map[string]bool{}
+	for _, framework := range frameworks {
+		binary := framework.binaryPath()
+		if err := strip(binary); err != nil {
+			return stripped, fmt.Errorf("failed to strip bitcode of %s, error: %s", binary, err)
+		}
+		stripped++
+
+		dir := filepath.Dir(framework.path)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+
+		symbolMapDirs := []string{dir}
+		if framework.debugSymbolsDir != dir {
+			symbolMapDirs = append(symbolMapDirs, filepath.Join(dir, "BCSymbolMaps"))
+		}
+		for _, symbolMapDir := range symbolMapDirs {
+			pths, err := filepath.Glob(filepath.Join(symbolMapDir, "*"+bcsymbolmapExtension))
+			if err != nil {
+				return stripped, err
+			}
+			for _, pth := range pths {
+				if err := os.Remove(pth); err != nil {
+					return stripped, fmt.Errorf("failed to remove BCSymbolMap (%s), error: %s", pth, err)
+				}
+			}
+		}
+	}
+	return stripped, nil
+}
+
+// shrinkBuildDir removes the dSYMs and strips the bitcode of the built frameworks before they are cached, if enabled.
+// Failures are only printed as warnings, as the build output stays usable.
+func (runner Runner) shrinkBuildDir() {
+	if runner.opts.RemoveDSYMs {
+		log.Warnf("Removing the dSYMs of the built frameworks: crashes in the dependencies can not be symbolicated with the cached build")
+		if removed, err := removeDSYMs(runner.buildDir()); err != nil {
+			log.Warnf("Failed to remove the dSYMs: %s", err)
+		} else {
+			log.Printf("Removed %d dSYM(s)", removed)
+		}
+	}
+
+	if runner.opts.StripBitcode {
+		strip := runner.bitcodeStrip
+		if strip == nil {
+			strip = bitcodeStrip
+		}
+
+		log.Warnf("Stripping the bitcode of the built frameworks: apps can not be built with bitcode enabled against the cached build, " +
+			"and the binary hashes of the `--cache-builds` version files no longer match, so Carthage rebuilds those dependencies if it checks them")
+		if stripped, err := stripBitcode(runner.buildDir(), strip); err != nil {
+			log.Warnf("Failed to strip the bitcode: %s", err)
+		} else {
+			log.Printf("Stripped the bitcode of %d framework(s)", stripped)
+		}
+	}
+}
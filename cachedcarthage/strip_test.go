@@ -0,0 +1,145 @@
+package cachedcarthage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenBuildDirWithDSYMs_WhenRemoveDSYMsCalled_ThenExpectDSYMsRemovedAndFrameworksKept(t *testing.T) {
+	// Given
+	buildDir := givenBuildDirToShrink(t)
+
+	// When
+	removed, err := removeDSYMs(buildDir)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	assert.NoDirExists(t, filepath.Join(buildDir, "iOS", "Alamofire.framework.dSYM"))
+	assert.NoDirExists(t, filepath.Join(buildDir, "Kingfisher.xcframework", "ios-arm64", "dSYMs", "Kingfisher.framework.dSYM"))
+	assert.DirExists(t, filepath.Join(buildDir, "Kingfisher.xcframework", "ios-arm64", "dSYMs"))
+	assert.FileExists(t, filepath.Join(buildDir, "iOS", "Alamofire.framework", "Alamofire"))
+	assert.FileExists(t, filepath.Join(buildDir, "iOS", "Alamofire.framework.bcsymbolmap"))
+	assert.FileExists(t, filepath.Join(buildDir, "Kingfisher.xcframework", "ios-arm64", "Kingfisher.framework", "Kingfisher"))
+	assert.FileExists(t, filepath.Join(buildDir, ".Alamofire.version"))
+}
+
+func Test_GivenBuildDirWithBitcode_WhenStripBitcodeCalled_ThenExpectBinariesStrippedAndSymbolMapsRemoved(t *testing.T) {
+	// Given
+	buildDir := givenBuildDirToShrink(t)
+	var stripped []string
+	strip := func(pth string) error {
+		stripped = append(stripped, pth)
+		return nil
+	}
+
+	// When
+	count, err := stripBitcode(buildDir, strip)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(buildDir, "iOS", "Alamofire.framework", "Alamofire"),
+		filepath.Join(buildDir, "Kingfisher.xcframework", "ios-arm64", "Kingfisher.framework", "Kingfisher"),
+	}, stripped)
+	assert.NoFileExists(t, filepath.Join(buildDir, "iOS", "Alamofire.framework.bcsymbolmap"))
+	assert.NoFileExists(t, filepath.Join(buildDir, "Kingfisher.xcframework", "ios-arm64", "BCSymbolMaps", "Kingfisher.bcsymbolmap"))
+	assert.DirExists(t, filepath.Join(buildDir, "iOS", "Alamofire.framework.dSYM"))
+}
+
+func Test_GivenStripFails_WhenStripBitcodeCalled_ThenExpectError(t *testing.T) {
+	// Given
+	buildDir := givenBuildDirToShrink(t)
+
+	// When
+	_, err := stripBitcode(buildDir, func(string) error { return errors.New("not a Mach-O file") })
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a Mach-O file")
+}
+
+func Test_GivenRemoveDSYMsAndStripBitcode_WhenBootstrapRunCalled_ThenExpectBuildDirShrunkBeforeCommit(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	buildDir := filepath.Join(projectDir, "Carthage", "Build")
+	givenFileWithSize(t, filepath.Join(buildDir, "iOS", "Alamofire.framework", "Alamofire"), 16)
+	givenFileWithSize(t, filepath.Join(buildDir, "iOS", "Alamofire.framework.dSYM", "Contents", "Info.plist"), 16)
+	var stripped []string
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false).
+		GivenCreateIndicatorSucceeds().
+		GivenCommitSucceeds().
+		GivenSavedSizeSucceeds(16)
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands([]CommandBlueprint{{Command: "true"}}),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{ProjectDir: projectDir, RemoveDSYMs: true, StripBitcode: true},
+		bitcodeStrip: func(pth string) error {
+			stripped = append(stripped, pth)
+			return nil
+		},
+	}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+	assert.NoDirExists(t, filepath.Join(buildDir, "iOS", "Alamofire.framework.dSYM"))
+	assert.Equal(t, []string{filepath.Join(buildDir, "iOS", "Alamofire.framework", "Alamofire")}, stripped)
+	mockCarthageCache.AssertCalled(t, "Commit")
+}
+
+func Test_GivenCacheSaveDisabled_WhenBootstrapRunCalledWithRemoveDSYMs_ThenExpectDSYMsKept(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	dSYMPath := filepath.Join(projectDir, "Carthage", "Build", "iOS", "Alamofire.framework.dSYM", "Contents", "Info.plist")
+	givenFileWithSize(t, filepath.Join(projectDir, "Carthage", "Build", "iOS", "Alamofire.framework", "Alamofire"), 16)
+	givenFileWithSize(t, dSYMPath, 16)
+	mockCarthageCache := givenMockCarthageCache().
+		GivenIsAvailableSucceeds(false).
+		GivenMissReasonSucceeds(CacheMissNoPriorEntry).
+		GivenIsRestoredSucceeds(false).
+		GivenCheckoutsRestoredSucceeds(false).
+		GivenCreateIndicatorSucceeds()
+	runner := Runner{
+		carthageCommand: "bootstrap",
+		cache:           mockCarthageCache,
+		commandBuilder:  givenStubbedCommandBuilderReturnsCommands([]CommandBlueprint{{Command: "true"}}),
+		outputExporter:  givenStubbedOutputExporter(),
+		opts:            RunnerOpts{ProjectDir: projectDir, RemoveDSYMs: true, DisableCacheSave: true},
+	}
+
+	// When
+	err := runner.Run()
+
+	// Then
+	assert.NoError(t, err)
+	assert.FileExists(t, dSYMPath)
+}
+
+// givenBuildDirToShrink returns a build dir with a platform dir framework and an XCFramework, with their dSYMs and BCSymbolMaps.
+func givenBuildDirToShrink(t *testing.T) string {
+	buildDir := t.TempDir()
+	givenFileWithSize(t, filepath.Join(buildDir, ".Alamofire.version"), 16)
+	givenFileWithSize(t, filepath.Join(buildDir, "iOS", "Alamofire.framework", "Alamofire"), 16)
+	givenFileWithSize(t, filepath.Join(buildDir, "iOS", "Alamofire.framework.dSYM", "Contents", "Info.plist"), 16)
+	givenFileWithSize(t, filepath.Join(buildDir, "iOS", "Alamofire.framework.bcsymbolmap"), 16)
+	slice := filepath.Join(buildDir, "Kingfisher.xcframework", "ios-arm64")
+	givenFileWithSize(t, filepath.Join(buildDir, "Kingfisher.xcframework", "Info.plist"), 16)
+	givenFileWithSize(t, filepath.Join(slice, "Kingfisher.framework", "Kingfisher"), 16)
+	givenFileWithSize(t, filepath.Join(slice, "dSYMs", "Kingfisher.framework.dSYM", "Contents", "Info.plist"), 16)
+	givenFileWithSize(t, filepath.Join(slice, "BCSymbolMaps", "Kingfisher.bcsymbolmap"), 16)
+	return buildDir
+}
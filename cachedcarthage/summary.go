@@ -0,0 +1,79 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+)
+
+func (runner Runner) summary(result RunResult, runErr error) string {
+	status := "success"
+	if runErr != nil {
+		status = fmt.Sprintf("failed (%s)", runErr)
+	}
+
+	cacheHit := "no"
+	if result.CacheHit {
+		cacheHit = "yes"
+	}
+
+	builtDependencies := "-"
+	if len(result.BuiltDependencies) > 0 {
+		builtDependencies = strings.Join(result.BuiltDependencies, ", ")
+	}
+
+	lines := []string{
+		"Carthage step summary",
+		fmt.Sprintf("Command: %s", result.Command),
+		fmt.Sprintf("Status: %s", status),
+		fmt.Sprintf("Carthage version: %s", runner.opts.CarthageVersion),
+		fmt.Sprintf("Swift version: %s", strings.Replace(runner.opts.SwiftVersion, "\n", " ", -1)),
+		fmt.Sprintf("Cache hit: %s", cacheHit),
+		fmt.Sprintf("Duration: %s", result.Duration.Round(time.Millisecond)),
+		fmt.Sprintf("Built dependencies: %s", builtDependencies),
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// statusLine returns the single line, stable key=value formatted outcome of a run, for example:
+// CARTHAGE_RESULT command=bootstrap cache=hit rebuilt=0 duration=12s status=success
+func statusLine(result RunResult, runErr error) string {
+	cache := "miss"
+	if result.CacheHit {
+		cache = "hit"
+	}
+
+	status := "success"
+	if runErr != nil {
+		status = "failed"
+	}
+
+	command := result.Command
+	if command == "" {
+		command = "-"
+	}
+
+	fields := []string{
+		"CARTHAGE_RESULT",
+		fmt.Sprintf("command=%s", command),
+		fmt.Sprintf("cache=%s", cache),
+		fmt.Sprintf("rebuilt=%d", len(result.BuiltDependencies)),
+		fmt.Sprintf("duration=%ds", int64(result.Duration.Round(time.Second)/time.Second)),
+		fmt.Sprintf("status=%s", status),
+	}
+
+	return strings.Join(fields, " ")
+}
+
+func writeSummary(pth, content string) error {
+	if err := os.MkdirAll(filepath.Dir(pth), 0777); err != nil {
+		return fmt.Errorf("failed to create dir (%s), error: %s", filepath.Dir(pth), err)
+	}
+
+	return fileutil.WriteStringToFile(pth, content)
+}
@@ -0,0 +1,138 @@
+package cachedcarthage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// VersionFileReconcileMode defines how the `.<dependency>.version` files (written by `--cache-builds`)
+// in a restored build dir are handled.
+type VersionFileReconcileMode string
+
+// Version file reconcile modes.
+const (
+	// VersionFileReconcileNone leaves the version files untouched.
+	VersionFileReconcileNone VersionFileReconcileMode = "none"
+	// VersionFileReconcileValidate removes the version files not matching the Cartfile.resolved,
+	// so Carthage trusts the valid ones and rebuilds only the stale dependencies.
+	VersionFileReconcileValidate VersionFileReconcileMode = "validate"
+	// VersionFileReconcileDelete removes all version files, so Carthage falls back to its normal checks.
+	VersionFileReconcileDelete VersionFileReconcileMode = "delete"
+)
+
+const versionFileExtension = ".version"
+
+type versionFile struct {
+	Commitish string `json:"commitish"`
+}
+
+func (project Project) versionFilePaths() ([]string, error) {
+	entries, err := ioutil.ReadDir(project.buildDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var pths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), ".") && strings.HasSuffix(entry.Name(), versionFileExtension) {
+			pths = append(pths, filepath.Join(project.buildDir(), entry.Name()))
+		}
+	}
+	return pths, nil
+}
+
+func versionFileDependencyName(pth string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(pth), "."), versionFileExtension)
+}
+
+// reconcileVersionFiles applies the given reconcile mode to the project's version files.
+func reconcileVersionFiles(project Project, mode VersionFileReconcileMode) error {
+	if mode == VersionFileReconcileNone || mode == "" {
+		return nil
+	}
+
+	pths, err := project.versionFilePaths()
+	if err != nil {
+		return fmt.Errorf("failed to list version files, error: %s", err)
+	}
+
+	var resolvedVersions map[string]string
+	if mode == VersionFileReconcileValidate {
+		content, err := fileutil.ReadStringFromFile(project.resolvedFilePath())
+		if err != nil {
+			return fmt.Errorf("failed to read %s, error: %s", resolvedFileName, err)
+		}
+		resolvedVersions = resolvedDependencyVersions(content)
+	} else if mode != VersionFileReconcileDelete {
+		return fmt.Errorf("unknown version file reconcile mode: %s", mode)
+	}
+
+	for _, pth := range pths {
+		name := versionFileDependencyName(pth)
+
+		if mode == VersionFileReconcileValidate {
+			stale, reason := isVersionFileStale(pth, resolvedVersions[name])
+			if !stale {
+				log.Debugf("Version file of %s is valid", name)
+				continue
+			}
+			log.Warnf("Removing stale version file of %s: %s", name, reason)
+		}
+
+		if err := os.Remove(pth); err != nil {
+			return fmt.Errorf("failed to remove version file (%s), error: %s", pth, err)
+		}
+	}
+
+	if mode == VersionFileReconcileDelete {
+		log.Printf("Removed %d version file(s)", len(pths))
+	}
+
+	return nil
+}
+
+func isVersionFileStale(pth, resolvedVersion string) (bool, string) {
+	if resolvedVersion == "" {
+		return true, fmt.Sprintf("dependency not found in %s", resolvedFileName)
+	}
+
+	content, err := ioutil.ReadFile(pth)
+	if err != nil {
+		return true, fmt.Sprintf("failed to read: %s", err)
+	}
+
+	var file versionFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return true, fmt.Sprintf("failed to parse: %s", err)
+	}
+
+	if file.Commitish != resolvedVersion {
+		return true, fmt.Sprintf("built from %s, but %s is resolved", file.Commitish, resolvedVersion)
+	}
+
+	return false, ""
+}
+
+// resolvedDependencyVersions maps the dependency names (as used by Carthage for the checkout and version file names)
+// to the resolved versions.
+func resolvedDependencyVersions(resolvedFileContent string) map[string]string {
+	versions := map[string]string{}
+	for _, line := range strings.Split(resolvedFileContent, "\n") {
+		entry, ok, err := parseResolvedLine(line)
+		if err != nil || !ok {
+			continue
+		}
+
+		versions[entry.Name()] = entry.Version
+	}
+	return versions
+}
@@ -0,0 +1,85 @@
+package cachedcarthage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const versionFilesResolvedContent = `github "Alamofire/Alamofire" "5.4.4"
+github "onevcat/Kingfisher" "7.1.1"
+git "https://example.com/socket.io-client-swift.git" "16.0.1"
+`
+
+func Test_GivenValidateMode_WhenReconcileVersionFilesCalled_ThenExpectOnlyStaleVersionFilesRemoved(t *testing.T) {
+	// Given
+	project := givenProjectWithVersionFiles(t, map[string]string{
+		".Alamofire.version":              `{"commitish":"5.4.4","iOS":[]}`,
+		".Kingfisher.version":             `{"commitish":"6.0.0","iOS":[]}`,
+		".socket.io-client-swift.version": `{"commitish":"16.0.1","iOS":[]}`,
+		".Removed.version":                `{"commitish":"1.0.0","iOS":[]}`,
+		".Corrupt.version":                `not json`,
+	})
+	defer removeProject(t, project)
+
+	// When
+	err := reconcileVersionFiles(project, VersionFileReconcileValidate)
+
+	// Then
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(project.buildDir(), ".Alamofire.version"))
+	assert.FileExists(t, filepath.Join(project.buildDir(), ".socket.io-client-swift.version"))
+	assert.NoFileExists(t, filepath.Join(project.buildDir(), ".Kingfisher.version"))
+	assert.NoFileExists(t, filepath.Join(project.buildDir(), ".Removed.version"))
+	assert.NoFileExists(t, filepath.Join(project.buildDir(), ".Corrupt.version"))
+	assert.FileExists(t, filepath.Join(project.buildDir(), "iOS", "Alamofire.framework", "Alamofire"))
+}
+
+func Test_GivenDeleteMode_WhenReconcileVersionFilesCalled_ThenExpectAllVersionFilesRemoved(t *testing.T) {
+	// Given
+	project := givenProjectWithVersionFiles(t, map[string]string{
+		".Alamofire.version":  `{"commitish":"5.4.4","iOS":[]}`,
+		".Kingfisher.version": `{"commitish":"7.1.1","iOS":[]}`,
+	})
+	defer removeProject(t, project)
+
+	// When
+	err := reconcileVersionFiles(project, VersionFileReconcileDelete)
+
+	// Then
+	require.NoError(t, err)
+	pths, err := project.versionFilePaths()
+	require.NoError(t, err)
+	assert.Empty(t, pths)
+	assert.FileExists(t, filepath.Join(project.buildDir(), "iOS", "Alamofire.framework", "Alamofire"))
+}
+
+func Test_GivenNoBuildDir_WhenReconcileVersionFilesCalled_ThenExpectNoError(t *testing.T) {
+	// Given
+	project := givenProjectWithResolvedFile(t, versionFilesResolvedContent)
+	defer removeProject(t, project)
+
+	// When
+	err := reconcileVersionFiles(project, VersionFileReconcileValidate)
+
+	// Then
+	assert.NoError(t, err)
+}
+
+// helpers
+func givenProjectWithVersionFiles(t *testing.T, versionFiles map[string]string) Project {
+	project := givenProjectWithResolvedFile(t, versionFilesResolvedContent)
+	frameworkDir := filepath.Join(project.buildDir(), "iOS", "Alamofire.framework")
+	require.NoError(t, os.MkdirAll(frameworkDir, 0777))
+	require.NoError(t, fileutil.WriteStringToFile(filepath.Join(frameworkDir, "Alamofire"), "binary"))
+
+	for name, content := range versionFiles {
+		require.NoError(t, fileutil.WriteStringToFile(filepath.Join(project.buildDir(), name), content))
+	}
+
+	return project
+}
@@ -0,0 +1,41 @@
+package cachedcarthage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const userWritePermission = 0200
+
+// makeWritable adds the owner write permission to the files and directories of the given tree, symlinks are left untouched.
+// It returns the number of changed entries.
+func makeWritable(dir string) (int, error) {
+	if _, err := os.Lstat(dir); os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	err := filepath.Walk(dir, func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 || info.Mode().Perm()&userWritePermission != 0 {
+			return nil
+		}
+
+		if err := os.Chmod(pth, info.Mode().Perm()|userWritePermission); err != nil {
+			return err
+		}
+		changed++
+		return nil
+	})
+	if err != nil {
+		return changed, fmt.Errorf("failed to make %s writable, error: %s", dir, err)
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,48 @@
+package cachedcarthage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GivenReadOnlyRestoredBuildDir_WhenMakeBuildDirWritableCalled_ThenExpectWritableTree(t *testing.T) {
+	// Given
+	projectDir := t.TempDir()
+	project := NewProject(projectDir)
+	frameworkDir := filepath.Join(project.buildDir(), "iOS", "Alamofire.framework")
+	binaryPath := filepath.Join(frameworkDir, "Alamofire")
+	require.NoError(t, os.MkdirAll(frameworkDir, 0755))
+	require.NoError(t, os.WriteFile(binaryPath, []byte("binary"), 0644))
+	require.NoError(t, os.Symlink("Alamofire", filepath.Join(frameworkDir, "Current")))
+	for _, pth := range []string{binaryPath, frameworkDir, filepath.Dir(frameworkDir), project.buildDir()} {
+		require.NoError(t, os.Chmod(pth, 0555))
+	}
+	cache := Cache{project: project}
+
+	// When
+	err := cache.MakeBuildDirWritable()
+
+	// Then
+	require.NoError(t, err)
+	for _, pth := range []string{project.buildDir(), filepath.Dir(frameworkDir), frameworkDir, binaryPath} {
+		info, err := os.Stat(pth)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm(), pth)
+	}
+	assert.NoError(t, os.WriteFile(binaryPath, []byte("rebuilt"), 0644))
+}
+
+func Test_GivenMissingBuildDir_WhenMakeBuildDirWritableCalled_ThenExpectNoError(t *testing.T) {
+	// Given
+	cache := Cache{project: NewProject(t.TempDir())}
+
+	// When
+	err := cache.MakeBuildDirWritable()
+
+	// Then
+	assert.NoError(t, err)
+}
@@ -0,0 +1,80 @@
+package carthage
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const redactedArg = "[REDACTED]"
+
+// execCommand implements command.Command over an exec.Cmd,
+// which (unlike the commands of the go-utils command.Factory) can be bound to a context.
+type execCommand struct {
+	cmd *exec.Cmd
+	// secrets are the arguments redacted from the printable command.
+	secrets []string
+}
+
+// PrintableCommandArgs ...
+func (c execCommand) PrintableCommandArgs() string {
+	var args []string
+	for idx, arg := range c.cmd.Args {
+		if idx == 0 {
+			args = append(args, arg)
+		} else if c.isSecret(arg) {
+			args = append(args, strconv.Quote(redactedArg))
+		} else {
+			args = append(args, strconv.Quote(arg))
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+func (c execCommand) isSecret(arg string) bool {
+	for _, secret := range c.secrets {
+		if arg == secret {
+			return true
+		}
+	}
+	return false
+}
+
+// Run ...
+func (c execCommand) Run() error {
+	return c.cmd.Run()
+}
+
+// RunAndReturnExitCode ...
+func (c execCommand) RunAndReturnExitCode() (int, error) {
+	err := c.cmd.Run()
+	return c.cmd.ProcessState.ExitCode(), err
+}
+
+// RunAndReturnTrimmedOutput ...
+func (c execCommand) RunAndReturnTrimmedOutput() (string, error) {
+	out, err := c.cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// RunAndReturnTrimmedCombinedOutput ...
+func (c execCommand) RunAndReturnTrimmedCombinedOutput() (string, error) {
+	out, err := c.cmd.CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
+// Start ...
+func (c execCommand) Start() error {
+	return c.cmd.Start()
+}
+
+// Wait ...
+func (c execCommand) Wait() error {
+	return c.cmd.Wait()
+}
+
+// Process returns the started process of the command, nil before it is started.
+func (c execCommand) Process() *os.Process {
+	return c.cmd.Process
+}
@@ -1,34 +1,64 @@
 package carthage
 
 import (
+	"context"
 	"fmt"
-	"github.com/bitrise-io/go-utils/env"
 	"io"
+	"os/exec"
 
 	"github.com/bitrise-io/go-steputils/stepconf"
 	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/env"
 	"github.com/bitrise-steplib/steps-carthage/cachedcarthage"
 )
 
+const githubAccessTokenArg = "--github-access-token"
+
+// GitHubTokenMode defines how the GitHub access token is passed to Carthage.
+type GitHubTokenMode string
+
+// GitHubTokenModes ...
+const (
+	// GitHubTokenModeEnv passes the token as the `GITHUB_ACCESS_TOKEN` env.
+	GitHubTokenModeEnv GitHubTokenMode = "env"
+	// GitHubTokenModeFlag passes the token as the `--github-access-token` argument,
+	// which is visible in the process list of the machine.
+	GitHubTokenModeFlag GitHubTokenMode = "flag"
+)
+
 // CLIBuilder can be used to build cli Carthage commands.
 type CLIBuilder struct {
-	args []string
-	envs []string
-	commandFactory command.Factory
+	args          []string
+	envs          []string
+	envRepository env.Repository
+	tokenMode     GitHubTokenMode
+	tokenArg      stepconf.Secret
 }
 
 // NewCLIBuilder ...
 func NewCLIBuilder() CLIBuilder {
 	return CLIBuilder{
-		args: []string{},
-		envs: []string{},
-		commandFactory: command.NewFactory(env.NewRepository()),
+		args:          []string{},
+		envs:          []string{},
+		envRepository: env.NewRepository(),
 	}
 }
 
+// WithGitHubTokenMode returns a copy of the builder passing the GitHub token in the given mode, the env by default.
+func (builder CLIBuilder) WithGitHubTokenMode(mode GitHubTokenMode) CLIBuilder {
+	builder.tokenMode = mode
+	return builder
+}
+
 // AddGitHubToken appends the provided GitHub token to the builder.
 func (builder CLIBuilder) AddGitHubToken(githubToken stepconf.Secret) cachedcarthage.CommandBuilder {
-	if githubToken != "" {
+	if githubToken == "" {
+		return builder
+	}
+
+	if builder.tokenMode == GitHubTokenModeFlag {
+		builder.tokenArg = githubToken
+	} else {
 		builder.envs = append(builder.envs, fmt.Sprintf("GITHUB_ACCESS_TOKEN=%s", string(githubToken)))
 	}
 	return builder
@@ -42,18 +72,32 @@ func (builder CLIBuilder) AddXCConfigFile(path string) cachedcarthage.CommandBui
 	return builder
 }
 
+// AddEnv appends the provided environment variable to the builder.
+func (builder CLIBuilder) AddEnv(key, value string) cachedcarthage.CommandBuilder {
+	builder.envs = append(builder.envs, fmt.Sprintf("%s=%s", key, value))
+	return builder
+}
+
 // Append adds the arguments to the builder.
 func (builder CLIBuilder) Append(args ...string) cachedcarthage.CommandBuilder {
 	builder.args = append(builder.args, args...)
 	return builder
 }
 
-// Command returns the built command.
-func (builder CLIBuilder) Command(stdout io.Writer, stderr io.Writer) command.Command {
-	command := builder.commandFactory.Create("carthage", builder.args, &command.Opts{
-		Stdout: stdout,
-		Stderr: stderr,
-		Env:    builder.envs,
-	})
-	return command
+// Command returns the built command, which is killed if the context is done before it completes.
+func (builder CLIBuilder) Command(ctx context.Context, stdout io.Writer, stderr io.Writer) command.Command {
+	args := builder.args
+	var secrets []string
+	if builder.tokenArg != "" {
+		// The token is appended last, as Carthage expects the options after the subcommand.
+		args = append(append([]string{}, args...), githubAccessTokenArg, string(builder.tokenArg))
+		secrets = append(secrets, string(builder.tokenArg))
+	}
+
+	cmd := exec.CommandContext(ctx, "carthage", args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// The built envs are appended to the current process's environment.
+	cmd.Env = append(builder.envRepository.List(), builder.envs...)
+	return execCommand{cmd: cmd, secrets: secrets}
 }
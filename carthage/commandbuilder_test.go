@@ -1,6 +1,7 @@
 package carthage
 
 import (
+	"context"
 	"testing"
 
 	"github.com/bitrise-io/go-steputils/stepconf"
@@ -13,7 +14,7 @@ func Test_WhenArgumentAppended_ThenResultCommandContainsArgument(t *testing.T) {
 	builder := NewCLIBuilder()
 
 	// When
-	command := builder.Append("version").Command(nil, nil)
+	command := builder.Append("version").Command(context.Background(), nil, nil)
 
 	// Then
 	assert.Equal(t, expectedCommand, command.PrintableCommandArgs())
@@ -27,7 +28,7 @@ func Test_WhenGitHubTokenAppended_ThenResultCommandContainsToken(t *testing.T) {
 	builder := NewCLIBuilder()
 
 	// When
-	command := builder.AddGitHubToken(expectedToken).Append("version").Command(nil, nil)
+	command := builder.AddGitHubToken(expectedToken).Append("version").Command(context.Background(), nil, nil)
 
 	// Then
 	assert.Equal(t, expectedCommand, command.PrintableCommandArgs())
@@ -43,10 +44,46 @@ func Test_WhenXCConfigFileAppended_ThenResultCommandContainsPath(t *testing.T) {
 	builder := NewCLIBuilder()
 
 	// When
-	command := builder.AddXCConfigFile(path).Append("version").Command(nil, nil)
+	command := builder.AddXCConfigFile(path).Append("version").Command(context.Background(), nil, nil)
 
 	// Then
 	assert.Equal(t, expectedCommand, command.PrintableCommandArgs())
 	// At the moment it is not possible to get the env variables from the command.
 	//assert.Contains(t, command.GetCmd().Env, expectedEnv)
 }
+
+func Test_WhenEnvAdded_ThenResultCommandContainsEnv(t *testing.T) {
+	// Given
+	builder := NewCLIBuilder()
+
+	// When
+	command := builder.AddEnv("TMPDIR", "/Volumes/large/tmp").Append("version").Command(context.Background(), nil, nil)
+
+	// Then
+	assert.Contains(t, command.(execCommand).cmd.Env, "TMPDIR=/Volumes/large/tmp")
+}
+
+func Test_GivenEnvTokenMode_WhenGitHubTokenAppended_ThenExpectTokenEnv(t *testing.T) {
+	// Given
+	builder := NewCLIBuilder().WithGitHubTokenMode(GitHubTokenModeEnv)
+
+	// When
+	command := builder.AddGitHubToken("nice_token").Append("bootstrap").Command(context.Background(), nil, nil)
+
+	// Then
+	assert.Contains(t, command.(execCommand).cmd.Env, "GITHUB_ACCESS_TOKEN=nice_token")
+	assert.Equal(t, []string{"carthage", "bootstrap"}, command.(execCommand).cmd.Args)
+}
+
+func Test_GivenFlagTokenMode_WhenGitHubTokenAppended_ThenExpectTokenArgRedactedFromPrintableCommand(t *testing.T) {
+	// Given
+	builder := NewCLIBuilder().WithGitHubTokenMode(GitHubTokenModeFlag)
+
+	// When
+	command := builder.AddGitHubToken("nice_token").Append("bootstrap").Append("--platform", "iOS").Command(context.Background(), nil, nil)
+
+	// Then
+	assert.Equal(t, []string{"carthage", "bootstrap", "--platform", "iOS", "--github-access-token", "nice_token"}, command.(execCommand).cmd.Args)
+	assert.NotContains(t, command.(execCommand).cmd.Env, "GITHUB_ACCESS_TOKEN=nice_token")
+	assert.Equal(t, `carthage "bootstrap" "--platform" "iOS" "--github-access-token" "[REDACTED]"`, command.PrintableCommandArgs())
+}
@@ -1,28 +1,79 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	cacheutil "github.com/bitrise-io/go-steputils/cache"
 	"github.com/bitrise-io/go-steputils/input"
 	"github.com/bitrise-io/go-steputils/stepconf"
+	"github.com/bitrise-io/go-utils/colorstring"
 	"github.com/bitrise-io/go-utils/command"
 	"github.com/bitrise-io/go-utils/env"
 	"github.com/bitrise-io/go-utils/filedownloader"
+	"github.com/bitrise-io/go-utils/fileutil"
 	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
 	"github.com/bitrise-steplib/steps-carthage/cachedcarthage"
 	"github.com/bitrise-steplib/steps-carthage/carthage"
 	"github.com/hashicorp/go-version"
 	"github.com/kballard/go-shellquote"
+	"gopkg.in/yaml.v3"
 )
 
 const (
-	projectDirArg = "--project-directory"
+	projectDirArg    = "--project-directory"
+	noSkipCurrentArg = "--no-skip-current"
+	useSSHArg        = "--use-ssh"
+	noUseBinariesArg = "--no-use-binaries"
+	platformArg      = "--platform"
 )
 
+const cartfileName = "Cartfile"
+
+const (
+	carthageVersionOutputKey  = "CARTHAGE_VERSION"
+	swiftVersionOutputKey     = "CARTHAGE_SWIFT_VERSION"
+	xcodeVersionOutputKey     = "CARTHAGE_XCODE_VERSION"
+	cacheKeyOutputKey         = "CARTHAGE_CACHE_KEY"
+	cacheRestoreKeysOutputKey = "CARTHAGE_CACHE_RESTORE_KEYS"
+)
+
+// stepVersion is the Step's version, part of the cache key. Bump it on release, together with the CHANGELOG.
+// It can be overridden at build time with `-ldflags "-X main.stepVersion=<version>"`.
+var stepVersion = "3.1.4"
+
+var (
+	xcconfigLinePattern = regexp.MustCompile(`^\s*(#include\??\s|[A-Za-z_][A-Za-z0-9_]*(\[[^\]]*\])*\s*=)`)
+	swiftVersionPattern = regexp.MustCompile(`Swift version (\S+)`)
+	xcodeVersionPattern = regexp.MustCompile(`(?m)^Xcode (\S+)`)
+
+	xcconfigIncludePattern = regexp.MustCompile(`^\s*#include\??\s+"([^"]+)"`)
+	xcconfigSettingPattern = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)(?:\[[^\]]*\])*\s*=(.*)$`)
+)
+
+// allowedCarthageCommands are the Carthage subcommands the Step runs without `allow_any_carthage_command`,
+// commands publishing artifacts (like `archive`) are left out on purpose.
+var allowedCarthageCommands = []string{"bootstrap", "build", "checkout", "fetch", "outdated", "update", "validate", "version"}
+
 // FileProvider ...
 type FileProvider interface {
 	LocalPath(path string) (string, error)
@@ -31,14 +82,100 @@ type FileProvider interface {
 // Config ...
 type Config struct {
 	GithubAccessToken stepconf.Secret `env:"github_access_token"`
+	GithubTokenMode   string          `env:"github_access_token_mode,opt[env,flag]"`
 	CarthageCommand   string          `env:"carthage_command,required"`
 	CarthageOptions   string          `env:"carthage_options"`
+	BootstrapOptions  string          `env:"bootstrap_options"`
+	UpdateOptions     string          `env:"update_options"`
+	ExpandOptions     bool            `env:"expand_options,opt[yes,no]"`
+	AllowAnyCommand   bool            `env:"allow_any_carthage_command,opt[yes,no]"`
+	BlockedVersions   string          `env:"blocked_carthage_versions"`
+	NoSkipCurrent     bool            `env:"no_skip_current,opt[yes,no]"`
+	UseSSH            bool            `env:"use_ssh,opt[yes,no]"`
+	GitCredHelper     string          `env:"git_credential_helper"`
+	NoUseBinaries     bool            `env:"no_use_binaries_for_git,opt[yes,no]"`
+	AutoPlatform      bool            `env:"auto_platform,opt[yes,no]"`
+	NoSharedSchemes   string          `env:"no_shared_schemes,opt[warn,fail]"`
+	DuplicateFwks     string          `env:"duplicate_frameworks,opt[none,warn,fail]"`
+	RequirePlatformFw bool            `env:"require_platform_frameworks,opt[yes,no]"`
+	VerifyArchs       bool            `env:"verify_archs,opt[yes,no]"`
+	ExpectedArchs     string          `env:"expected_archs"`
+	ExpectedSignature string          `env:"expected_code_signature"`
+	Locale            string          `env:"locale"`
+	PathPrepend       string          `env:"path_prepend"`
+	DependencyRetry   int             `env:"dependency_retry"`
+	RaiseOpenFiles    bool            `env:"raise_open_files_limit,opt[yes,no]"`
+	CPUPriority       int             `env:"cpu_priority"`
 	SourceDir         string          `env:"BITRISE_SOURCE_DIR"`
 	Xcconfig          string          `env:"xcconfig"`
 	XcconfigFromEnv   string          `env:"XCODE_XCCONFIG_FILE"`
+	XcconfigHeaders   stepconf.Secret `env:"xcconfig_headers"`
+	XcconfigCacheDir  string          `env:"xcconfig_cache_dir"`
+	XcconfigMaxAge    int             `env:"xcconfig_cache_max_age_minutes"`
+
+	MaxConcurrentCompilation int `env:"max_concurrent_compilation"`
+
+	HTTPProxy  string `env:"http_proxy"`
+	HTTPSProxy string `env:"https_proxy"`
+	NoProxy    string `env:"no_proxy"`
+
+	// Cache
+	HashAlgorithm         string `env:"cache_key_hash_algorithm,opt[sha256,sha384,sha512]"`
+	IgnoreSwiftVersion    bool   `env:"ignore_swift_version,opt[yes,no]"`
+	RequireCacheHit       bool   `env:"require_cache_hit,opt[yes,no]"`
+	RequireResolvedFile   bool   `env:"require_resolved_after_update,opt[yes,no]"`
+	SaveCache             bool   `env:"save_cache,opt[yes,no]"`
+	LocalCacheDir         string `env:"local_cache_dir"`
+	CacheBranch           string `env:"cache_branch"`
+	CacheDefaultBranch    string `env:"cache_default_branch"`
+	DependencyCacheDir    string `env:"dependency_cache_dir"`
+	VersionFilesReconcile string `env:"version_files_reconcile,opt[none,validate,delete]"`
+	MakeRestoredWritable  bool   `env:"make_restored_writable,opt[yes,no]"`
+	CacheRemoveDSYMs      bool   `env:"cache_remove_dsyms,opt[yes,no]"`
+	CacheStripBitcode     bool   `env:"cache_strip_bitcode,opt[yes,no]"`
+	StaleBuildDir         string `env:"stale_build_dir,opt[none,warn,clean]"`
+	CacheKeyFiles         string `env:"cache_key_files"`
+	CartfileOverride      string `env:"pre_bootstrap_cartfile_override"`
+	CartfileContents      string `env:"cartfile_contents"`
+	CacheDir              string `env:"cache_dir"`
+	ResolvedFilePath      string `env:"resolved_file_path"`
+	CacheKeyOutputFile    string `env:"cache_key_output_file"`
+	CacheKeyOnly          bool   `env:"cache_key_only,opt[yes,no]"`
+	CachePlatforms        string `env:"cache_platforms"`
+	CacheDerivedData      bool   `env:"cache_derived_data,opt[yes,no]"`
+	CacheCarthageKit      bool   `env:"cache_carthagekit_dir,opt[yes,no]"`
+	BuildChangedOnly      bool   `env:"build_changed_only,opt[yes,no]"`
+	ResolvedBaseline      string `env:"resolved_baseline"`
+
+	// Preflight
+	MinFreeDiskMB      int    `env:"min_free_disk_mb"`
+	FailOnLowDiskSpace bool   `env:"fail_on_low_disk_space,opt[yes,no]"`
+	ValidateXcconfig   bool   `env:"validate_xcconfig,opt[yes,no]"`
+	EnforcePinned      bool   `env:"enforce_pinned,opt[yes,no]"`
+	ScanResolvedFiles  bool   `env:"scan_resolved_files,opt[yes,no]"`
+	ProjectDirRoot     string `env:"project_dir_root"`
+	AllowOutsideRoot   bool   `env:"allow_project_dir_outside_root,opt[yes,no]"`
+	ValidateOptions    string `env:"validate_options,opt[none,warn,fail]"`
+	TempDir            string `env:"temp_dir"`
+
+	// Outputs
+	SummaryPath           string `env:"summary_path"`
+	PrintStatusLine       bool   `env:"print_status_line,opt[yes,no]"`
+	MetricsFile           string `env:"metrics_file"`
+	JUnitReportPath       string `env:"junit_report_path"`
+	LogStreamURL          string `env:"log_stream_url"`
+	ProblemMatcher        bool   `env:"problem_matcher,opt[yes,no]"`
+	SeparateOutputStreams bool   `env:"separate_output_streams,opt[yes,no]"`
+	DeployLogOnFailure    bool   `env:"deploy_log_on_failure,opt[yes,no]"`
+	SoftFailureExitCodes  string `env:"soft_failure_exit_codes"`
+	DeployDir             string `env:"BITRISE_DEPLOY_DIR"`
 
 	// Debug
-	VerboseLog bool `env:"verbose_log,opt[yes,no]"`
+	CacheDebug         bool `env:"cache_debug,opt[yes,no]"`
+	VerboseLog         bool `env:"verbose_log,opt[yes,no]"`
+	BuildLogTailLines  int  `env:"build_log_tail_lines"`
+	CacheSelfTest      bool `env:"cache_selftest,opt[yes,no]"`
+	PrintOnlySetInputs bool `env:"print_only_set_inputs,opt[yes,no]"`
 }
 
 func fail(format string, v ...interface{}) {
@@ -46,15 +183,196 @@ func fail(format string, v ...interface{}) {
 	os.Exit(1)
 }
 
+// setConfigFieldsString formats the config like stepconf.Print does, leaving out the empty (zero value) fields.
+// Secrets are printed via their String method, so they are always masked.
+func setConfigFieldsString(config Config) string {
+	v := reflect.ValueOf(config)
+	t := v.Type()
+
+	str := fmt.Sprint(colorstring.Bluef("%s:\n", capitalize(t.Name())))
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.IsZero() {
+			continue
+		}
+		str += fmt.Sprintf("- %s: %v\n", t.Field(i).Name, field.Interface())
+	}
+
+	return str
+}
+
+// capitalize returns the string with its first rune upper cased.
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// parseConfigFileFlag returns the path of the `--config <file.json>` flag, empty if not set.
+func parseConfigFileFlag(args []string) (string, error) {
+	flags := flag.NewFlagSet("steps-carthage", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	pth := flags.String("config", "", "JSON file of the Step inputs")
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+	if flags.NArg() > 0 {
+		return "", fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	return *pth, nil
+}
+
+// stepDefinition is the step.yml, the source of the input defaults used with a config file.
+//
+//go:embed step.yml
+var stepDefinition []byte
+
+// configFileRepository serves the inputs of a config file for the envs not set (or empty) in the wrapped repository,
+// then the step.yml defaults for the inputs missing from the file too, so the envs override the file and the file the defaults.
+type configFileRepository struct {
+	env.Repository
+	inputs   map[string]string
+	defaults map[string]string
+}
+
+// Get ...
+func (repository configFileRepository) Get(key string) string {
+	if value := repository.Repository.Get(key); value != "" {
+		return value
+	}
+	if value, ok := repository.inputs[key]; ok {
+		return value
+	}
+	return repository.defaults[key]
+}
+
+// stepInputDefaults returns the default values of the step.yml inputs, with the env references (like `$BITRISE_GIT_BRANCH`)
+// expanded from the repository, as the Bitrise CLI would.
+func stepInputDefaults(definition []byte, envRepository env.Repository) (map[string]string, error) {
+	var step struct {
+		Inputs []map[string]interface{} `yaml:"inputs"`
+	}
+	if err := yaml.Unmarshal(definition, &step); err != nil {
+		return nil, fmt.Errorf("failed to parse the step.yml, error: %s", err)
+	}
+
+	defaults := map[string]string{}
+	for _, input := range step.Inputs {
+		for key, value := range input {
+			if key == "opts" {
+				continue
+			}
+
+			defaultValue := ""
+			if value != nil {
+				defaultValue = fmt.Sprint(value)
+			}
+			defaults[key] = os.Expand(defaultValue, envRepository.Get)
+		}
+	}
+	return defaults, nil
+}
+
+// readConfigFile reads the inputs of a JSON object file keyed by the input names (like `carthage_command`).
+// Booleans are converted to `yes` and `no`, an input not in the Config fails the read.
+func readConfigFile(pth string) (map[string]string, error) {
+	content, err := os.ReadFile(pth)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(content, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s as a JSON object, error: %s", pth, err)
+	}
+
+	keys := configInputKeys()
+	inputs := map[string]string{}
+	for key, value := range values {
+		if !keys[key] {
+			return nil, fmt.Errorf("unknown input in %s: %s", pth, key)
+		}
+
+		switch value := value.(type) {
+		case string:
+			inputs[key] = value
+		case bool:
+			inputs[key] = "no"
+			if value {
+				inputs[key] = "yes"
+			}
+		case float64:
+			inputs[key] = strconv.FormatFloat(value, 'f', -1, 64)
+		default:
+			return nil, fmt.Errorf("unsupported value of %s in %s, expected a string, number or boolean", key, pth)
+		}
+	}
+	return inputs, nil
+}
+
+// configInputKeys returns the env keys of the Config fields.
+func configInputKeys() map[string]bool {
+	keys := map[string]bool{}
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("env"); tag != "" {
+			keys[strings.Split(tag, ",")[0]] = true
+		}
+	}
+	return keys
+}
+
 func main() {
+	configFile, err := parseConfigFileFlag(os.Args[1:])
+	if err != nil {
+		fail("Invalid arguments: %s", err)
+	}
+	var envRepository env.Repository = env.NewRepository()
+	if configFile != "" {
+		inputs, err := readConfigFile(configFile)
+		if err != nil {
+			fail("Failed to read the config file, error: %s", err)
+		}
+		defaults, err := stepInputDefaults(stepDefinition, envRepository)
+		if err != nil {
+			fail("Failed to read the input defaults, error: %s", err)
+		}
+		log.Printf("Using the inputs of %s, the envs override them", configFile)
+		envRepository = configFileRepository{Repository: envRepository, inputs: inputs, defaults: defaults}
+	}
+
 	var configs Config
-	if err := stepconf.NewInputParser(env.NewRepository()).Parse(&configs); err != nil {
+	if err := stepconf.NewInputParser(envRepository).Parse(&configs); err != nil {
 		fail("Could not create config: %s", err)
 	}
-	stepconf.Print(configs)
+	if configs.PrintOnlySetInputs {
+		fmt.Print(setConfigFieldsString(configs))
+	} else {
+		stepconf.Print(configs)
+	}
 
 	log.SetEnableDebugLog(configs.VerboseLog)
 
+	if configs.PathPrepend != "" {
+		if err := prependPath(configs.PathPrepend, env.NewRepository()); err != nil {
+			fail("Failed to prepend to PATH, error: %s", err)
+		}
+	}
+
+	if configs.CacheSelfTest {
+		if err := runCacheSelfTest(configs.LocalCacheDir); err != nil {
+			fail("Cache self-test failed: %s", err)
+		}
+		log.Donef("Cache self-test passed")
+		return
+	}
+
+	if err := validateCarthageCommand(configs.CarthageCommand, configs.AllowAnyCommand); err != nil {
+		fail("Invalid carthage command: %s", err)
+	}
+
 	// Environment
 	fmt.Println()
 	log.Infof("Environment:")
@@ -70,110 +388,1684 @@ func main() {
 		fail("Failed to get swift version, error: %s", err)
 	}
 	log.Printf("- SwiftVersion: %s", strings.Replace(swiftVersion, "\n", "- ", -1))
+
+	xcodeVersion, err := getXcodeVersion()
+	if err != nil {
+		log.Warnf("Failed to get Xcode version, error: %s", err)
+	} else {
+		log.Printf("- XcodeVersion: %s", xcodeVersion)
+	}
+
+	exportToolVersions(cachedcarthage.EnvmanOutputExporter{}, carthageVersion.String(), parseSwiftVersion(swiftVersion), xcodeVersion)
 	// --
 
+	githubAccessToken := resolveGithubAccessToken(configs.GithubAccessToken, env.NewRepository())
+	if githubAccessToken != "" && carthage.GitHubTokenMode(configs.GithubTokenMode) == carthage.GitHubTokenModeFlag {
+		log.Warnf("The GitHub access token is passed as the --github-access-token argument, it is visible in the process list of the machine while Carthage runs")
+	}
+
 	// Parse options
-	args := parseCarthageOptions(configs)
-	fileProvider := input.NewFileProvider(filedownloader.New(http.DefaultClient))
-	xconfigPath, err := parseXCConfigPath(configs.Xcconfig, configs.XcconfigFromEnv, fileProvider)
+	args := parseCarthageOptions(configs, env.NewRepository())
+	args = ensureNoSkipCurrent(configs.CarthageCommand, args, configs.NoSkipCurrent)
+	args, githubAccessToken = applyUseSSH(configs.CarthageCommand, args, configs.UseSSH, githubAccessToken)
+	if err := cachedcarthage.ValidatePlatforms(args, carthageVersion); err != nil {
+		fail("Unsupported platform: %s", err)
+	}
+	if err := cachedcarthage.ValidateXCFrameworks(args, carthageVersion); err != nil {
+		fail("Unsupported Carthage version: %s", err)
+	}
+	blockedVersions, err := parseBlockedCarthageVersions(configs.BlockedVersions)
+	if err != nil {
+		fail("Invalid blocked Carthage versions: %s", err)
+	}
+	if err := cachedcarthage.ValidateCarthageVersion(carthageVersion, blockedVersions, args); err != nil {
+		fail("Unsupported Carthage version: %s, install another version (for example with `brew upgrade carthage`) or change the blocked_carthage_versions input", err)
+	}
+	if configs.ValidateOptions != "none" && configs.ValidateOptions != "" {
+		if err := cachedcarthage.ValidateOptions(configs.CarthageCommand, args, carthageVersion); err != nil {
+			if configs.ValidateOptions == "fail" {
+				fail("Invalid Carthage options: %s", err)
+			}
+			log.Warnf("Invalid Carthage options: %s", err)
+		}
+	}
+	httpClient, err := newHTTPClient(configs.HTTPProxy, configs.HTTPSProxy, configs.NoProxy)
+	if err != nil {
+		fail("Invalid proxy, error: %s", err)
+	}
+	xcconfigHeaders, err := parseHTTPHeaders(string(configs.XcconfigHeaders))
+	if err != nil {
+		fail("Invalid xcconfig headers, error: %s", err)
+	}
+	var fileProvider FileProvider = input.NewFileProvider(filedownloader.New(headerHTTPClient{client: httpClient, headers: xcconfigHeaders}))
+	if configs.XcconfigCacheDir != "" {
+		xcconfigMaxAge, err := unsignedInput("xcconfig_cache_max_age_minutes", configs.XcconfigMaxAge)
+		if err != nil {
+			fail("Invalid input: %s", err)
+		}
+		fileProvider = newCachedXCConfigProvider(fileProvider, configs.XcconfigCacheDir, time.Duration(xcconfigMaxAge)*time.Minute)
+	}
+	xconfigPath, err := parseXCConfigPath(configs.Xcconfig, configs.XcconfigFromEnv, fileProvider, configs.ValidateXcconfig)
 	if err != nil {
 		fail("Failed to get xcconfig file, error: %s", err)
 	}
+	maxConcurrentCompilation, err := unsignedInput("max_concurrent_compilation", configs.MaxConcurrentCompilation)
+	if err != nil {
+		fail("Invalid input: %s", err)
+	}
+	if maxConcurrentCompilation > 0 {
+		if xconfigPath, err = writeConcurrencyXCConfig(configs.TempDir, xconfigPath, maxConcurrentCompilation); err != nil {
+			fail("Failed to create the xcconfig limiting the compilation jobs, error: %s", err)
+		}
+		log.Printf("Limiting the Swift compilation jobs to %d with: %s", maxConcurrentCompilation, xconfigPath)
+	}
 
-	projectDir := parseProjectDir(configs.SourceDir, args)
-	project := cachedcarthage.NewProject(projectDir)
+	projectDir, err := parseProjectDir(configs.SourceDir, args)
+	if err != nil {
+		fail("Failed to determine project directory, error: %s", err)
+	}
+	args = withProjectDirArg(args, projectDir, configs.SourceDir)
+	projectDirRoot := configs.ProjectDirRoot
+	if projectDirRoot == "" {
+		projectDirRoot = configs.SourceDir
+	}
+	if err := validateProjectDirInRoot(projectDir, projectDirRoot, configs.AllowOutsideRoot); err != nil {
+		fail("Invalid project directory: %s", err)
+	}
+	if configs.AutoPlatform {
+		args = applyAutoPlatform(configs.CarthageCommand, args, projectDir)
+		if err := cachedcarthage.ValidatePlatforms(args, carthageVersion); err != nil {
+			fail("Unsupported platform: %s", err)
+		}
+	}
+	resolvedFilePending := isResolvedFilePending(configs.CarthageCommand, projectDir)
+	if configs.EnforcePinned && !resolvedFilePending {
+		if err := checkPinnedDependencies(projectDir); err != nil {
+			fail("Cartfile.resolved pinning check failed: %s", err)
+		}
+	}
+	if configs.NoUseBinaries && hasArg(noUseBinariesCommands, configs.CarthageCommand) && !resolvedFilePending {
+		if entries, err := readResolvedEntries(projectDir); err != nil {
+			log.Warnf("%s is not appended, failed to read the dependencies, error: %s", noUseBinariesArg, err)
+		} else {
+			args = applyNoUseBinaries(args, entries)
+		}
+	}
+	cacheDir, err := parseCacheDir(configs.CacheDir, projectDir)
+	if err != nil {
+		fail("Failed to determine cache directory, error: %s", err)
+	}
+	if cacheDir != projectDir {
+		log.Printf("Caching the Carthage dir of: %s", cacheDir)
+	}
+	project := newCacheProject(projectDir, cacheDir)
+	resolvedFilePath := filepath.Join(projectDir, "Cartfile.resolved")
+	if configs.ResolvedFilePath != "" {
+		if resolvedFilePath, err = parseResolvedFilePath(configs.ResolvedFilePath, projectDir); err != nil {
+			fail("Invalid Cartfile.resolved path: %s", err)
+		}
+		log.Printf("Using %s as the Cartfile.resolved of the cache key", resolvedFilePath)
+		project = project.WithResolvedFilePath(resolvedFilePath)
+	}
+	if configs.ScanResolvedFiles {
+		if warning, err := multipleResolvedFilesWarning(projectDirRoot, resolvedFilePath); err != nil {
+			log.Warnf("Failed to scan for Cartfile.resolved files, error: %s", err)
+		} else if warning != "" {
+			log.Warnf("%s", warning)
+		}
+	}
 	filecache := cacheutil.New()
-	stateProvider := cachedcarthage.DefaultStateProvider{}
+	stateProvider := cachedcarthage.NewDefaultStateProvider(cachedcarthage.HashAlgorithm(configs.HashAlgorithm))
+	cache := cachedcarthage.NewCache(project, swiftVersion, &filecache, stateProvider).
+		WithNoSkipCurrent(hasArg(args, noSkipCurrentArg)).
+		WithStepVersion(stepVersion).
+		WithXcodeVersion(xcodeVersion).
+		WithHashAlgorithm(cachedcarthage.HashAlgorithm(configs.HashAlgorithm))
+	if configs.IgnoreSwiftVersion {
+		cache = cache.WithoutSwiftVersion()
+	}
+	if xconfigPath != "" {
+		libraryEvolution, err := xcconfigSetting(xconfigPath, cachedcarthage.LibraryEvolutionSetting)
+		if err != nil {
+			log.Warnf("Failed to read %s from the xcconfig, error: %s", cachedcarthage.LibraryEvolutionSetting, err)
+		} else {
+			cache = cache.WithLibraryEvolution(libraryEvolution)
+		}
+	}
+	cartfileOverride := parseCartfileOverride(configs.CartfileOverride, projectDir)
+	if configs.CartfileContents != "" {
+		if cartfileOverride != "" {
+			fail("The Cartfile contents and the Cartfile override inputs can not be used together")
+		}
+		if cartfileOverride, err = writeCartfileContents(configs.CartfileContents); err != nil {
+			fail("Failed to write the Cartfile contents, error: %s", err)
+		}
+	}
+	keyFiles := parseCacheKeyFiles(configs.CacheKeyFiles, projectDir)
+	if cartfileOverride != "" {
+		keyFiles = append(keyFiles, cartfileOverride)
+	}
+	if len(keyFiles) > 0 {
+		if cache, err = cache.WithKeyFiles(keyFiles); err != nil {
+			fail("Failed to hash cache key files, error: %s", err)
+		}
+	}
+	if platforms := parseCachePlatforms(configs.CachePlatforms); len(platforms) > 0 {
+		cache = cache.WithPlatformDirs(platforms)
+	}
+	if configs.CacheDerivedData && configs.CarthageCommand == "bootstrap" {
+		cache = useDerivedDataCache(cache, args)
+	}
+	if configs.CacheCarthageKit && configs.CarthageCommand == "bootstrap" {
+		cache = useCarthageKitCache(cache)
+	}
+	namespace := cacheNamespace{branch: configs.CacheBranch, defaultBranch: configs.CacheDefaultBranch, platformKey: cachedcarthage.PlatformKey(args)}
+	if configs.CarthageCommand == "bootstrap" {
+		exportCacheKey(cache, namespace, cachedcarthage.EnvmanOutputExporter{})
+	}
+	if configs.CacheDebug {
+		logCacheDiagnostics(cache, carthageVersion.String(), args, namespace.branch)
+	}
+	if configs.CacheKeyOutputFile != "" {
+		if err := writeCacheKey(cache, namespace, configs.CacheKeyOutputFile); err != nil {
+			fail("Failed to write the cache key, error: %s", err)
+		}
+		log.Donef("Cache key written to: %s", configs.CacheKeyOutputFile)
+	}
+	if configs.CacheKeyOnly {
+		log.Donef("Cache key only mode, skipping the Carthage command")
+		return
+	}
+	if configs.LocalCacheDir != "" && configs.CarthageCommand == "bootstrap" {
+		cache = useLocalFileCache(cache, configs.LocalCacheDir, cacheDir, namespace)
+	}
+	var dependencyCache cachedcarthage.DependencyCache
+	if configs.DependencyCacheDir != "" && configs.CarthageCommand == "bootstrap" {
+		log.Printf("Using dependency cache dir: %s", configs.DependencyCacheDir)
+		dependencySwiftVersion := swiftVersion
+		if configs.IgnoreSwiftVersion {
+			dependencySwiftVersion = ""
+		}
+		localDependencyCache := cachedcarthage.NewLocalDependencyCache(configs.DependencyCacheDir, cachedcarthage.NewProject(projectDir).WithResolvedFilePath(resolvedFilePath), stateProvider).
+			WithToolchain(dependencySwiftVersion, xcodeVersion).
+			WithPlatformKey(cachedcarthage.PlatformKey(args)).
+			WithBuildArgs(args)
+		if xconfigPath != "" {
+			content, err := expandedXCConfig(xconfigPath)
+			if err != nil {
+				fail("Failed to read the xcconfig for the dependency cache key, error: %s", err)
+			}
+			localDependencyCache = localDependencyCache.WithXCConfig(content)
+		}
+		if localDependencyCache, err = localDependencyCache.WithKeyFiles(keyFiles); err != nil {
+			fail("Failed to hash cache key files, error: %s", err)
+		}
+		dependencyCache = localDependencyCache
+	}
+
+	minFreeDiskMB, err := unsignedInput("min_free_disk_mb", configs.MinFreeDiskMB)
+	if err != nil {
+		fail("Invalid input: %s", err)
+	}
+	dependencyRetry, err := unsignedInput("dependency_retry", configs.DependencyRetry)
+	if err != nil {
+		fail("Invalid input: %s", err)
+	}
+	buildLogTailLines, err := unsignedInput("build_log_tail_lines", configs.BuildLogTailLines)
+	if err != nil {
+		fail("Invalid input: %s", err)
+	}
+	cpuPriority, err := parseCPUPriority(configs.CPUPriority)
+	if err != nil {
+		fail("Invalid input: %s", err)
+	}
+
+	softFailureCodes, err := parseSoftFailureExitCodes(configs.SoftFailureExitCodes)
+	if err != nil {
+		fail("Invalid soft failure exit codes, error: %s", err)
+	}
+
+	var expectedArchs []string
+	if configs.VerifyArchs {
+		if expectedArchs = parseExpectedArchs(configs.ExpectedArchs); len(expectedArchs) == 0 {
+			log.Warnf("Architecture verification is enabled, but no expected architectures are set")
+		}
+	}
+
+	var changedDependencies []string
+	if configs.BuildChangedOnly && configs.CarthageCommand == "bootstrap" {
+		changedDependencies = getChangedDependencies(configs.ResolvedBaseline, projectDir)
+	}
+
+	buildLogPath := ""
+	if configs.VerboseLog {
+		buildLogPath = getBuildLogPath()
+	}
+
+	failureLogDir := ""
+	if configs.DeployLogOnFailure {
+		failureLogDir = configs.DeployDir
+	}
 
 	runner := cachedcarthage.NewRunner(
 		configs.CarthageCommand,
 		args,
-		configs.GithubAccessToken,
+		githubAccessToken,
 		xconfigPath,
-		cachedcarthage.NewCache(project, swiftVersion, &filecache, stateProvider),
-		carthage.NewCLIBuilder(),
+		cache,
+		carthage.NewCLIBuilder().WithGitHubTokenMode(carthage.GitHubTokenMode(configs.GithubTokenMode)),
+		cachedcarthage.EnvmanOutputExporter{},
+		cachedcarthage.RunnerOpts{
+			ProjectDir:               projectDir,
+			TempDir:                  configs.TempDir,
+			GitCredentialHelper:      configs.GitCredHelper,
+			HTTPProxy:                configs.HTTPProxy,
+			HTTPSProxy:               configs.HTTPSProxy,
+			NoProxy:                  configs.NoProxy,
+			Locale:                   configs.Locale,
+			MinFreeDiskMB:            uint64(minFreeDiskMB),
+			FailOnLowDiskSpace:       configs.FailOnLowDiskSpace,
+			SummaryPath:              configs.SummaryPath,
+			DisableStatusLine:        !configs.PrintStatusLine,
+			MetricsPath:              configs.MetricsFile,
+			JUnitReportPath:          configs.JUnitReportPath,
+			ProblemMatcher:           configs.ProblemMatcher,
+			SeparateOutputStreams:    configs.SeparateOutputStreams,
+			LogStreamURL:             configs.LogStreamURL,
+			LogStreamClient:          httpClient,
+			LogStreamSecrets:         logStreamSecrets(xcconfigHeaders, proxyURLs(configs, env.NewRepository())...),
+			BuildLogPath:             buildLogPath,
+			BuildLogTailLines:        buildLogTailLines,
+			FailureLogDir:            failureLogDir,
+			DependencyRetry:          dependencyRetry,
+			RaiseOpenFilesLimit:      configs.RaiseOpenFiles,
+			CPUPriority:              cpuPriority,
+			ChangedDependencies:      changedDependencies,
+			DependencyCache:          dependencyCache,
+			NoSharedSchemesMode:      cachedcarthage.NoSharedSchemesMode(configs.NoSharedSchemes),
+			DuplicateFrameworksMode:  cachedcarthage.DuplicateFrameworksMode(configs.DuplicateFwks),
+			RequireFrameworks:        configs.RequirePlatformFw,
+			ExpectedArchs:            expectedArchs,
+			ExpectedCodeSignature:    strings.TrimSpace(configs.ExpectedSignature),
+			RequireCacheHit:          configs.RequireCacheHit,
+			RequireResolvedFile:      configs.RequireResolvedFile,
+			DisableCacheSave:         !configs.SaveCache,
+			VersionFileReconcileMode: cachedcarthage.VersionFileReconcileMode(configs.VersionFilesReconcile),
+			MakeRestoredWritable:     configs.MakeRestoredWritable,
+			RemoveDSYMs:              configs.CacheRemoveDSYMs,
+			StripBitcode:             configs.CacheStripBitcode,
+			StaleBuildDirMode:        cachedcarthage.StaleBuildDirMode(configs.StaleBuildDir),
+			CarthageVersion:          carthageVersion.String(),
+			SwiftVersion:             swiftVersion,
+		},
 	)
-	if err := runner.Run(); err != nil {
-		fail("Failed to execute step: %s", err)
-	}
-}
 
-func parseXCConfigPath(pathFromStepInput string, pathFromEnv string, fileProvider FileProvider) (string, error) {
-	pathToUse := ""
-	if pathFromStepInput != "" {
-		localPath, err := fileProvider.LocalPath(pathFromStepInput)
-		if err != nil {
-			return "", err
+	restoreCartfile := func() error { return nil }
+	if cartfileOverride != "" {
+		if restoreCartfile, err = overrideCartfile(projectDir, cartfileOverride); err != nil {
+			fail("Failed to override the Cartfile, error: %s", err)
 		}
-		pathToUse = localPath
 	}
 
-	if pathFromEnv != "" {
-		if pathToUse != "" {
-			log.Warnf("Both `xcconfig` input and `XCODE_XCCONFIG_FILE` are set. Using `xcconfig` input.")
-		} else {
-			pathToUse = pathFromEnv
+	result, err := runner.RunContext(context.Background())
+	if restoreErr := restoreCartfile(); restoreErr != nil {
+		log.Warnf("Failed to restore the original Cartfile, error: %s", restoreErr)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, cachedcarthage.ErrValidation):
+			fail("Step preconditions not met: %s", err)
+		case errors.Is(err, cachedcarthage.ErrCache):
+			fail("Cache failed: %s", err)
+		default:
+			fail("Failed to execute step: %s", err)
 		}
 	}
 
-	return pathToUse, nil
+	if code, condition := softFailureExitCode(result, softFailureCodes); code != 0 {
+		log.Warnf("Exiting with %d, soft failure condition met: %s", code, condition)
+		os.Exit(code)
+	}
 }
 
-func parseCarthageOptions(config Config) []string {
-	var customCarthageOptions []string
-	if config.CarthageOptions != "" {
-		options, err := shellquote.Split(config.CarthageOptions)
-		if err != nil {
-			fail("Failed to shell split CarthageOptions (%s), error: %s", config.CarthageOptions)
-		}
-		customCarthageOptions = options
+// unsignedInput returns the value of a numeric input not allowed to be negative.
+// These inputs are parsed as int, as stepconf does not support the unsigned types.
+func unsignedInput(key string, value int) (uint, error) {
+	if value < 0 {
+		return 0, fmt.Errorf("%s must not be negative, got %d", key, value)
 	}
-	return customCarthageOptions
+	return uint(value), nil
 }
 
-func getCarthageVersion() (*version.Version, error) {
-	cmd := carthage.NewCLIBuilder().Append("version").Command(nil, nil)
-	out, err := cmd.RunAndReturnTrimmedCombinedOutput()
+// writeCacheKey writes the cache key into the file, without a trailing newline.
+func writeCacheKey(cache cachedcarthage.Cache, namespace cacheNamespace, pth string) error {
+	key, _, err := namespace.keys(cache)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// if output is multi-line, get the last line of string
-	// parse Version from cmd output
-	for _, outLine := range strings.Split(out, "\n") {
-		if currentVersion, err := version.NewVersion(outLine); err == nil {
-			return currentVersion, nil
-		}
+	if err := os.MkdirAll(filepath.Dir(pth), 0777); err != nil {
+		return fmt.Errorf("failed to create dir (%s), error: %s", filepath.Dir(pth), err)
 	}
+	return fileutil.WriteStringToFile(pth, key)
+}
 
-	return nil, fmt.Errorf("failed to parse `$ carthage version` output: %s", out)
+// exportCacheKey logs and exports the namespaced cache key, together with the Step version it depends on,
+// and the fallback keys of the default branch and the other platforms.
+func exportCacheKey(cache cachedcarthage.Cache, namespace cacheNamespace, exporter cachedcarthage.OutputExporter) {
+	key, restoreKeys, err := namespace.keys(cache)
+	if err != nil {
+		log.Warnf("Failed to compute cache key: %s", err)
+		return
+	}
+
+	if stepVersion != "" {
+		log.Printf("Cache key: %s (step version: %s)", key, stepVersion)
+	} else {
+		log.Printf("Cache key: %s", key)
+	}
+
+	if err := exporter.ExportOutput(cacheKeyOutputKey, key); err != nil {
+		log.Warnf("Failed to export %s, error: %s", cacheKeyOutputKey, err)
+	}
+	if err := exporter.ExportOutput(cacheRestoreKeysOutputKey, strings.Join(restoreKeys, "\n")); err != nil {
+		log.Warnf("Failed to export %s, error: %s", cacheRestoreKeysOutputKey, err)
+	}
 }
 
-func getSwiftVersion() (string, error) {
-	cmd := command.NewFactory(env.NewRepository()).Create("swift", []string{"-version"}, nil)
-	return cmd.RunAndReturnTrimmedCombinedOutput()
+// getChangedDependencies returns the dependencies changed compared to the baseline Cartfile.resolved,
+// nil (building every dependency) if they can not be determined.
+func getChangedDependencies(baseline, projectDir string) []string {
+	if baseline == "" {
+		log.Warnf("Building every dependency, no Cartfile.resolved baseline provided")
+		return nil
+	}
+
+	baselineContent, err := readResolvedBaseline(baseline, projectDir)
+	if err != nil {
+		log.Warnf("Building every dependency, failed to read the Cartfile.resolved baseline: %s", err)
+		return nil
+	}
+
+	content, err := fileutil.ReadStringFromFile(filepath.Join(projectDir, "Cartfile.resolved"))
+	if err != nil {
+		log.Warnf("Building every dependency, failed to read Cartfile.resolved: %s", err)
+		return nil
+	}
+
+	changed := cachedcarthage.ChangedDependencies(baselineContent, content)
+	log.Printf("Changed dependencies compared to %s: %s", baseline, strings.Join(changed, ", "))
+	return changed
 }
 
-func parseProjectDir(originalDir string, customCarthageOptions []string) string {
-	projectDir := originalDir
+// getBuildLogPath returns a temporary path for the xcodebuild log, or empty if no temp dir can be created.
+func getBuildLogPath() string {
+	tmpDir, err := pathutil.NormalizedOSTempDirPath("carthage-log")
+	if err != nil {
+		log.Warnf("Failed to create temp dir for the xcodebuild log: %s", err)
+		return ""
+	}
+	return filepath.Join(tmpDir, "xcodebuild.log")
+}
 
-	isNextOptionProjectDir := false
-	for _, option := range customCarthageOptions {
-		if option == projectDirArg {
-			isNextOptionProjectDir = true
-			continue
-		}
+// isResolvedFilePending returns if the project has no Cartfile.resolved yet, but the command creates it (`carthage update`),
+// so its absence is not an error and the checks of the resolved dependencies are skipped.
+func isResolvedFilePending(carthageCommand, projectDir string) bool {
+	if carthageCommand != "update" {
+		return false
+	}
 
-		if isNextOptionProjectDir {
-			projectDir = option
+	resolvedPath := filepath.Join(projectDir, "Cartfile.resolved")
+	if exists, err := pathutil.IsPathExists(resolvedPath); err != nil || exists {
+		return false
+	}
 
-			fmt.Println()
-			log.Infof("--project-directory flag found with value: %s", projectDir)
-			log.Printf("using %s as working directory", projectDir)
+	log.Printf("No Cartfile.resolved found yet, `carthage update` creates it, skipping the checks of the resolved dependencies")
+	return true
+}
+
+// checkPinnedDependencies fails if a Cartfile.resolved entry is resolved to a floating ref (like a branch).
+func checkPinnedDependencies(projectDir string) error {
+	entries, err := readResolvedEntries(projectDir)
+	if err != nil {
+		return err
+	}
+
+	unpinned := cachedcarthage.UnpinnedEntries(entries)
+	if len(unpinned) == 0 {
+		log.Donef("Every dependency is pinned to a version or commit")
+		return nil
+	}
+
+	var descriptions []string
+	for _, entry := range unpinned {
+		descriptions = append(descriptions, fmt.Sprintf("%s (%s)", entry.Name(), entry.Version))
+	}
+	return fmt.Errorf("dependencies not pinned to a version tag or commit: %s", strings.Join(descriptions, ", "))
+}
 
-			break
+// readResolvedEntries parses the project's Cartfile.resolved.
+func readResolvedEntries(projectDir string) ([]cachedcarthage.ResolvedEntry, error) {
+	resolvedPath := filepath.Join(projectDir, "Cartfile.resolved")
+	file, err := os.Open(resolvedPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s, error: %s", resolvedPath, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %s", resolvedPath, err)
 		}
+	}()
+
+	return cachedcarthage.ParseResolved(file)
+}
+
+// readResolvedBaseline reads the baseline from the given file, or from the given git ref of the project's repository.
+func readResolvedBaseline(baseline, projectDir string) (string, error) {
+	if exists, err := pathutil.IsPathExists(baseline); err == nil && exists {
+		return fileutil.ReadStringFromFile(baseline)
+	}
+
+	cmd := command.NewFactory(env.NewRepository()).Create("git", []string{"show", baseline + ":./Cartfile.resolved"}, &command.Opts{Dir: projectDir})
+	return cmd.RunAndReturnTrimmedOutput()
+}
+
+func logCacheDiagnostics(cache cachedcarthage.Cache, carthageVersion string, args []string, branch string) {
+	lines, err := cache.Diagnostics(carthageVersion, args, branch)
+	if err != nil {
+		log.Warnf("Failed to collect cache diagnostics: %s", err)
+		return
+	}
+
+	fmt.Println()
+	log.Infof("Cache diagnostics:")
+	for _, line := range lines {
+		log.Printf("- %s", line)
+	}
+}
+
+// useDerivedDataCache returns a cache caching the Carthage command's DerivedData dir too.
+func useDerivedDataCache(cache cachedcarthage.Cache, args []string) cachedcarthage.Cache {
+	derivedDataDir, err := cachedcarthage.DerivedDataDir(args)
+	if err != nil {
+		log.Warnf("DerivedData will not be cached, failed to determine DerivedData dir: %s", err)
+		return cache
 	}
 
-	return projectDir
+	log.Printf("Caching DerivedData dir: %s", derivedDataDir)
+	return cache.WithDerivedDataDir(derivedDataDir)
+}
+
+// useCarthageKitCache returns a cache caching Carthage's own download cache dir too.
+func useCarthageKitCache(cache cachedcarthage.Cache) cachedcarthage.Cache {
+	carthageKitDir, err := cachedcarthage.CarthageKitCacheDir()
+	if err != nil {
+		log.Warnf("The CarthageKit cache dir will not be cached, failed to determine its path: %s", err)
+		return cache
+	}
+
+	log.Printf("Caching CarthageKit cache dir: %s", carthageKitDir)
+	return cache.WithCarthageKitCacheDir(carthageKitDir)
+}
+
+// useLocalFileCache restores the cache from the local cache dir and returns a cache committing into it.
+// The archives are namespaced by the branch, falling back to the default branch's archive on restore.
+func useLocalFileCache(cache cachedcarthage.Cache, localCacheDir, projectDir string, namespace cacheNamespace) cachedcarthage.Cache {
+	fmt.Println()
+	log.Infof("Using local cache dir: %s", localCacheDir)
+
+	key, err := cache.Key()
+	if err != nil {
+		log.Warnf("Local cache disabled, failed to compute cache key: %s", err)
+		return cache
+	}
+
+	absProjectDir, err := filepath.Abs(projectDir)
+	if err != nil {
+		log.Warnf("Local cache disabled, failed to determine absolute project dir: %s", err)
+		return cache
+	}
+
+	archiveKey, restoreKeys, restorePrefixes, anyPlatformRestorePrefixes := localCacheKeys(key, namespace.platformKey, namespace.branch, namespace.defaultBranch)
+	localFileCache := cachedcarthage.NewLocalFileCache(localCacheDir, archiveKey, absProjectDir).
+		WithRestoreKeys(restoreKeys...).
+		WithRestorePrefixes(restorePrefixes...).
+		WithAnyPlatformRestorePrefixes(anyPlatformRestorePrefixes...).
+		WithExternalDirs(cache.ExternalDirs()...)
+	if restored, err := localFileCache.Restore(); err != nil {
+		log.Warnf("Failed to restore local cache: %s", err)
+	} else if !restored {
+		log.Printf("No local cache found for the cache key")
+	}
+
+	return cache.WithFileCache(localFileCache)
+}
+
+// cacheNamespace namespaces the cache key by the branch (see the cache_branch input) and the built platforms,
+// falling back to the default branch's cache.
+type cacheNamespace struct {
+	branch        string
+	defaultBranch string
+	platformKey   string
+}
+
+// keys returns the namespaced cache key (`<branch>-<platforms>-<cache key>`), the same the local cache archive is saved with,
+// and the keys of the fallback caches in the order they are tried, the key prefixes ending with `-` (see localCacheKeys).
+func (namespace cacheNamespace) keys(cache cachedcarthage.Cache) (string, []string, error) {
+	key, err := cache.Key()
+	if err != nil {
+		return "", nil, err
+	}
+
+	namespacedKey, restoreKeys, restorePrefixes, anyPlatformRestorePrefixes := localCacheKeys(key, namespace.platformKey, namespace.branch, namespace.defaultBranch)
+	restoreKeys = append(restoreKeys, restorePrefixes...)
+	return namespacedKey, append(restoreKeys, anyPlatformRestorePrefixes...), nil
+}
+
+// localCacheKeys returns the key the local cache archive is saved with (`<branch>-<platforms>-<cache key>`),
+// the exact keys of the default branch and the prefixes of the fallback archives, in the order they are tried:
+// the same platforms on the branch and the default branch, then any archive of the branch and the default branch.
+// Without a branch, archives of other platforms are not used as a fallback.
+func localCacheKeys(key, platformKey, branch, defaultBranch string) (string, []string, []string, []string) {
+	namespaces := []string{branch}
+	if defaultBranch != "" && defaultBranch != branch {
+		namespaces = append(namespaces, defaultBranch)
+	}
+
+	platformScopedKey := cachedcarthage.NamespacedKey(platformKey, key)
+
+	var restoreKeys []string
+	for _, namespace := range namespaces[1:] {
+		restoreKeys = append(restoreKeys, cachedcarthage.NamespacedKey(namespace, platformScopedKey))
+	}
+
+	var restorePrefixes []string
+	if platformKey != "" {
+		for _, namespace := range namespaces {
+			restorePrefixes = append(restorePrefixes, cachedcarthage.NamespacedKey(namespace, platformKey)+"-")
+		}
+	}
+	var anyPlatformRestorePrefixes []string
+	for _, namespace := range namespaces {
+		if namespace != "" {
+			anyPlatformRestorePrefixes = append(anyPlatformRestorePrefixes, cachedcarthage.NamespacedKey(namespace, ""))
+		}
+	}
+
+	return cachedcarthage.KeyPrefix(branch, platformKey) + key, restoreKeys, restorePrefixes, anyPlatformRestorePrefixes
+}
+
+// runCacheSelfTest round-trips a sentinel directory through the local cache.
+func runCacheSelfTest(localCacheDir string) error {
+	if localCacheDir == "" {
+		return fmt.Errorf("local_cache_dir is not set, the self-test requires a local cache")
+	}
+
+	fmt.Println()
+	log.Infof("Running cache self-test with local cache dir: %s", localCacheDir)
+
+	rootDir, err := os.MkdirTemp("", "carthage-cache-selftest")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory, error: %s", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(rootDir); err != nil {
+			log.Warnf("Failed to remove %s, error: %s", rootDir, err)
+		}
+	}()
+
+	return cachedcarthage.RunCacheSelfTest(cachedcarthage.NewLocalFileCache(localCacheDir, cachedcarthage.SelfTestKey, rootDir), rootDir)
+}
+
+// resolveGithubAccessToken returns the token from the input, falling back to the commonly used GitHub token envs.
+// The whitespace of the token (like the trailing newline of a secret file) is removed.
+func resolveGithubAccessToken(tokenFromInput stepconf.Secret, envRepository env.Repository) stepconf.Secret {
+	if token := sanitizeGithubAccessToken(string(tokenFromInput), "the `github_access_token` input"); token != "" {
+		log.Printf("Using GitHub access token from the `github_access_token` input")
+		return token
+	}
+
+	for _, key := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if token := sanitizeGithubAccessToken(envRepository.Get(key), fmt.Sprintf("the `%s` env", key)); token != "" {
+			log.Printf("Using GitHub access token from the `%s` env", key)
+			return token
+		}
+	}
+
+	log.Warnf("No GitHub access token provided, you may hit GitHub rate limits")
+	return ""
+}
+
+// sanitizeGithubAccessToken removes the whitespace of the token, which would otherwise break the authorization header,
+// warning (without the value) if the token had any.
+func sanitizeGithubAccessToken(token, source string) stepconf.Secret {
+	sanitized := strings.Join(strings.Fields(token), "")
+	if sanitized == token {
+		return stepconf.Secret(token)
+	}
+
+	if trimmed := strings.TrimSpace(token); trimmed == sanitized {
+		log.Warnf("The GitHub access token of %s has leading or trailing whitespace, it is trimmed", source)
+	} else {
+		log.Warnf("The GitHub access token of %s contains whitespace or newlines, they are removed", source)
+	}
+	return stepconf.Secret(sanitized)
+}
+
+// newHTTPClient returns the client downloading the xcconfig file, which uses the given proxies,
+// falling back to the proxy envs of the Step for an unset one.
+func newHTTPClient(httpProxy, httpsProxy, noProxy string) (*http.Client, error) {
+	if httpProxy == "" && httpsProxy == "" {
+		return http.DefaultClient, nil
+	}
+
+	proxies := map[string]*url.URL{}
+	for scheme, proxy := range map[string]string{"http": httpProxy, "https": httpsProxy} {
+		if proxy == "" {
+			continue
+		}
+
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid %s proxy URL: %s", scheme, proxy)
+		}
+		proxies[scheme] = proxyURL
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		proxyURL, ok := proxies[req.URL.Scheme]
+		if !ok {
+			return http.ProxyFromEnvironment(req)
+		}
+		if isNoProxyHost(req.URL.Hostname(), noProxy) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// isNoProxyHost returns if the host matches an entry of the comma separated no proxy list:
+// `*` matches every host, other entries match the host itself and its subdomains.
+func isNoProxyHost(host, noProxy string) bool {
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.TrimPrefix(strings.TrimSpace(entry), ".")
+		if entry == "" {
+			continue
+		}
+		if entry == "*" || strings.EqualFold(host, entry) || strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerHTTPClient sends the requests of the wrapped client with the given headers.
+type headerHTTPClient struct {
+	client  filedownloader.HTTPClient
+	headers http.Header
+}
+
+// Do ...
+func (c headerHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	for key, values := range c.headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return c.client.Do(req)
+}
+
+// parseHTTPHeaders parses the newline separated `Key: Value` headers, empty lines are skipped.
+// The errors never contain the header values, as they may be secrets.
+func parseHTTPHeaders(lines string) (http.Header, error) {
+	headers := http.Header{}
+	for i, line := range strings.Split(lines, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		split := strings.SplitN(line, ":", 2)
+		key := strings.TrimSpace(split[0])
+		if len(split) != 2 || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("invalid header in line %d, expected format: Key: Value", i+1)
+		}
+		headers.Add(key, strings.TrimSpace(split[1]))
+	}
+	return headers, nil
+}
+
+// proxyURLs returns the proxy URLs of the inputs and of the uppercase proxy envs, which the Carthage command may use too.
+func proxyURLs(configs Config, envRepository env.Repository) []string {
+	return []string{configs.HTTPProxy, configs.HTTPSProxy, envRepository.Get("HTTP_PROXY"), envRepository.Get("HTTPS_PROXY")}
+}
+
+// logStreamSecrets returns the values redacted from the streamed log, besides the GitHub access token:
+// the xcconfig header values and the credentials of the proxy URLs.
+func logStreamSecrets(headers http.Header, proxies ...string) []string {
+	var secrets []string
+	for _, values := range headers {
+		secrets = append(secrets, values...)
+	}
+
+	for _, proxy := range proxies {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.User == nil {
+			continue
+		}
+
+		secrets = append(secrets, proxyURL.User.String())
+		if password, ok := proxyURL.User.Password(); ok {
+			secrets = append(secrets, password, proxyURL.User.Username())
+		}
+	}
+	return secrets
+}
+
+// cachedXCConfigProvider keeps a copy of the xcconfig files downloaded by the wrapped provider in a local dir, by their URL,
+// and returns the copy instead of downloading the file again, until it gets older than the max age (never, if 0).
+// Local (`file://`) paths are passed to the wrapped provider.
+type cachedXCConfigProvider struct {
+	provider FileProvider
+	dir      string
+	maxAge   time.Duration
+	now      func() time.Time
+}
+
+func newCachedXCConfigProvider(provider FileProvider, dir string, maxAge time.Duration) cachedXCConfigProvider {
+	return cachedXCConfigProvider{
+		provider: provider,
+		dir:      dir,
+		maxAge:   maxAge,
+		now:      time.Now,
+	}
+}
+
+// LocalPath returns the path of the cached copy of the URL, if it is not expired and is a valid xcconfig,
+// downloads the file and caches it otherwise. Failing to cache the file is only printed as a warning.
+func (p cachedXCConfigProvider) LocalPath(path string) (string, error) {
+	if strings.HasPrefix(path, "file://") {
+		return p.provider.LocalPath(path)
+	}
+
+	// The URL is not printed, as it may contain a token.
+	cachedPath := filepath.Join(p.dir, fmt.Sprintf("%x.xcconfig", sha256.Sum256([]byte(path))))
+	if info, err := os.Stat(cachedPath); err == nil {
+		age := p.now().Sub(info.ModTime())
+		if p.maxAge > 0 && age > p.maxAge {
+			log.Printf("The cached xcconfig (%s) is expired (%s old), downloading it again", cachedPath, age.Round(time.Second))
+		} else if err := validateXCConfigFile(cachedPath); err != nil {
+			log.Warnf("The cached xcconfig is invalid, downloading it again: %s", err)
+		} else {
+			log.Donef("Using the cached xcconfig: %s", cachedPath)
+			return cachedPath, nil
+		}
+	}
+
+	downloadedPath, err := p.provider.LocalPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if err := validateXCConfigFile(downloadedPath); err != nil {
+		log.Warnf("The downloaded xcconfig is not cached: %s", err)
+		return downloadedPath, nil
+	}
+	if err := copyCachedFile(downloadedPath, cachedPath); err != nil {
+		log.Warnf("Failed to cache the downloaded xcconfig, error: %s", err)
+		return downloadedPath, nil
+	}
+
+	log.Printf("Cached the downloaded xcconfig: %s", cachedPath)
+	return cachedPath, nil
+}
+
+// copyCachedFile copies the file into the cache through a temporary file,
+// so a Step reading the cache concurrently never sees a partially written copy.
+func copyCachedFile(src, dst string) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	tmpPath := dst + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
+
+func parseXCConfigPath(pathFromStepInput string, pathFromEnv string, fileProvider FileProvider, validateContent bool) (string, error) {
+	pathToUse := ""
+	if pathFromStepInput != "" {
+		localPath, err := fileProvider.LocalPath(pathFromStepInput)
+		if err != nil {
+			return "", err
+		}
+		pathToUse = localPath
+	}
+
+	if pathFromEnv != "" {
+		if pathToUse != "" {
+			log.Warnf("Both `xcconfig` input and `XCODE_XCCONFIG_FILE` are set. Using `xcconfig` input.")
+		} else {
+			pathToUse = pathFromEnv
+		}
+	}
+
+	if pathToUse != "" && validateContent {
+		if err := validateXCConfigFile(pathToUse); err != nil {
+			return "", err
+		}
+	}
+
+	return pathToUse, nil
+}
+
+// validateXCConfigFile fails if the file is empty or has no build setting or `#include` line,
+// like an HTML error page downloaded instead of the xcconfig.
+func validateXCConfigFile(pth string) error {
+	content, err := fileutil.ReadStringFromFile(pth)
+	if err != nil {
+		return fmt.Errorf("failed to read xcconfig file (%s), error: %s", pth, err)
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return fmt.Errorf("xcconfig file (%s) is empty", pth)
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if xcconfigLinePattern.MatchString(line) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("xcconfig file (%s) does not contain any `KEY = value` or `#include` line", pth)
+}
+
+// writeConcurrencyXCConfig writes an xcconfig limiting the parallel Swift compilation jobs into a new temporary directory
+// (inside tempDir, if set), including the given xcconfig first, so its settings are kept.
+func writeConcurrencyXCConfig(tempDir, baseXCConfigPath string, maxJobs uint) (string, error) {
+	if tempDir != "" {
+		if err := os.MkdirAll(tempDir, 0755); err != nil {
+			return "", err
+		}
+	}
+
+	dir, err := os.MkdirTemp(tempDir, "carthage-xcconfig")
+	if err != nil {
+		return "", err
+	}
+
+	var content strings.Builder
+	if baseXCConfigPath != "" {
+		absBaseXCConfigPath, err := filepath.Abs(baseXCConfigPath)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&content, "#include \"%s\"\n", absBaseXCConfigPath)
+	}
+	fmt.Fprintf(&content, "OTHER_SWIFT_FLAGS = $(inherited) -j%d\n", maxJobs)
+
+	pth := filepath.Join(dir, "concurrency.xcconfig")
+	if err := fileutil.WriteStringToFile(pth, content.String()); err != nil {
+		return "", err
+	}
+	return pth, nil
+}
+
+// maxXCConfigIncludeDepth limits the nesting of the followed `#include` lines, to stop on include cycles.
+const maxXCConfigIncludeDepth = 16
+
+// xcconfigSetting returns the value of the build setting in the xcconfig file, following its `#include` lines,
+// the last assignment wins. The value is empty if the setting is not assigned.
+func xcconfigSetting(pth, setting string) (string, error) {
+	return xcconfigSettingAtDepth(pth, setting, 0)
+}
+
+func xcconfigSettingAtDepth(pth, setting string, depth int) (string, error) {
+	if depth > maxXCConfigIncludeDepth {
+		return "", fmt.Errorf("xcconfig includes nested deeper than %d levels at: %s", maxXCConfigIncludeDepth, pth)
+	}
+
+	content, err := fileutil.ReadStringFromFile(pth)
+	if err != nil {
+		return "", fmt.Errorf("failed to read xcconfig file (%s), error: %s", pth, err)
+	}
+
+	value := ""
+	for _, line := range strings.Split(content, "\n") {
+		if match := xcconfigIncludePattern.FindStringSubmatch(line); match != nil {
+			includePath := match[1]
+			if !filepath.IsAbs(includePath) {
+				includePath = filepath.Join(filepath.Dir(pth), includePath)
+			}
+
+			optional := strings.HasPrefix(strings.TrimSpace(line), "#include?")
+			if exists, err := pathutil.IsPathExists(includePath); err == nil && !exists && optional {
+				continue
+			}
+
+			includedValue, err := xcconfigSettingAtDepth(includePath, setting, depth+1)
+			if err != nil {
+				return "", err
+			}
+			if includedValue != "" {
+				value = includedValue
+			}
+			continue
+		}
+
+		line = strings.SplitN(line, "//", 2)[0]
+		if match := xcconfigSettingPattern.FindStringSubmatch(line); match != nil && match[1] == setting {
+			value = strings.TrimSpace(match[2])
+		}
+	}
+
+	return value, nil
+}
+
+// expandedXCConfig returns the content of the xcconfig file with its `#include` lines replaced by the included files' content,
+// so it only depends on the build settings, not on where the included files are (like a generated xcconfig in a temporary dir).
+func expandedXCConfig(pth string) (string, error) {
+	return expandedXCConfigAtDepth(pth, 0)
+}
+
+func expandedXCConfigAtDepth(pth string, depth int) (string, error) {
+	if depth > maxXCConfigIncludeDepth {
+		return "", fmt.Errorf("xcconfig includes nested deeper than %d levels at: %s", maxXCConfigIncludeDepth, pth)
+	}
+
+	content, err := fileutil.ReadStringFromFile(pth)
+	if err != nil {
+		return "", fmt.Errorf("failed to read xcconfig file (%s), error: %s", pth, err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		match := xcconfigIncludePattern.FindStringSubmatch(line)
+		if match == nil {
+			lines = append(lines, line)
+			continue
+		}
+
+		includePath := match[1]
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(pth), includePath)
+		}
+
+		optional := strings.HasPrefix(strings.TrimSpace(line), "#include?")
+		if exists, err := pathutil.IsPathExists(includePath); err == nil && !exists && optional {
+			continue
+		}
+
+		included, err := expandedXCConfigAtDepth(includePath, depth+1)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, included)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func parseCarthageOptions(config Config, envRepository env.Repository) []string {
+	customCarthageOptions := splitCarthageOptions("CarthageOptions", config.CarthageOptions)
+
+	switch config.CarthageCommand {
+	case "bootstrap":
+		customCarthageOptions = append(customCarthageOptions, splitCarthageOptions("BootstrapOptions", config.BootstrapOptions)...)
+	case "update":
+		customCarthageOptions = append(customCarthageOptions, splitCarthageOptions("UpdateOptions", config.UpdateOptions)...)
+	}
+
+	if config.ExpandOptions {
+		customCarthageOptions = expandCarthageOptions(customCarthageOptions, envRepository)
+	}
+	return customCarthageOptions
+}
+
+func splitCarthageOptions(name, options string) []string {
+	if options == "" {
+		return nil
+	}
+
+	splitOptions, err := shellquote.Split(options)
+	if err != nil {
+		fail("Failed to shell split %s (%s), error: %s", name, options, err)
+	}
+	return splitOptions
+}
+
+// expandCarthageOptions replaces the `$VAR` and `${VAR}` references of the options with the environment variables' values,
+// after splitting, so an expanded value containing spaces stays a single option.
+func expandCarthageOptions(options []string, envRepository env.Repository) []string {
+	expandedOptions := make([]string, 0, len(options))
+	for _, option := range options {
+		expandedOptions = append(expandedOptions, os.Expand(option, func(key string) string {
+			value := envRepository.Get(key)
+			if value == "" {
+				log.Warnf("Environment variable %s referenced in the Carthage options is not set", key)
+			}
+			return value
+		}))
+	}
+	return expandedOptions
+}
+
+// prependPath puts the colon or newline separated dirs in front of the PATH of the Step, in the given order,
+// so the version detection and the Carthage command find the same tools (like swift and xcodebuild).
+// A dir already on the PATH is moved to the front.
+func prependPath(dirs string, envRepository env.Repository) error {
+	var entries []string
+	for _, dir := range strings.FieldsFunc(dirs, func(r rune) bool {
+		return r == ':' || r == '\n'
+	}) {
+		if dir = strings.TrimSpace(dir); dir != "" && !hasArg(entries, dir) {
+			entries = append(entries, dir)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	path := append([]string{}, entries...)
+	for _, dir := range filepath.SplitList(envRepository.Get("PATH")) {
+		if dir != "" && !hasArg(entries, dir) {
+			path = append(path, dir)
+		}
+	}
+
+	log.Printf("Prepending to PATH: %s", strings.Join(entries, string(os.PathListSeparator)))
+	return envRepository.Set("PATH", strings.Join(path, string(os.PathListSeparator)))
+}
+
+func getCarthageVersion() (*version.Version, error) {
+	cmd := carthage.NewCLIBuilder().Append("version").Command(context.Background(), nil, nil)
+	out, err := cmd.RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+
+	// if output is multi-line, get the last line of string
+	// parse Version from cmd output
+	for _, outLine := range strings.Split(out, "\n") {
+		if currentVersion, err := version.NewVersion(outLine); err == nil {
+			return currentVersion, nil
+		}
+	}
+
+	return nil, fmt.Errorf("failed to parse `$ carthage version` output: %s", out)
+}
+
+func getSwiftVersion() (string, error) {
+	cmd := command.NewFactory(env.NewRepository()).Create("swift", []string{"-version"}, nil)
+	return cmd.RunAndReturnTrimmedCombinedOutput()
+}
+
+func validateCarthageCommand(carthageCommand string, allowAny bool) error {
+	if hasArg(allowedCarthageCommands, carthageCommand) {
+		return nil
+	}
+
+	if allowAny {
+		log.Warnf("`%s` is not an allowlisted Carthage command, running it as any command is allowed", carthageCommand)
+		return nil
+	}
+
+	return fmt.Errorf("`%s` is not allowed, allowed commands: %s (enable **Allow any Carthage command** to run other commands)", carthageCommand, strings.Join(allowedCarthageCommands, ", "))
+}
+
+// ensureNoSkipCurrent warns if `carthage build` would build the current project's own schemes too,
+// and appends `--no-skip-current` if autoAppend is set.
+func ensureNoSkipCurrent(carthageCommand string, args []string, autoAppend bool) []string {
+	if carthageCommand != "build" || hasArg(args, noSkipCurrentArg) {
+		return args
+	}
+
+	if autoAppend {
+		log.Printf("Appending %s to the Carthage options", noSkipCurrentArg)
+		return append(args, noSkipCurrentArg)
+	}
+
+	log.Warnf("`carthage build` without %s builds the current project's own schemes too, enable **Build without skipping the current project** if it's not expected", noSkipCurrentArg)
+	return args
+}
+
+// useSSHCommands are the Carthage commands cloning the dependencies, which accept `--use-ssh`.
+var useSSHCommands = []string{"bootstrap", "checkout", "outdated", "update"}
+
+// applyUseSSH appends `--use-ssh` for the commands cloning the dependencies, if enabled,
+// and drops the GitHub access token, so it does not conflict with the SSH authentication.
+func applyUseSSH(carthageCommand string, args []string, useSSH bool, githubAccessToken stepconf.Secret) ([]string, stepconf.Secret) {
+	if !useSSH {
+		return args, githubAccessToken
+	}
+
+	if githubAccessToken != "" {
+		log.Warnf("A GitHub access token is set, but it is not used as the dependencies are cloned over SSH")
+	}
+
+	if hasArg(useSSHCommands, carthageCommand) && !hasArg(args, useSSHArg) {
+		log.Printf("Appending %s to the Carthage options", useSSHArg)
+		args = append(args, useSSHArg)
+	}
+
+	return args, ""
+}
+
+// noUseBinariesCommands are the Carthage commands accepting `--no-use-binaries`.
+var noUseBinariesCommands = []string{"bootstrap", "build", "checkout", "update"}
+
+// applyNoUseBinaries appends `--no-use-binaries` if the Cartfile.resolved has github or git dependencies,
+// so they are built from source instead of using their prebuilt release binaries.
+// Binary dependencies are still installed from their binary specification, the flag does not apply to them.
+func applyNoUseBinaries(args []string, entries []cachedcarthage.ResolvedEntry) []string {
+	if hasArg(args, noUseBinariesArg) {
+		return args
+	}
+
+	var gitBased, binaries []string
+	for _, entry := range entries {
+		if entry.Origin == cachedcarthage.ResolvedOriginBinary {
+			binaries = append(binaries, entry.Name())
+		} else {
+			gitBased = append(gitBased, entry.Name())
+		}
+	}
+
+	if len(gitBased) == 0 {
+		log.Printf("Every dependency is a binary dependency, %s is not appended", noUseBinariesArg)
+		return args
+	}
+	if len(binaries) > 0 {
+		log.Warnf("%s is ignored for the binary dependencies, they are still installed from their binaries: %s", noUseBinariesArg, strings.Join(binaries, ", "))
+	}
+
+	log.Printf("Appending %s to the Carthage options, to build %s from source", noUseBinariesArg, strings.Join(gitBased, ", "))
+	return append(args, noUseBinariesArg)
+}
+
+// autoPlatformCommands are the Carthage commands building the dependencies, which accept `--platform`.
+var autoPlatformCommands = []string{"bootstrap", "build", "update"}
+
+// applyAutoPlatform appends `--platform` with the platforms the project's Xcode projects build for,
+// unless the platforms are set already. Every platform is built if the detection fails.
+func applyAutoPlatform(carthageCommand string, args []string, projectDir string) []string {
+	if !hasArg(autoPlatformCommands, carthageCommand) || hasArg(args, platformArg) {
+		return args
+	}
+
+	platforms, err := cachedcarthage.DetectPlatforms(projectDir)
+	if err != nil {
+		log.Warnf("Building every platform, failed to detect the platforms of the project: %s", err)
+		return args
+	}
+
+	value := strings.Join(platforms, ",")
+	log.Printf("Appending %s %s to the Carthage options, detected from the Xcode projects", platformArg, value)
+	return append(args, platformArg, value)
+}
+
+func hasArg(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCacheKeyFiles returns the newline separated paths, relative paths are joined to the project dir.
+func parseCacheKeyFiles(keyFiles, projectDir string) []string {
+	var paths []string
+	for _, line := range strings.Split(keyFiles, "\n") {
+		pth := strings.TrimSpace(line)
+		if pth == "" {
+			continue
+		}
+		if !filepath.IsAbs(pth) {
+			pth = filepath.Join(projectDir, pth)
+		}
+		paths = append(paths, pth)
+	}
+	return paths
+}
+
+// parseCartfileOverride returns the path of the override Cartfile, a relative path is joined to the project dir.
+func parseCartfileOverride(override, projectDir string) string {
+	pth := strings.TrimSpace(override)
+	if pth != "" && !filepath.IsAbs(pth) {
+		pth = filepath.Join(projectDir, pth)
+	}
+	return pth
+}
+
+// parseCacheDir returns the dir whose Carthage dir is cached, the project dir if not set.
+// A relative path is joined to the project dir.
+func parseCacheDir(cacheDir, projectDir string) (string, error) {
+	pth, err := expandProjectDir(strings.TrimSpace(cacheDir))
+	if err != nil {
+		return "", err
+	}
+	if pth == "" {
+		return projectDir, nil
+	}
+	if !filepath.IsAbs(pth) {
+		pth = filepath.Join(projectDir, pth)
+	}
+	return filepath.Clean(pth), nil
+}
+
+// newCacheProject returns the cached project of the cache dir.
+// The Cartfile.resolved of the cache key is still read from the project dir, where Carthage runs.
+func newCacheProject(projectDir, cacheDir string) cachedcarthage.Project {
+	project := cachedcarthage.NewProject(cacheDir)
+	if cacheDir != projectDir {
+		project = project.WithResolvedFilePath(filepath.Join(projectDir, "Cartfile.resolved"))
+	}
+	return project
+}
+
+// parseResolvedFilePath returns the path of the Cartfile.resolved used for the cache, a relative path is joined to the project dir.
+// It fails if the file does not exist.
+func parseResolvedFilePath(pth, projectDir string) (string, error) {
+	pth = strings.TrimSpace(pth)
+	if !filepath.IsAbs(pth) {
+		pth = filepath.Join(projectDir, pth)
+	}
+
+	if exists, err := pathutil.IsPathExists(pth); err != nil {
+		return "", err
+	} else if !exists {
+		return "", fmt.Errorf("no file found at: %s", pth)
+	}
+
+	return pth, nil
+}
+
+// writeCartfileContents writes the Cartfile contents of the input into a temporary file, used as the override Cartfile.
+func writeCartfileContents(contents string) (string, error) {
+	tmpDir, err := pathutil.NormalizedOSTempDirPath("carthage-cartfile")
+	if err != nil {
+		return "", err
+	}
+
+	pth := filepath.Join(tmpDir, cartfileName)
+	if !strings.HasSuffix(contents, "\n") {
+		contents += "\n"
+	}
+	if err := fileutil.WriteStringToFile(pth, contents); err != nil {
+		return "", err
+	}
+	return pth, nil
+}
+
+// overrideCartfile copies the override over the project's Cartfile,
+// the returned function puts the original Cartfile back (or removes the Cartfile, if the project had none).
+func overrideCartfile(projectDir, overridePath string) (func() error, error) {
+	cartfilePath := filepath.Join(projectDir, cartfileName)
+
+	overrideContent, err := os.ReadFile(overridePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the override Cartfile (%s), error: %s", overridePath, err)
+	}
+
+	originalContent, err := os.ReadFile(cartfilePath)
+	originalExists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s, error: %s", cartfilePath, err)
+	}
+
+	if err := os.WriteFile(cartfilePath, overrideContent, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s, error: %s", cartfilePath, err)
+	}
+	log.Warnf("%s is temporarily replaced with %s", cartfilePath, overridePath)
+
+	return func() error {
+		if !originalExists {
+			return os.Remove(cartfilePath)
+		}
+		if err := os.WriteFile(cartfilePath, originalContent, 0644); err != nil {
+			return err
+		}
+		log.Printf("%s restored", cartfilePath)
+		return nil
+	}, nil
+}
+
+// parseExpectedArchs returns the comma, newline or space separated architectures.
+func parseExpectedArchs(archs string) []string {
+	return strings.FieldsFunc(archs, func(r rune) bool {
+		return r == ',' || r == '\n' || r == ' '
+	})
+}
+
+// Soft failure conditions, which make the Step exit with a configured code instead of 0, although the run succeeded.
+// Hard failures always exit with 1.
+const (
+	// softFailureCacheMiss is met if the bootstrap command could not use the cache.
+	softFailureCacheMiss = "cache-miss"
+	// softFailureWarningsFound is met if the run reported warnings about the build output (see RunResult.Warnings).
+	softFailureWarningsFound = "warnings-found"
+)
+
+// softFailureConditions are the known soft failure conditions, in the order of precedence if several are met.
+var softFailureConditions = []string{softFailureCacheMiss, softFailureWarningsFound}
+
+// parseBlockedCarthageVersions returns the Carthage versions of the blocked_carthage_versions input,
+// the known bad versions if it is empty and none if it is `none`.
+func parseBlockedCarthageVersions(lines string) ([]cachedcarthage.BlockedCarthageVersion, error) {
+	switch strings.TrimSpace(lines) {
+	case "":
+		return cachedcarthage.DefaultBlockedCarthageVersions, nil
+	case "none":
+		return nil, nil
+	}
+	return cachedcarthage.ParseBlockedCarthageVersions(lines)
+}
+
+// parseCPUPriority validates the nice level of the cpu_priority input, 0 keeps the inherited priority.
+// Raising the priority (a negative nice level) is not supported, as it requires root.
+func parseCPUPriority(priority int) (int, error) {
+	if priority != 0 && (priority < cachedcarthage.MinCPUPriority || priority > cachedcarthage.MaxCPUPriority) {
+		return 0, fmt.Errorf("cpu_priority must be 0 or between %d and %d, got %d", cachedcarthage.MinCPUPriority, cachedcarthage.MaxCPUPriority, priority)
+	}
+	return priority, nil
+}
+
+// parseSoftFailureExitCodes parses the comma or newline separated `condition=code` pairs of the
+// soft_failure_exit_codes input (like `cache-miss=2,warnings-found=3`).
+// The codes have to be between 2 and 255, as 0 is the success and 1 is the hard failure exit code.
+func parseSoftFailureExitCodes(mapping string) (map[string]int, error) {
+	codes := map[string]int{}
+	for _, pair := range strings.FieldsFunc(mapping, func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		split := strings.SplitN(pair, "=", 2)
+		if len(split) != 2 {
+			return nil, fmt.Errorf("invalid soft failure exit code mapping: %s, expected format: condition=code", pair)
+		}
+
+		condition := strings.TrimSpace(split[0])
+		switch condition {
+		case softFailureCacheMiss, softFailureWarningsFound:
+		default:
+			return nil, fmt.Errorf("unknown soft failure condition: %s, known conditions: %s", condition, strings.Join(softFailureConditions, ", "))
+		}
+
+		code, err := strconv.Atoi(strings.TrimSpace(split[1]))
+		if err != nil || code < 2 || code > 255 {
+			return nil, fmt.Errorf("invalid exit code for %s: %s, expected a number between 2 and 255", condition, strings.TrimSpace(split[1]))
+		}
+		codes[condition] = code
+	}
+	return codes, nil
+}
+
+// softFailureExitCode returns the exit code and the name of the first met soft failure condition which has a code,
+// 0 if none is met.
+func softFailureExitCode(result cachedcarthage.RunResult, codes map[string]int) (int, string) {
+	for _, condition := range softFailureConditions {
+		code, ok := codes[condition]
+		if !ok {
+			continue
+		}
+
+		met := false
+		switch condition {
+		case softFailureCacheMiss:
+			met = result.Command == "bootstrap" && !result.CacheHit
+		case softFailureWarningsFound:
+			met = len(result.Warnings) > 0
+		}
+		if met {
+			return code, condition
+		}
+	}
+	return 0, ""
+}
+
+func parseCachePlatforms(platforms string) []string {
+	return strings.FieldsFunc(platforms, func(r rune) bool {
+		return r == ',' || r == '\n' || r == ' '
+	})
+}
+
+func getXcodeVersion() (string, error) {
+	cmd := command.NewFactory(env.NewRepository()).Create("xcodebuild", []string{"-version"}, nil)
+	out, err := cmd.RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		return "", err
+	}
+
+	match := xcodeVersionPattern.FindStringSubmatch(out)
+	if match == nil {
+		return "", fmt.Errorf("failed to parse `$ xcodebuild -version` output: %s", out)
+	}
+
+	return match[1], nil
+}
+
+// parseSwiftVersion returns the version number of the `$ swift -version` output, or its first line if not found.
+func parseSwiftVersion(out string) string {
+	if match := swiftVersionPattern.FindStringSubmatch(out); match != nil {
+		return match[1]
+	}
+
+	return strings.TrimSpace(strings.Split(out, "\n")[0])
+}
+
+// exportToolVersions exports the detected tool versions, the Xcode version is skipped if it was not detected.
+func exportToolVersions(exporter cachedcarthage.OutputExporter, carthageVersion, swiftVersion, xcodeVersion string) {
+	versions := []struct{ key, value string }{
+		{carthageVersionOutputKey, carthageVersion},
+		{swiftVersionOutputKey, swiftVersion},
+		{xcodeVersionOutputKey, xcodeVersion},
+	}
+
+	for _, version := range versions {
+		if version.value == "" {
+			continue
+		}
+
+		if err := exporter.ExportOutput(version.key, version.value); err != nil {
+			log.Warnf("Failed to export %s, error: %s", version.key, err)
+		}
+	}
+}
+
+func parseProjectDir(originalDir string, customCarthageOptions []string) (string, error) {
+	isNextOptionProjectDir := false
+	for _, option := range customCarthageOptions {
+		if option == projectDirArg {
+			isNextOptionProjectDir = true
+			continue
+		}
+
+		if isNextOptionProjectDir {
+			projectDir, err := expandProjectDir(option)
+			if err != nil {
+				return "", err
+			}
+
+			fmt.Println()
+			log.Infof("--project-directory flag found with value: %s", projectDir)
+			log.Printf("using %s as working directory", projectDir)
+
+			return projectDir, nil
+		}
+	}
+
+	return detectProjectDir(originalDir)
+}
+
+// detectProjectDir falls back to the only direct subdirectory containing a Cartfile,
+// if the given directory has no Cartfile of its own.
+func detectProjectDir(dir string) (string, error) {
+	if exists, err := pathutil.IsPathExists(filepath.Join(dir, cartfileName)); err != nil {
+		return "", err
+	} else if exists {
+		return dir, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dir, nil
+		}
+		return "", err
+	}
+
+	var candidates []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		candidate := filepath.Join(dir, entry.Name())
+		if exists, err := pathutil.IsPathExists(filepath.Join(candidate, cartfileName)); err != nil {
+			return "", err
+		} else if exists {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return dir, nil
+	case 1:
+		log.Warnf("No %s found in %s, using %s as project directory", cartfileName, dir, candidates[0])
+		log.Warnf("Add %s %s to the Carthage options to silence this warning", projectDirArg, candidates[0])
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("no %s found in %s and multiple subdirectories contain one (%s), specify the project with %s", cartfileName, dir, strings.Join(candidates, ", "), projectDirArg)
+	}
+}
+
+// findResolvedFiles returns the Cartfile.resolved files of the dir tree, relative to the dir.
+// The Carthage dirs (with the dependencies' own resolved files in the checkouts) and the hidden dirs are skipped.
+func findResolvedFiles(dir string) ([]string, error) {
+	var pths []string
+	err := filepath.WalkDir(dir, func(pth string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if pth != dir && (entry.Name() == "Carthage" || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if entry.Name() == "Cartfile.resolved" {
+			rel, err := filepath.Rel(dir, pth)
+			if err != nil {
+				return err
+			}
+			pths = append(pths, rel)
+		}
+		return nil
+	})
+	return pths, err
+}
+
+// multipleResolvedFilesWarning returns a warning listing the Cartfile.resolved files of the root dir's tree,
+// if there is more than one, with the one used for the cache key. Empty if there is at most one.
+func multipleResolvedFilesWarning(root, usedPath string) (string, error) {
+	pths, err := findResolvedFiles(root)
+	if err != nil {
+		return "", err
+	}
+	if len(pths) < 2 {
+		return "", nil
+	}
+
+	used := usedPath
+	if rel, err := filepath.Rel(root, usedPath); err == nil && !strings.HasPrefix(rel, "..") {
+		used = rel
+	}
+	return fmt.Sprintf("Found %d Cartfile.resolved files in %s: %s, using %s for the cache key", len(pths), root, strings.Join(pths, ", "), used), nil
+}
+
+// validateProjectDirInRoot fails if the project dir (after resolving symlinks) is not the root dir or inside it,
+// a relative root or project dir is relative to the working directory.
+// If allowOutside is set, a project dir outside of the root is only printed as a warning.
+func validateProjectDirInRoot(projectDir, root string, allowOutside bool) error {
+	resolvedProjectDir, err := resolvePath(projectDir)
+	if err != nil {
+		return err
+	}
+	resolvedRoot, err := resolvePath(root)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(resolvedRoot, resolvedProjectDir)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+
+	if allowOutside {
+		log.Warnf("Project directory (%s) is outside of %s", projectDir, root)
+		return nil
+	}
+	return fmt.Errorf("project directory (%s) is outside of %s, set **Allowed project directory root** or enable **Allow a project directory outside the root**", projectDir, root)
+}
+
+// resolvePath returns the absolute path with symlinks resolved, or the absolute path as is if it does not exist.
+func resolvePath(pth string) (string, error) {
+	absPath, err := filepath.Abs(pth)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path of %s, error: %s", pth, err)
+	}
+
+	resolvedPath, err := filepath.EvalSymlinks(absPath)
+	if os.IsNotExist(err) {
+		return absPath, nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to resolve symlinks of %s, error: %s", absPath, err)
+	}
+
+	return resolvedPath, nil
+}
+
+// expandProjectDir expands the leading `~` (the home dir) or `~user` (the home dir of the user) of the dir.
+func expandProjectDir(dir string) (string, error) {
+	if !strings.HasPrefix(dir, "~") {
+		return dir, nil
+	}
+
+	expandedDir, err := pathutil.ExpandTilde(dir)
+	if err != nil {
+		username := strings.SplitN(strings.TrimPrefix(dir, "~"), "/", 2)[0]
+		return "", fmt.Errorf("failed to expand %s, no home dir found for user %s, error: %s", dir, username, err)
+	}
+
+	return expandedDir, nil
+}
+
+// withProjectDirArg sets the `--project-directory` value of the Carthage options to the project dir,
+// so Carthage runs in the same (expanded) dir the Step uses.
+// The option is only appended if the project dir differs from the source dir.
+func withProjectDirArg(args []string, projectDir, sourceDir string) []string {
+	for i, arg := range args {
+		if arg == projectDirArg && i+1 < len(args) {
+			rewritten := append([]string{}, args...)
+			rewritten[i+1] = projectDir
+			return rewritten
+		}
+	}
+
+	if projectDir != sourceDir {
+		return append(args, projectDirArg, projectDir)
+	}
+	return args
 }
@@ -0,0 +1,37 @@
+package main
+
+import mock "github.com/stretchr/testify/mock"
+
+// MockEnvRepository is an autogenerated mock type for the Repository type
+type MockEnvRepository struct {
+	mock.Mock
+}
+
+// Get provides a mock function with given fields: key
+func (m *MockEnvRepository) Get(key string) string {
+	args := m.Called(key)
+	return args.String(0)
+}
+
+// List provides a mock function with given fields:
+func (m *MockEnvRepository) List() []string {
+	args := m.Called()
+	return args.Get(0).([]string)
+}
+
+// Set provides a mock function with given fields: key, value
+func (m *MockEnvRepository) Set(key string, value string) error {
+	args := m.Called(key, value)
+	return args.Error(0)
+}
+
+// Unset provides a mock function with given fields: key
+func (m *MockEnvRepository) Unset(key string) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+func (m *MockEnvRepository) GivenGetReturns(key, value string) *MockEnvRepository {
+	m.On("Get", key).Return(value)
+	return m
+}
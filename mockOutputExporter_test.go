@@ -0,0 +1,19 @@
+package main
+
+import mock "github.com/stretchr/testify/mock"
+
+// MockOutputExporter is an autogenerated mock type for the OutputExporter type
+type MockOutputExporter struct {
+	mock.Mock
+}
+
+// ExportOutput provides a mock function with given fields: key, value
+func (m *MockOutputExporter) ExportOutput(key string, value string) error {
+	args := m.Called(key, value)
+	return args.Error(0)
+}
+
+func (m *MockOutputExporter) GivenExportOutputSucceeds() *MockOutputExporter {
+	m.On("ExportOutput", mock.Anything, mock.Anything).Return(nil)
+	return m
+}